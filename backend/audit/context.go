@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"context"
+
+	"example.com/echo-backend/auth"
+	"github.com/labstack/echo/v4"
+)
+
+type contextKey struct{}
+
+type requestInfo struct {
+	actor     string
+	requestID string
+}
+
+// Middleware stores who is making the request and the request ID in the
+// request context so that the service can attach them to audit entries.
+// It must run after middleware.RequestID and auth.Middleware.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			actor := "anonymous"
+			if principal, ok := auth.PrincipalFromContext(c.Request().Context()); ok {
+				actor = principal.String()
+			}
+			info := requestInfo{
+				actor:     actor,
+				requestID: c.Response().Header().Get(echo.HeaderXRequestID),
+			}
+			ctx := context.WithValue(c.Request().Context(), contextKey{}, info)
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+func requestInfoFromContext(ctx context.Context) requestInfo {
+	info, ok := ctx.Value(contextKey{}).(requestInfo)
+	if !ok {
+		// mutations made outside of a request, e.g. by background jobs
+		return requestInfo{actor: "system"}
+	}
+	return info
+}
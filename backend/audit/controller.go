@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"example.com/echo-backend/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// Authorizer checks a principal's role on a map, including maps in the
+// trash, see maps.Service
+type Authorizer interface {
+	AuthorizeTrashed(ctx context.Context, id string, role string) error
+}
+
+type Controller struct {
+	e          *echo.Echo
+	service    *Service
+	authorizer Authorizer
+}
+
+func NewController(e *echo.Echo, service *Service, authorizer Authorizer) *Controller {
+	c := &Controller{e: e, service: service, authorizer: authorizer}
+	e.GET("/audit", c.getEntries)
+	e.GET("/map/:id/audit", c.getEntriesByMapId)
+	return c
+}
+
+func (con *Controller) getEntriesByMapId(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	// only owners may see who changed their map, also once it is in the trash
+	if err := con.authorizer.AuthorizeTrashed(ctx, id, auth.RoleOwner); err != nil {
+		return err
+	}
+	principal, _ := auth.PrincipalFromContext(ctx)
+	limit, err := parseLimit(c.QueryParam("limit"))
+	if err != nil {
+		return InvalidFilterError()
+	}
+	entries, err := con.service.getEntriesByMapId(ctx, id, principal.WorkspaceID, limit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// the global log spans every map of the workspace, so it is only open to
+// the workspace's owners
+func (con *Controller) getEntries(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || !principal.HasWorkspace() {
+		return auth.NoWorkspaceError()
+	}
+	if principal.WorkspaceRole != auth.RoleOwner {
+		return auth.ForbiddenError()
+	}
+	limit, err := parseLimit(c.QueryParam("limit"))
+	if err != nil {
+		return InvalidFilterError()
+	}
+	entries, err := con.service.getEntries(ctx, principal.WorkspaceID, Filter{
+		Actor:      c.QueryParam("actor"),
+		Action:     c.QueryParam("action"),
+		EntityType: c.QueryParam("entity_type"),
+		MapID:      c.QueryParam("map_id"),
+		Since:      c.QueryParam("since"),
+		Until:      c.QueryParam("until"),
+		Limit:      limit,
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+func parseLimit(value string) (int32, error) {
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int32(limit), nil
+}
@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"net/http"
+
+	"example.com/echo-backend/problem"
+)
+
+type CustomError = problem.Error
+
+func InvalidUUIDError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_uuid"
+	err.Message = "Invalid UUID format"
+	return &err
+}
+
+func InvalidFilterError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_filter"
+	err.Message = "Invalid audit filter, try again"
+	return &err
+}
+
+func InternalServerError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusInternalServerError
+	err.Code = "internal_error"
+	err.Message = "Internal Server Error, try again"
+	return &err
+}
@@ -0,0 +1,213 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("example.com/echo-backend/audit")
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+
+	EntityMap       = "map"
+	EntityZone      = "zone"
+	EntityRoute     = "route"
+	EntityRole      = "role"
+	EntityShareLink = "share_link"
+	EntityMember    = "member"
+)
+
+const defaultLimit = 100
+const maxLimit = 1000
+
+type Service struct {
+	db db.Querier
+}
+
+// Entry describes a single mutation. Before and After are snapshots of the
+// entity and are stored as JSON, nil meaning the entity did not exist.
+// MapID is left zero for changes that don't belong to a map.
+type Entry struct {
+	Action      string
+	EntityType  string
+	EntityID    uuid.UUID
+	MapID       uuid.UUID
+	WorkspaceID uuid.UUID
+	Before      interface{}
+	After       interface{}
+}
+
+type Filter struct {
+	Actor      string
+	Action     string
+	EntityType string
+	MapID      string
+	Since      string
+	Until      string
+	Limit      int32
+}
+
+type EntryRes struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Actor      string          `json:"actor"`
+	RequestID  string          `json:"request_id"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   uuid.UUID       `json:"entity_id"`
+	MapID      *uuid.UUID      `json:"map_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+}
+
+func NewService(db db.Querier) *Service {
+	service := Service{
+		db: db,
+	}
+	return &service
+}
+
+// Record appends an entry to the audit log, taking the actor and request ID
+// from ctx. q should belong to the transaction making the change, so the
+// entry is committed or rolled back with it.
+func Record(ctx context.Context, q db.Querier, entry Entry) error {
+	ctx, span := tracer.Start(ctx, "audit.Record")
+	defer span.End()
+	info := requestInfoFromContext(ctx)
+	before, err := marshalSnapshot(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalSnapshot(entry.After)
+	if err != nil {
+		return err
+	}
+	_, err = q.CreateAuditEntry(ctx, db.CreateAuditEntryParams{
+		Actor:       info.actor,
+		RequestID:   pgtype.Text{String: info.requestID, Valid: info.requestID != ""},
+		Action:      entry.Action,
+		EntityType:  entry.EntityType,
+		EntityID:    entry.EntityID,
+		MapID:       pgtype.UUID{Bytes: entry.MapID, Valid: entry.MapID != uuid.Nil},
+		Before:      before,
+		After:       after,
+		WorkspaceID: entry.WorkspaceID,
+	})
+	return err
+}
+
+func (s *Service) getEntriesByMapId(ctx context.Context, id string, workspaceID uuid.UUID, limit int32) ([]EntryRes, error) {
+	ctx, span := tracer.Start(ctx, "audit.getEntriesByMapId")
+	defer span.End()
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
+		return []EntryRes{}, InvalidUUIDError()
+	}
+	rows, err := s.db.GetAuditEntriesByMapId(ctx, db.GetAuditEntriesByMapIdParams{
+		MapID:       pgtype.UUID{Bytes: uuid, Valid: true},
+		WorkspaceID: workspaceID,
+		Limit:       clampLimit(limit),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing map audit entries failed", "err", err)
+		return []EntryRes{}, InternalServerError()
+	}
+	return toEntryRes(rows), nil
+}
+
+func (s *Service) getEntries(ctx context.Context, workspaceID uuid.UUID, filter Filter) ([]EntryRes, error) {
+	ctx, span := tracer.Start(ctx, "audit.getEntries")
+	defer span.End()
+	params := db.GetAuditEntriesParams{
+		WorkspaceID: workspaceID,
+		Actor:       optionalText(filter.Actor),
+		Action:      optionalText(filter.Action),
+		EntityType:  optionalText(filter.EntityType),
+		Limit:       clampLimit(filter.Limit),
+	}
+	if filter.MapID != "" {
+		if err := params.MapID.Scan(filter.MapID); err != nil {
+			slog.DebugContext(ctx, "Invalid map id", "err", err)
+			return []EntryRes{}, InvalidUUIDError()
+		}
+	}
+	if filter.Since != "" {
+		t, err := time.Parse(time.RFC3339, filter.Since)
+		if err != nil {
+			slog.DebugContext(ctx, "Invalid since", "err", err)
+			return []EntryRes{}, InvalidFilterError()
+		}
+		params.Since = pgtype.Timestamptz{Time: t, Valid: true}
+	}
+	if filter.Until != "" {
+		t, err := time.Parse(time.RFC3339, filter.Until)
+		if err != nil {
+			slog.DebugContext(ctx, "Invalid until", "err", err)
+			return []EntryRes{}, InvalidFilterError()
+		}
+		params.Until = pgtype.Timestamptz{Time: t, Valid: true}
+	}
+	rows, err := s.db.GetAuditEntries(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing audit entries failed", "err", err)
+		return []EntryRes{}, InternalServerError()
+	}
+	return toEntryRes(rows), nil
+}
+
+func marshalSnapshot(snapshot interface{}) ([]byte, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	return json.Marshal(snapshot)
+}
+
+func optionalText(value string) pgtype.Text {
+	return pgtype.Text{String: value, Valid: value != ""}
+}
+
+func clampLimit(limit int32) int32 {
+	if limit <= 0 {
+		return defaultLimit
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+func toEntryRes(rows []db.AuditLog) []EntryRes {
+	entries := make([]EntryRes, 0, len(rows))
+	for _, row := range rows {
+		entry := EntryRes{
+			ID:         row.ID,
+			CreatedAt:  row.CreatedAt,
+			Actor:      row.Actor,
+			RequestID:  row.RequestID.String,
+			Action:     row.Action,
+			EntityType: row.EntityType,
+			EntityID:   row.EntityID,
+			Before:     row.Before,
+			After:      row.After,
+		}
+		if row.MapID.Valid {
+			mapID := uuid.UUID(row.MapID.Bytes)
+			entry.MapID = &mapID
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
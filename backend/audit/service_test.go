@@ -0,0 +1,214 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/problem"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeQuerier records the audit queries, any other query panics
+type fakeQuerier struct {
+	db.Querier
+	created []db.CreateAuditEntryParams
+	filters []db.GetAuditEntriesParams
+}
+
+func (q *fakeQuerier) CreateAuditEntry(ctx context.Context, arg db.CreateAuditEntryParams) (db.AuditLog, error) {
+	q.created = append(q.created, arg)
+	return db.AuditLog{}, nil
+}
+
+func (q *fakeQuerier) GetAuditEntries(ctx context.Context, arg db.GetAuditEntriesParams) ([]db.AuditLog, error) {
+	q.filters = append(q.filters, arg)
+	return nil, nil
+}
+
+func TestRecordInRequest(t *testing.T) {
+	q := &fakeQuerier{}
+	mapID := uuid.New()
+	workspaceID := uuid.New()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/map/"+mapID.String(), nil)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Kind: auth.KindUser, Subject: "42"}))
+	c := e.NewContext(req, httptest.NewRecorder())
+	c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+
+	handler := Middleware()(func(c echo.Context) error {
+		return Record(c.Request().Context(), q, Entry{
+			Action:      ActionUpdate,
+			EntityType:  EntityMap,
+			EntityID:    mapID,
+			MapID:       mapID,
+			WorkspaceID: workspaceID,
+			Before:      map[string]string{"name": "old"},
+			After:       map[string]string{"name": "new"},
+		})
+	})
+	if err := handler(c); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	if len(q.created) != 1 {
+		t.Fatalf("recorded %d entries, want 1", len(q.created))
+	}
+	got := q.created[0]
+	if got.Actor != "user:42" {
+		t.Errorf("actor = %q, want user:42", got.Actor)
+	}
+	if got.RequestID != (pgtype.Text{String: "req-1", Valid: true}) {
+		t.Errorf("request id = %v, want req-1", got.RequestID)
+	}
+	if got.MapID != (pgtype.UUID{Bytes: mapID, Valid: true}) {
+		t.Errorf("map id = %v, want %v", got.MapID, mapID)
+	}
+	if got.WorkspaceID != workspaceID || got.EntityID != mapID {
+		t.Errorf("workspace id, entity id = %v, %v", got.WorkspaceID, got.EntityID)
+	}
+	if string(got.Before) != `{"name":"old"}` || string(got.After) != `{"name":"new"}` {
+		t.Errorf("before, after = %s, %s", got.Before, got.After)
+	}
+}
+
+// background jobs have no request, and membership changes belong to no map
+func TestRecordOutsideRequest(t *testing.T) {
+	q := &fakeQuerier{}
+	err := Record(context.Background(), q, Entry{
+		Action:      ActionDelete,
+		EntityType:  EntityMember,
+		EntityID:    uuid.New(),
+		WorkspaceID: uuid.New(),
+		Before:      map[string]string{"role": "owner"},
+	})
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	got := q.created[0]
+	if got.Actor != "system" {
+		t.Errorf("actor = %q, want system", got.Actor)
+	}
+	if got.RequestID.Valid {
+		t.Errorf("request id = %v, want NULL", got.RequestID)
+	}
+	if got.MapID.Valid {
+		t.Errorf("map id = %v, want NULL", got.MapID)
+	}
+	if got.After != nil {
+		t.Errorf("after = %s, want NULL", got.After)
+	}
+}
+
+func TestGetEntriesFilter(t *testing.T) {
+	mapID := uuid.New()
+	tests := []struct {
+		name   string
+		filter Filter
+		status int
+	}{
+		{"no filter", Filter{}, 0},
+		{"all filters", Filter{Actor: "user:42", Action: ActionUpdate, EntityType: EntityMap, MapID: mapID.String(), Since: "2024-01-01T00:00:00Z", Until: "2024-02-01T00:00:00Z", Limit: 5}, 0},
+		{"invalid map id", Filter{MapID: "nope"}, http.StatusBadRequest},
+		{"invalid since", Filter{Since: "yesterday"}, http.StatusBadRequest},
+		{"invalid until", Filter{Until: "2024-02-01"}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := &fakeQuerier{}
+			_, err := NewService(q).getEntries(context.Background(), uuid.New(), test.filter)
+			if test.status != 0 {
+				if problem.StatusOf(err) != test.status {
+					t.Fatalf("getEntries = %v, want %d", err, test.status)
+				}
+				if len(q.filters) != 0 {
+					t.Fatal("getEntries queried with an invalid filter")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getEntries: %v", err)
+			}
+			if len(q.filters) != 1 {
+				t.Fatalf("getEntries ran %d queries, want 1", len(q.filters))
+			}
+		})
+	}
+}
+
+func TestGetEntriesFilterParams(t *testing.T) {
+	q := &fakeQuerier{}
+	mapID := uuid.New()
+	_, err := NewService(q).getEntries(context.Background(), uuid.New(), Filter{
+		Actor: "user:42",
+		MapID: mapID.String(),
+		Since: "2024-01-01T00:00:00Z",
+		Limit: 5000,
+	})
+	if err != nil {
+		t.Fatalf("getEntries: %v", err)
+	}
+	got := q.filters[0]
+	if got.Actor != (pgtype.Text{String: "user:42", Valid: true}) || got.Action.Valid || got.EntityType.Valid {
+		t.Errorf("actor, action, entity type = %v, %v, %v", got.Actor, got.Action, got.EntityType)
+	}
+	if got.MapID != (pgtype.UUID{Bytes: mapID, Valid: true}) {
+		t.Errorf("map id = %v, want %v", got.MapID, mapID)
+	}
+	if !got.Since.Valid || !got.Since.Time.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || got.Until.Valid {
+		t.Errorf("since, until = %v, %v", got.Since, got.Until)
+	}
+	if got.Limit != maxLimit {
+		t.Errorf("limit = %d, want %d", got.Limit, maxLimit)
+	}
+}
+
+func TestClampLimit(t *testing.T) {
+	tests := []struct {
+		limit int32
+		want  int32
+	}{
+		{-1, defaultLimit},
+		{0, defaultLimit},
+		{1, 1},
+		{maxLimit, maxLimit},
+		{maxLimit + 1, maxLimit},
+	}
+	for _, test := range tests {
+		if got := clampLimit(test.limit); got != test.want {
+			t.Errorf("clampLimit(%d) = %d, want %d", test.limit, got, test.want)
+		}
+	}
+}
+
+func TestToEntryRes(t *testing.T) {
+	mapID := uuid.New()
+	entries := toEntryRes([]db.AuditLog{
+		{ID: 1, MapID: pgtype.UUID{Bytes: mapID, Valid: true}},
+		{ID: 2},
+	})
+	if entries[0].MapID == nil || *entries[0].MapID != mapID {
+		t.Errorf("map_id = %v, want %v", entries[0].MapID, mapID)
+	}
+	if entries[1].MapID != nil {
+		t.Errorf("map_id = %v, want null", entries[1].MapID)
+	}
+	body, err := json.Marshal(entries[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := decoded["map_id"]; !ok || value != nil {
+		t.Errorf("map_id encodes as %v, want null", value)
+	}
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Controller struct {
+	e       *echo.Echo
+	service *Service
+}
+
+func NewController(e *echo.Echo, service *Service) *Controller {
+	c := &Controller{e: e, service: service}
+	e.GET("/me", c.getMe)
+	e.POST("/api-keys", c.createApiKey)
+	e.GET("/api-keys", c.getApiKeys)
+	e.DELETE("/api-keys/:id", c.revokeApiKey)
+	return c
+}
+
+func (con *Controller) getMe(c echo.Context) error {
+	principal, ok := PrincipalFromContext(c.Request().Context())
+	if !ok {
+		return UnauthorizedError()
+	}
+	return c.JSON(http.StatusOK, principal)
+}
+
+// API keys can only be managed by the users owning a workspace, so a leaked
+// key cannot mint more keys
+func requireWorkspaceOwner(c echo.Context) (Principal, error) {
+	principal, ok := PrincipalFromContext(c.Request().Context())
+	if !ok || principal.Kind != KindUser {
+		return Principal{}, ForbiddenError()
+	}
+	if !principal.HasWorkspace() {
+		return Principal{}, NoWorkspaceError()
+	}
+	if principal.WorkspaceRole != RoleOwner {
+		return Principal{}, ForbiddenError()
+	}
+	return principal, nil
+}
+
+func (con *Controller) createApiKey(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, err := requireWorkspaceOwner(c)
+	if err != nil {
+		return err
+	}
+	req := ApiKeyCreationReq{}
+	if err := c.Bind(&req); err != nil {
+		return BadRequestError()
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	key, err := con.service.createApiKey(ctx, req, principal)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, key)
+}
+
+func (con *Controller) getApiKeys(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, err := requireWorkspaceOwner(c)
+	if err != nil {
+		return err
+	}
+	keys, err := con.service.getApiKeys(ctx, principal.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+func (con *Controller) revokeApiKey(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, err := requireWorkspaceOwner(c)
+	if err != nil {
+		return err
+	}
+	if err := con.service.revokeApiKey(ctx, c.Param("id"), principal.WorkspaceID); err != nil {
+		return err
+	}
+	return c.String(http.StatusOK, "Revoked API key successfully")
+}
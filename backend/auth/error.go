@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http"
+
+	"example.com/echo-backend/problem"
+)
+
+type CustomError = problem.Error
+
+func NoWorkspaceError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "no_workspace"
+	err.Message = "Select a workspace with the X-Workspace-ID header"
+	return &err
+}
+
+func UnauthorizedError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusUnauthorized
+	err.Code = "unauthorized"
+	err.Message = "Missing or invalid credentials"
+	return &err
+}
+
+func ForbiddenError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusForbidden
+	err.Code = "forbidden"
+	err.Message = "Not allowed to perform this action"
+	return &err
+}
+
+func InvalidUUIDError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_uuid"
+	err.Message = "Invalid UUID format"
+	return &err
+}
+
+func NotFoundError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusNotFound
+	err.Code = "not_found"
+	err.Message = "UUID not found"
+	return &err
+}
+
+func BadRequestError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_body"
+	err.Message = "Bad Request Body, try again"
+	return &err
+}
+
+func InternalServerError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusInternalServerError
+	err.Code = "internal_error"
+	err.Message = "Internal Server Error, try again"
+	return &err
+}
+
+func DatabaseUnavailableError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusServiceUnavailable
+	err.Code = "database_unavailable"
+	err.Message = "Database is unavailable, try again later"
+	return &err
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"example.com/echo-backend/problem"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	HeaderApiKey      = "X-API-Key"
+	HeaderWorkspaceID = "X-Workspace-ID"
+)
+
+// Middleware authenticates every request not matched by skipper, either with
+// an API key in the X-API-Key header or a JWT in the Authorization header,
+// and selects the workspace from the API key, the JWT's workspace_id claim
+// or the X-Workspace-ID header. The principal is stored in the request
+// context for controllers and services.
+func Middleware(service *Service, skipper middleware.Skipper) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+			principal, err := authenticate(c, service)
+			if err != nil {
+				if problem.StatusOf(err) == http.StatusUnauthorized {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="map-editor"`)
+				}
+				return err
+			}
+			ctx := WithPrincipal(c.Request().Context(), principal)
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+func authenticate(c echo.Context, service *Service) (Principal, error) {
+	ctx := c.Request().Context()
+	workspaceID := c.Request().Header.Get(HeaderWorkspaceID)
+	if workspaceID == "" && queryAuthAllowed(c) {
+		workspaceID = c.QueryParam("workspace_id")
+	}
+	if key := c.Request().Header.Get(HeaderApiKey); key != "" {
+		return service.authenticateApiKey(ctx, key, workspaceID)
+	}
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	scheme, token, found := strings.Cut(header, " ")
+	if header == "" && queryAuthAllowed(c) {
+		scheme, token, found = "Bearer", c.QueryParam("access_token"), true
+	}
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return Principal{}, UnauthorizedError()
+	}
+	return service.authenticateToken(ctx, token, workspaceID)
+}
+
+// queryAuthAllowed reports whether the token and workspace may come from the
+// access_token and workspace_id query parameters. Browsers can't set headers
+// on WebSocket handshakes or EventSource streams, so only the live editing
+// socket and the change feed take them, everything else has to use the
+// headers.
+func queryAuthAllowed(c echo.Context) bool {
+	switch c.Path() {
+	case "/map/:id/live":
+		return strings.EqualFold(c.Request().Header.Get(echo.HeaderUpgrade), "websocket")
+	case "/events":
+		return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream")
+	}
+	return false
+}
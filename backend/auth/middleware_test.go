@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/problem"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMiddleware(t *testing.T) {
+	workspaceID := uuid.New()
+	q := &fakeQuerier{
+		roles:   map[uuid.UUID]map[string]string{workspaceID: {"user:42": RoleViewer}},
+		apiKeys: map[string]db.ApiKey{hashApiKey(apiKeyPrefix + "key"): {ID: uuid.New(), WorkspaceID: workspaceID}},
+	}
+	token := signToken(t, jwt.SigningMethodHS256, testConfig.Secret, testClaims(nil))
+
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	e.Use(Middleware(NewService(q, testConfig), func(c echo.Context) bool {
+		return c.Path() == "/healthz"
+	}))
+	principal := func(c echo.Context) error {
+		principal, _ := PrincipalFromContext(c.Request().Context())
+		return c.JSON(http.StatusOK, principal)
+	}
+	e.GET("/healthz", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/me", principal)
+	e.GET("/events", principal)
+	e.GET("/map/:id/live", principal)
+
+	tests := []struct {
+		name    string
+		target  string
+		headers map[string]string
+		status  int
+	}{
+		{name: "skipped route", target: "/healthz", status: http.StatusOK},
+		{name: "no credentials", target: "/me", status: http.StatusUnauthorized},
+		{name: "bearer token", target: "/me", headers: map[string]string{"Authorization": "Bearer " + token}, status: http.StatusOK},
+		{name: "scheme in lower case", target: "/me", headers: map[string]string{"Authorization": "bearer " + token}, status: http.StatusOK},
+		{name: "other scheme", target: "/me", headers: map[string]string{"Authorization": "Basic " + token}, status: http.StatusUnauthorized},
+		{name: "empty token", target: "/me", headers: map[string]string{"Authorization": "Bearer "}, status: http.StatusUnauthorized},
+		{name: "API key", target: "/me", headers: map[string]string{HeaderApiKey: apiKeyPrefix + "key"}, status: http.StatusOK},
+		{name: "wrong API key", target: "/me", headers: map[string]string{HeaderApiKey: apiKeyPrefix + "guess"}, status: http.StatusUnauthorized},
+		{name: "workspace header", target: "/me", headers: map[string]string{"Authorization": "Bearer " + token, HeaderWorkspaceID: workspaceID.String()}, status: http.StatusOK},
+		{name: "query token on a normal route", target: "/me?access_token=" + token, status: http.StatusUnauthorized},
+		{name: "query token on the change feed", target: "/events?access_token=" + token + "&workspace_id=" + workspaceID.String(), headers: map[string]string{"Accept": "text/event-stream"}, status: http.StatusOK},
+		{name: "query token on the feed without streaming", target: "/events?access_token=" + token, status: http.StatusUnauthorized},
+		{name: "query token on the live socket", target: "/map/1/live?access_token=" + token, headers: map[string]string{"Upgrade": "websocket"}, status: http.StatusOK},
+		{name: "query token on live without upgrading", target: "/map/1/live?access_token=" + token, status: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.target, nil)
+			for name, value := range test.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get(echo.HeaderWWWAuthenticate) == "" {
+				t.Fatal("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const (
+	KindUser   = "user"
+	KindApiKey = "api_key"
+)
+
+// Principal is the authenticated caller of a request, either a user
+// identified by the subject of their JWT or a service using an API key.
+// WorkspaceID is the tenant the request acts in and WorkspaceRole the
+// principal's role there, empty for users who are not members and can only
+// reach the maps shared with them.
+type Principal struct {
+	Kind          string    `json:"kind"`
+	Subject       string    `json:"subject"`
+	Name          string    `json:"name"`
+	WorkspaceID   uuid.UUID `json:"workspace_id"`
+	WorkspaceRole string    `json:"workspace_role"`
+}
+
+// String identifies the principal in logs and the audit log, e.g. user:42
+func (p Principal) String() string {
+	return p.Kind + ":" + p.Subject
+}
+
+// HasWorkspace reports whether the request selected a workspace
+func (p Principal) HasWorkspace() bool {
+	return p.WorkspaceID != uuid.Nil
+}
+
+type contextKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal stored by Middleware, ok is
+// false for unauthenticated requests and background jobs.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,27 @@
+package auth
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// each role can do everything the roles ranked below it can
+var roleRank = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// RoleAtLeast reports whether granted allows everything required allows
+func RoleAtLeast(granted string, required string) bool {
+	return roleRank[granted] >= roleRank[required]
+}
+
+// HigherRole returns the more powerful of two roles, an empty role ranks lowest
+func HigherRole(a string, b string) string {
+	if roleRank[b] > roleRank[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,46 @@
+package auth
+
+import "testing"
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		granted  string
+		required string
+		want     bool
+	}{
+		{RoleOwner, RoleOwner, true},
+		{RoleOwner, RoleEditor, true},
+		{RoleOwner, RoleViewer, true},
+		{RoleEditor, RoleOwner, false},
+		{RoleEditor, RoleEditor, true},
+		{RoleEditor, RoleViewer, true},
+		{RoleViewer, RoleEditor, false},
+		{RoleViewer, RoleViewer, true},
+		{"", RoleViewer, false},
+		{"admin", RoleViewer, false},
+	}
+	for _, test := range tests {
+		if got := RoleAtLeast(test.granted, test.required); got != test.want {
+			t.Errorf("RoleAtLeast(%q, %q) = %v, want %v", test.granted, test.required, got, test.want)
+		}
+	}
+}
+
+func TestHigherRole(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{RoleViewer, RoleOwner, RoleOwner},
+		{RoleOwner, RoleViewer, RoleOwner},
+		{RoleEditor, RoleEditor, RoleEditor},
+		{"", RoleViewer, RoleViewer},
+		{RoleEditor, "", RoleEditor},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		if got := HigherRole(test.a, test.b); got != test.want {
+			t.Errorf("HigherRole(%q, %q) = %q, want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/problem"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("example.com/echo-backend/auth")
+
+// all API keys start with this so they are easy to spot in leaked files
+const apiKeyPrefix = "mek_"
+
+// last_used_at is only moved on once it is this old, so busy keys don't
+// write on every request
+const apiKeyTouchInterval = time.Minute
+
+type JWTConfig struct {
+	Secret   []byte
+	Issuer   string
+	Audience string
+}
+
+type Service struct {
+	db     db.Querier
+	jwt    JWTConfig
+	parser *jwt.Parser
+}
+
+type userClaims struct {
+	Name string `json:"name"`
+	// pins the token to one workspace when set
+	WorkspaceID string `json:"workspace_id"`
+	jwt.RegisteredClaims
+}
+
+type ApiKeyCreationReq struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
+
+type ApiKeyRes struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedBy  string     `json:"created_by"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// Key is only ever returned once, when the key is created
+	Key string `json:"key,omitempty"`
+}
+
+func NewService(db db.Querier, config JWTConfig) *Service {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
+		jwt.WithExpirationRequired(),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+	service := Service{
+		db:     db,
+		jwt:    config,
+		parser: jwt.NewParser(options...),
+	}
+	return &service
+}
+
+func (s *Service) authenticateToken(ctx context.Context, tokenString string, workspaceID string) (Principal, error) {
+	ctx, span := tracer.Start(ctx, "auth.authenticateToken")
+	defer span.End()
+	claims := userClaims{}
+	_, err := s.parser.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return s.jwt.Secret, nil
+	})
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid token", "err", err)
+		return Principal{}, UnauthorizedError()
+	}
+	if claims.Subject == "" {
+		return Principal{}, UnauthorizedError()
+	}
+	if claims.WorkspaceID != "" {
+		if workspaceID != "" && workspaceID != claims.WorkspaceID {
+			return Principal{}, ForbiddenError()
+		}
+		workspaceID = claims.WorkspaceID
+	}
+	principal := Principal{Kind: KindUser, Subject: claims.Subject, Name: claims.Name}
+	if workspaceID == "" {
+		return principal, nil
+	}
+	if err := s.selectWorkspace(ctx, &principal, workspaceID); err != nil {
+		return Principal{}, err
+	}
+	return principal, nil
+}
+
+// selectWorkspace sets the tenant of a user's request. Users who are not
+// members may still select it, but only reach the maps shared with them.
+func (s *Service) selectWorkspace(ctx context.Context, principal *Principal, workspaceID string) error {
+	ctx, span := tracer.Start(ctx, "auth.selectWorkspace")
+	defer span.End()
+	uuid, err := uuid.Parse(workspaceID)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid workspace id", "err", err)
+		return InvalidUUIDError()
+	}
+	role, err := s.db.GetWorkspaceRole(ctx, db.GetWorkspaceRoleParams{
+		WorkspaceID: uuid,
+		Subject:     principal.String(),
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		slog.ErrorContext(ctx, "Looking up workspace role failed", "err", err)
+		return InternalServerError()
+	}
+	principal.WorkspaceID = uuid
+	principal.WorkspaceRole = role
+	return nil
+}
+
+// API keys belong to one workspace and act as its owner
+func (s *Service) authenticateApiKey(ctx context.Context, key string, workspaceID string) (Principal, error) {
+	ctx, span := tracer.Start(ctx, "auth.authenticateApiKey")
+	defer span.End()
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return Principal{}, UnauthorizedError()
+	}
+	apiKey, err := s.db.GetActiveApiKeyByHash(ctx, hashApiKey(key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		slog.DebugContext(ctx, "Unknown API key")
+		return Principal{}, UnauthorizedError()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Looking up API key failed", "err", err)
+		if problem.Unavailable(err) {
+			return Principal{}, DatabaseUnavailableError()
+		}
+		return Principal{}, InternalServerError()
+	}
+	if workspaceID != "" && workspaceID != apiKey.WorkspaceID.String() {
+		return Principal{}, ForbiddenError()
+	}
+	if !apiKey.LastUsedAt.Valid || time.Since(apiKey.LastUsedAt.Time) >= apiKeyTouchInterval {
+		if err := s.db.TouchApiKeyById(ctx, apiKey.ID); err != nil {
+			slog.WarnContext(ctx, "Touching API key failed", "err", err)
+		}
+	}
+	return Principal{
+		Kind:          KindApiKey,
+		Subject:       apiKey.ID.String(),
+		Name:          apiKey.Name,
+		WorkspaceID:   apiKey.WorkspaceID,
+		WorkspaceRole: RoleOwner,
+	}, nil
+}
+
+func (s *Service) createApiKey(ctx context.Context, req ApiKeyCreationReq, createdBy Principal) (ApiKeyRes, error) {
+	ctx, span := tracer.Start(ctx, "auth.createApiKey")
+	defer span.End()
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		slog.ErrorContext(ctx, "Generating API key failed", "err", err)
+		return ApiKeyRes{}, InternalServerError()
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	apiKey, err := s.db.CreateApiKey(ctx, db.CreateApiKeyParams{
+		Name:        req.Name,
+		Prefix:      key[:len(apiKeyPrefix)+4],
+		KeyHash:     hashApiKey(key),
+		CreatedBy:   createdBy.String(),
+		WorkspaceID: createdBy.WorkspaceID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Creating API key failed", "err", err)
+		return ApiKeyRes{}, InternalServerError()
+	}
+	res := toApiKeyRes(apiKey)
+	res.Key = key
+	return res, nil
+}
+
+func (s *Service) getApiKeys(ctx context.Context, workspaceID uuid.UUID) ([]ApiKeyRes, error) {
+	ctx, span := tracer.Start(ctx, "auth.getApiKeys")
+	defer span.End()
+	rows, err := s.db.GetApiKeys(ctx, workspaceID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing API keys failed", "err", err)
+		return []ApiKeyRes{}, InternalServerError()
+	}
+	keys := make([]ApiKeyRes, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, toApiKeyRes(row))
+	}
+	return keys, nil
+}
+
+func (s *Service) revokeApiKey(ctx context.Context, id string, workspaceID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "auth.revokeApiKey")
+	defer span.End()
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid API key id", "err", err)
+		return InvalidUUIDError()
+	}
+	count, err := s.db.RevokeApiKeyById(ctx, db.RevokeApiKeyByIdParams{
+		ID:          uuid,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Revoking API key failed", "err", err)
+		return InternalServerError()
+	}
+	if count == 0 {
+		return NotFoundError()
+	}
+	return nil
+}
+
+// only a hash of each key is stored, the key itself is shown once on creation
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func toApiKeyRes(apiKey db.ApiKey) ApiKeyRes {
+	res := ApiKeyRes{
+		ID:        apiKey.ID,
+		CreatedAt: apiKey.CreatedAt,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		CreatedBy: apiKey.CreatedBy,
+	}
+	if apiKey.LastUsedAt.Valid {
+		res.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	if apiKey.RevokedAt.Valid {
+		res.RevokedAt = &apiKey.RevokedAt.Time
+	}
+	return res
+}
@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/problem"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var testConfig = JWTConfig{
+	Secret:   []byte("secret"),
+	Issuer:   "map-editor",
+	Audience: "api",
+}
+
+// fakeQuerier answers the queries authentication makes, any other query
+// panics
+type fakeQuerier struct {
+	db.Querier
+	// role of each subject by workspace
+	roles   map[uuid.UUID]map[string]string
+	roleErr error
+	// API keys by hash
+	apiKeys   map[string]db.ApiKey
+	apiKeyErr error
+	touched   []uuid.UUID
+	created   []db.CreateApiKeyParams
+}
+
+func (q *fakeQuerier) GetWorkspaceRole(ctx context.Context, arg db.GetWorkspaceRoleParams) (string, error) {
+	if q.roleErr != nil {
+		return "", q.roleErr
+	}
+	role, ok := q.roles[arg.WorkspaceID][arg.Subject]
+	if !ok {
+		return "", pgx.ErrNoRows
+	}
+	return role, nil
+}
+
+func (q *fakeQuerier) GetActiveApiKeyByHash(ctx context.Context, keyHash string) (db.ApiKey, error) {
+	if q.apiKeyErr != nil {
+		return db.ApiKey{}, q.apiKeyErr
+	}
+	apiKey, ok := q.apiKeys[keyHash]
+	if !ok {
+		return db.ApiKey{}, pgx.ErrNoRows
+	}
+	return apiKey, nil
+}
+
+func (q *fakeQuerier) TouchApiKeyById(ctx context.Context, id uuid.UUID) error {
+	q.touched = append(q.touched, id)
+	return nil
+}
+
+func (q *fakeQuerier) CreateApiKey(ctx context.Context, arg db.CreateApiKeyParams) (db.ApiKey, error) {
+	q.created = append(q.created, arg)
+	return db.ApiKey{ID: uuid.New(), Name: arg.Name, Prefix: arg.Prefix, CreatedBy: arg.CreatedBy, WorkspaceID: arg.WorkspaceID}, nil
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return token
+}
+
+// claims of a valid token, with overrides applied and nil values removed
+func testClaims(overrides jwt.MapClaims) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub":  "42",
+		"name": "Ada",
+		"iss":  testConfig.Issuer,
+		"aud":  testConfig.Audience,
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	member := uuid.New()
+	other := uuid.New()
+	q := &fakeQuerier{roles: map[uuid.UUID]map[string]string{
+		member: {"user:42": RoleEditor},
+	}}
+	s := NewService(q, testConfig)
+	valid := signToken(t, jwt.SigningMethodHS256, testConfig.Secret, testClaims(nil))
+
+	tests := []struct {
+		name      string
+		token     string
+		workspace string
+		status    int
+		want      Principal
+	}{
+		{
+			name:  "valid",
+			token: valid,
+			want:  Principal{Kind: KindUser, Subject: "42", Name: "Ada"},
+		},
+		{
+			name:      "member of the workspace",
+			token:     valid,
+			workspace: member.String(),
+			want:      Principal{Kind: KindUser, Subject: "42", Name: "Ada", WorkspaceID: member, WorkspaceRole: RoleEditor},
+		},
+		{
+			name:      "not a member of the workspace",
+			token:     valid,
+			workspace: other.String(),
+			want:      Principal{Kind: KindUser, Subject: "42", Name: "Ada", WorkspaceID: other},
+		},
+		{
+			name:      "pinned to the workspace",
+			token:     signToken(t, jwt.SigningMethodHS256, testConfig.Secret, testClaims(jwt.MapClaims{"workspace_id": member.String()})),
+			workspace: "",
+			want:      Principal{Kind: KindUser, Subject: "42", Name: "Ada", WorkspaceID: member, WorkspaceRole: RoleEditor},
+		},
+		{
+			name:      "pinned to another workspace",
+			token:     signToken(t, jwt.SigningMethodHS256, testConfig.Secret, testClaims(jwt.MapClaims{"workspace_id": member.String()})),
+			workspace: other.String(),
+			status:    http.StatusForbidden,
+		},
+		{
+			name:      "invalid workspace id",
+			token:     valid,
+			workspace: "nope",
+			status:    http.StatusBadRequest,
+		},
+		{
+			name:   "expired",
+			token:  signToken(t, jwt.SigningMethodHS256, testConfig.Secret, testClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "without exp",
+			token:  signToken(t, jwt.SigningMethodHS256, testConfig.Secret, testClaims(jwt.MapClaims{"exp": nil})),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "without sub",
+			token:  signToken(t, jwt.SigningMethodHS256, testConfig.Secret, testClaims(jwt.MapClaims{"sub": nil})),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong issuer",
+			token:  signToken(t, jwt.SigningMethodHS256, testConfig.Secret, testClaims(jwt.MapClaims{"iss": "someone"})),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong audience",
+			token:  signToken(t, jwt.SigningMethodHS256, testConfig.Secret, testClaims(jwt.MapClaims{"aud": "other"})),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong secret",
+			token:  signToken(t, jwt.SigningMethodHS256, []byte("guess"), testClaims(nil)),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "other algorithm",
+			token:  signToken(t, jwt.SigningMethodHS384, testConfig.Secret, testClaims(nil)),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "unsigned",
+			token:  signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, testClaims(nil)),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "garbage",
+			token:  "not.a.token",
+			status: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := s.authenticateToken(context.Background(), test.token, test.workspace)
+			if test.status != 0 {
+				if problem.StatusOf(err) != test.status {
+					t.Fatalf("authenticateToken = %v, want %d", err, test.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authenticateToken: %v", err)
+			}
+			if got != test.want {
+				t.Fatalf("authenticateToken = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateTokenRoleLookupFails(t *testing.T) {
+	s := NewService(&fakeQuerier{roleErr: errors.New("boom")}, testConfig)
+	token := signToken(t, jwt.SigningMethodHS256, testConfig.Secret, testClaims(nil))
+	_, err := s.authenticateToken(context.Background(), token, uuid.NewString())
+	if problem.StatusOf(err) != http.StatusInternalServerError {
+		t.Fatalf("authenticateToken = %v, want 500", err)
+	}
+}
+
+func TestAuthenticateApiKey(t *testing.T) {
+	workspaceID := uuid.New()
+	fresh := db.ApiKey{ID: uuid.New(), Name: "ci", WorkspaceID: workspaceID, LastUsedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true}}
+	stale := db.ApiKey{ID: uuid.New(), Name: "cron", WorkspaceID: workspaceID}
+
+	tests := []struct {
+		name      string
+		key       string
+		workspace string
+		err       error
+		status    int
+		touched   bool
+	}{
+		{name: "fresh key", key: apiKeyPrefix + "fresh"},
+		{name: "key in its workspace", key: apiKeyPrefix + "fresh", workspace: workspaceID.String()},
+		{name: "key unused for a while", key: apiKeyPrefix + "stale", touched: true},
+		{name: "key of another workspace", key: apiKeyPrefix + "fresh", workspace: uuid.NewString(), status: http.StatusForbidden},
+		{name: "without the prefix", key: "fresh", status: http.StatusUnauthorized},
+		{name: "unknown or revoked", key: apiKeyPrefix + "unknown", status: http.StatusUnauthorized},
+		{name: "database unreachable", key: apiKeyPrefix + "fresh", err: &pgconn.PgError{Code: "57P03"}, status: http.StatusServiceUnavailable},
+		{name: "query failed", key: apiKeyPrefix + "fresh", err: errors.New("boom"), status: http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := &fakeQuerier{
+				apiKeys: map[string]db.ApiKey{
+					hashApiKey(apiKeyPrefix + "fresh"): fresh,
+					hashApiKey(apiKeyPrefix + "stale"): stale,
+				},
+				apiKeyErr: test.err,
+			}
+			got, err := NewService(q, testConfig).authenticateApiKey(context.Background(), test.key, test.workspace)
+			if test.status != 0 {
+				if problem.StatusOf(err) != test.status {
+					t.Fatalf("authenticateApiKey = %v, want %d", err, test.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authenticateApiKey: %v", err)
+			}
+			if got.Kind != KindApiKey || got.WorkspaceID != workspaceID || got.WorkspaceRole != RoleOwner {
+				t.Fatalf("authenticateApiKey = %+v, want an owner of its workspace", got)
+			}
+			if touched := len(q.touched) > 0; touched != test.touched {
+				t.Fatalf("last_used_at touched = %v, want %v", touched, test.touched)
+			}
+		})
+	}
+}
+
+func TestCreateApiKey(t *testing.T) {
+	q := &fakeQuerier{}
+	owner := Principal{Kind: KindUser, Subject: "42", WorkspaceID: uuid.New(), WorkspaceRole: RoleOwner}
+	res, err := NewService(q, testConfig).createApiKey(context.Background(), ApiKeyCreationReq{Name: "ci"}, owner)
+	if err != nil {
+		t.Fatalf("createApiKey: %v", err)
+	}
+	if !strings.HasPrefix(res.Key, apiKeyPrefix) {
+		t.Fatalf("key %q doesn't start with %s", res.Key, apiKeyPrefix)
+	}
+	created := q.created[0]
+	if created.KeyHash != hashApiKey(res.Key) || strings.Contains(created.KeyHash, res.Key) {
+		t.Error("the key itself is stored instead of its hash")
+	}
+	if !strings.HasPrefix(res.Key, created.Prefix) || len(created.Prefix) != len(apiKeyPrefix)+4 {
+		t.Errorf("prefix = %q, want the first characters of the key", created.Prefix)
+	}
+	if created.CreatedBy != "user:42" || created.WorkspaceID != owner.WorkspaceID {
+		t.Errorf("created by %q in %v, want user:42 in %v", created.CreatedBy, created.WorkspaceID, owner.WorkspaceID)
+	}
+
+	other, err := NewService(q, testConfig).createApiKey(context.Background(), ApiKeyCreationReq{Name: "ci"}, owner)
+	if err != nil {
+		t.Fatalf("createApiKey: %v", err)
+	}
+	if other.Key == res.Key {
+		t.Error("two keys are the same")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"example.com/echo-backend/config"
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const benchmarkUsage = `usage: backend benchmark [flags] <map id> [runs]
+
+Reads the map the way GET /map/:id used to, with three queries one after
+the other, and with the single GetMapWithAnnotations query, runs times each
+(100 by default), and prints how long each took.`
+
+// runBenchmark is the benchmark subcommand, e.g. backend benchmark <map id>
+func runBenchmark(args []string) {
+	cfg, args, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err == nil {
+		err = cfg.ValidateDatabase()
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, benchmarkUsage)
+		os.Exit(2)
+	}
+	mapID, err := uuid.Parse(args[0])
+	if err != nil {
+		log.Fatalf("Invalid map id %q", args[0])
+	}
+	runs := 100
+	if len(args) == 2 {
+		if runs, err = strconv.Atoi(args[1]); err != nil || runs < 1 {
+			log.Fatalf("Invalid number of runs %q", args[1])
+		}
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	if err := benchmarkMapFetch(ctx, pool, mapID, runs, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func benchmarkMapFetch(ctx context.Context, pool *pgxpool.Pool, mapID uuid.UUID, runs int, out io.Writer) error {
+	var workspaceID uuid.UUID
+	if err := pool.QueryRow(ctx, "SELECT workspace_id FROM map WHERE id = $1", mapID).Scan(&workspaceID); err != nil {
+		return fmt.Errorf("map %s: %w", mapID, err)
+	}
+	queries := db.New(pool)
+
+	separate := func() (int, int, error) {
+		id := pgtype.UUID{Bytes: mapID, Valid: true}
+		zones, err := queries.GetZonesByMapId(ctx, db.GetZonesByMapIdParams{MapID: id, WorkspaceID: workspaceID})
+		if err != nil {
+			return 0, 0, err
+		}
+		routes, err := queries.GetRoutesByMapId(ctx, db.GetRoutesByMapIdParams{MapID: id, WorkspaceID: workspaceID})
+		if err != nil {
+			return 0, 0, err
+		}
+		_, err = queries.GetMapById(ctx, db.GetMapByIdParams{ID: mapID, WorkspaceID: workspaceID})
+		return len(zones), len(routes), err
+	}
+	combined := func() (int, int, error) {
+		row, err := queries.GetMapWithAnnotations(ctx, db.GetMapWithAnnotationsParams{ID: mapID, WorkspaceID: workspaceID})
+		return len(row.Zones), len(row.Routes), err
+	}
+
+	paths := []struct {
+		name  string
+		fetch func() (int, int, error)
+		times []time.Duration
+	}{
+		{name: "three queries", fetch: separate},
+		{name: "GetMapWithAnnotations", fetch: combined},
+	}
+	// warm up the pool and the plan cache, then alternate so neither path
+	// profits from the other one's caching
+	for i := range paths {
+		zones, routes, err := paths[i].fetch()
+		if err != nil {
+			return fmt.Errorf("%s: %w", paths[i].name, err)
+		}
+		fmt.Fprintf(out, "%s: %d zones, %d routes\n", paths[i].name, zones, routes)
+	}
+	for run := 0; run < runs; run++ {
+		for i := range paths {
+			start := time.Now()
+			if _, _, err := paths[i].fetch(); err != nil {
+				return fmt.Errorf("%s: %w", paths[i].name, err)
+			}
+			paths[i].times = append(paths[i].times, time.Since(start))
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\tmin\tp50\tp95\tp99\tmax\t")
+	for _, path := range paths {
+		slices.Sort(path.times)
+		fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\t%v\t\n", path.name,
+			percentile(path.times, 0), percentile(path.times, 50), percentile(path.times, 95),
+			percentile(path.times, 99), percentile(path.times, 100))
+	}
+	return w.Flush()
+}
+
+// percentile of durations sorted in ascending order
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return sorted[i].Round(time.Microsecond)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/dbtest"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    int
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{95, 95 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, test := range tests {
+		if got := percentile(sorted, test.p); got != test.want {
+			t.Errorf("p%d = %v, want %v", test.p, got, test.want)
+		}
+	}
+	if got := percentile(sorted[:1], 99); got != time.Millisecond {
+		t.Errorf("p99 of one run = %v", got)
+	}
+}
+
+func TestBenchmarkMapFetch(t *testing.T) {
+	pool := dbtest.Pool(t)
+	q := db.New(pool)
+	_, workspaceID := dbtest.Workspace(t, q, "1")
+	ctx := context.Background()
+	m, err := q.CreateMap(ctx, db.CreateMapParams{Name: pgtype.Text{String: "bench", Valid: true}, CreatedAt: time.Now(), WorkspaceID: workspaceID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapID := pgtype.UUID{Bytes: m.ID, Valid: true}
+	if _, err := q.CreateZone(ctx, db.CreateZoneParams{MapID: mapID, Zone: pgtype.Polygon{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}, Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := benchmarkMapFetch(ctx, pool, m.ID, 3, &out); err != nil {
+		t.Fatalf("benchmarkMapFetch: %v", err)
+	}
+	// both paths read the same annotations
+	for _, line := range []string{"three queries: 1 zones, 0 routes", "GetMapWithAnnotations: 1 zones, 0 routes", "p95"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("output doesn't have %q:\n%s", line, &out)
+		}
+	}
+
+	if err := benchmarkMapFetch(ctx, pool, uuid.New(), 1, &out); err == nil {
+		t.Error("benchmark of a missing map succeeded")
+	}
+}
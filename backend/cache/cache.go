@@ -0,0 +1,20 @@
+package cache
+
+import "context"
+
+// Cache holds encoded values for a while. Backends log their failures and
+// report them as misses, the cache must never fail a request.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte)
+	Delete(ctx context.Context, keys ...string)
+}
+
+// None caches nothing, every Get is a miss
+type None struct{}
+
+func (None) Get(context.Context, string) ([]byte, bool) { return nil, false }
+
+func (None) Set(context.Context, string, []byte) {}
+
+func (None) Delete(context.Context, ...string) {}
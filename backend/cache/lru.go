@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory cache bounded by the bytes it holds rather than the
+// number of entries, map documents with data URL images can be megabytes
+type LRU struct {
+	mu       sync.Mutex
+	maxBytes int
+	ttl      time.Duration
+	used     int
+	// most recently used at the front
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func (e *lruEntry) size() int {
+	return len(e.key) + len(e.value)
+}
+
+func NewLRU(maxBytes int, ttl time.Duration) *LRU {
+	return &LRU{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (l *LRU) Get(_ context.Context, key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	element, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		l.remove(element)
+		return nil, false
+	}
+	l.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Set stores value as is, callers must not modify it afterwards. Values
+// larger than the whole cache are not stored.
+func (l *LRU) Set(_ context.Context, key string, value []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, ok := l.items[key]; ok {
+		l.remove(element)
+	}
+	entry := &lruEntry{key: key, value: value, expires: time.Now().Add(l.ttl)}
+	if entry.size() > l.maxBytes {
+		return
+	}
+	l.items[key] = l.order.PushFront(entry)
+	l.used += entry.size()
+	for l.used > l.maxBytes {
+		l.remove(l.order.Back())
+	}
+}
+
+func (l *LRU) Delete(_ context.Context, keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if element, ok := l.items[key]; ok {
+			l.remove(element)
+		}
+	}
+}
+
+func (l *LRU) remove(element *list.Element) {
+	entry := l.order.Remove(element).(*lruEntry)
+	delete(l.items, entry.key)
+	l.used -= entry.size()
+}
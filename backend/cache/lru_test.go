@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	// every entry below takes 1 + 9 bytes
+	l := NewLRU(30, time.Minute)
+	value := func(s string) []byte { return []byte(strings.Repeat(s, 9)) }
+
+	if _, ok := l.Get(ctx, "a"); ok {
+		t.Fatal("Get of an empty cache hit")
+	}
+	l.Set(ctx, "a", value("a"))
+	l.Set(ctx, "b", value("b"))
+	l.Set(ctx, "c", value("c"))
+	if got, ok := l.Get(ctx, "a"); !ok || string(got) != string(value("a")) {
+		t.Fatalf("Get(a) = %q, %v", got, ok)
+	}
+
+	// b is now the least recently used
+	l.Set(ctx, "d", value("d"))
+	if _, ok := l.Get(ctx, "b"); ok {
+		t.Error("b wasn't evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := l.Get(ctx, key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if l.used != 30 || l.order.Len() != 3 || len(l.items) != 3 {
+		t.Fatalf("used %d bytes in %d entries", l.used, l.order.Len())
+	}
+
+	// replacing an entry frees its old size
+	l.Set(ctx, "a", []byte("x"))
+	if l.used != 22 {
+		t.Fatalf("used %d bytes after replacing a, want 22", l.used)
+	}
+
+	l.Delete(ctx, "a", "c", "missing")
+	if _, ok := l.Get(ctx, "a"); ok || l.used != 10 {
+		t.Fatalf("used %d bytes after deleting a and c, want 10", l.used)
+	}
+}
+
+func TestLRUTooLarge(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRU(10, time.Minute)
+	l.Set(ctx, "small", []byte("x"))
+	l.Set(ctx, "large", make([]byte, 10))
+	if _, ok := l.Get(ctx, "large"); ok {
+		t.Error("a value larger than the cache was stored")
+	}
+	// and it didn't push everything else out
+	if _, ok := l.Get(ctx, "small"); !ok {
+		t.Error("storing a large value evicted the others")
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRU(100, 10*time.Millisecond)
+	l.Set(ctx, "a", []byte("1"))
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := l.Get(ctx, "a"); ok {
+		t.Fatal("expired entry was returned")
+	}
+	if l.used != 0 || len(l.items) != 0 {
+		t.Fatalf("expired entry still takes %d bytes", l.used)
+	}
+}
+
+func TestNone(t *testing.T) {
+	var c Cache = None{}
+	c.Set(context.Background(), "a", []byte("1"))
+	if _, ok := c.Get(context.Background(), "a"); ok {
+		t.Fatal("None returned a value")
+	}
+}
@@ -0,0 +1,290 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config is everything the backend can be configured with. Values come from,
+// lowest priority first: the defaults, an optional YAML file (CONFIG_FILE or
+// -config), the environment including an optional .env file, and flags.
+type Config struct {
+	Port int `yaml:"port"`
+	// port GET /metrics is served on, kept apart from the API so it can stay
+	// inside the network, zero turns it off
+	MetricsPort int `yaml:"metrics_port"`
+
+	DatabaseURL      string        `yaml:"database_url"`
+	DBMaxConns       int32         `yaml:"db_max_conns"`
+	DBMinConns       int32         `yaml:"db_min_conns"`
+	DBConnectTimeout time.Duration `yaml:"db_connect_timeout"`
+	MigrationsPath   string        `yaml:"migrations_path"`
+
+	JWTSecret   string `yaml:"jwt_secret"`
+	JWTIssuer   string `yaml:"jwt_issuer"`
+	JWTAudience string `yaml:"jwt_audience"`
+
+	// origins allowed to call the API, all of them when empty
+	CORSAllowedOrigins []string `yaml:"cors_allowed_origins"`
+	// longest image_url a map may have, data URLs included
+	MaxImageBytes int `yaml:"max_image_bytes"`
+	// largest request body, and the larger one for routes that carry map images
+	MaxBodyBytes   int `yaml:"max_body_bytes"`
+	MaxUploadBytes int `yaml:"max_upload_bytes"`
+	// where map images are hosted, checked by GET /readyz when set
+	ImageStoreURL string `yaml:"image_store_url"`
+	// requests per second and burst allowed per client IP and per API key,
+	// zero turns a limit off
+	ClientRateLimit float64 `yaml:"client_rate_limit"`
+	ClientRateBurst int     `yaml:"client_rate_burst"`
+	APIKeyRateLimit float64 `yaml:"api_key_rate_limit"`
+	APIKeyRateBurst int     `yaml:"api_key_rate_burst"`
+	// CIDRs of the proxies whose X-Forwarded-For is believed, the client IP is
+	// the connection's address when empty
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// how long deleted maps stay in the trash
+	TrashRetention time.Duration `yaml:"trash_retention"`
+
+	// zero disables a timeout, read and write timeouts would cut live
+	// WebSockets and the SSE change feed so they are off by default
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	WebhookTimeout    time.Duration `yaml:"webhook_timeout"`
+
+	// lets webhooks reach loopback and private addresses, for local development
+	WebhookAllowPrivate bool `yaml:"webhook_allow_private"`
+
+	// debug, info, warn or error
+	LogLevel string `yaml:"log_level"`
+	// text or json
+	LogFormat string `yaml:"log_format"`
+
+	// none, stdout or otlp, see the tracing package
+	TracesExporter string `yaml:"traces_exporter"`
+	// share of new traces that are recorded, between 0 and 1
+	TraceSampleRatio float64 `yaml:"trace_sample_ratio"`
+
+	// none, memory or redis
+	CacheBackend string `yaml:"cache_backend"`
+	// bytes the memory cache may hold
+	CacheMaxBytes int `yaml:"cache_max_bytes"`
+	// how long a cached map version is kept
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	RedisURL string        `yaml:"redis_url"`
+
+	// how long to keep serving after turning not ready on shutdown, so load
+	// balancers stop sending traffic first
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+	// how long in-flight requests, live clients and workers get to finish
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+func Default() Config {
+	return Config{
+		Port:              1323,
+		MetricsPort:       9090,
+		DBMaxConns:        10,
+		DBMinConns:        0,
+		DBConnectTimeout:  10 * time.Second,
+		MigrationsPath:    "db/migration",
+		MaxImageBytes:     5 << 20,
+		MaxBodyBytes:      1 << 20,
+		MaxUploadBytes:    8 << 20,
+		ClientRateLimit:   20,
+		ClientRateBurst:   40,
+		APIKeyRateLimit:   50,
+		APIKeyRateBurst:   100,
+		TrashRetention:    30 * 24 * time.Hour,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		WebhookTimeout:    10 * time.Second,
+		ShutdownTimeout:   20 * time.Second,
+		LogLevel:          "info",
+		LogFormat:         "text",
+		TracesExporter:    "none",
+		TraceSampleRatio:  1,
+		CacheBackend:      "memory",
+		CacheMaxBytes:     64 << 20,
+		CacheTTL:          5 * time.Minute,
+	}
+}
+
+// Load reads the configuration for the command line args, without the
+// program name, and returns the args left after the flags. It doesn't
+// validate, commands check the settings they need.
+func Load(args []string) (Config, []string, error) {
+	configFile := os.Getenv("CONFIG_FILE")
+	scratch := Default()
+	if err := flags(&scratch, &configFile).Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	cfg := Default()
+	if configFile != "" {
+		if err := loadFile(&cfg, configFile); err != nil {
+			return Config{}, nil, err
+		}
+	}
+	// a missing .env is fine, containers inject the environment directly
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, nil, fmt.Errorf(".env: %w", err)
+	}
+	if err := loadEnv(&cfg); err != nil {
+		return Config{}, nil, err
+	}
+	fs := flags(&cfg, &configFile)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// ValidateDatabase checks the settings needed to reach the database and run
+// migrations
+func (c Config) ValidateDatabase() error {
+	var errs []error
+	if c.DatabaseURL == "" {
+		errs = append(errs, errors.New("database URL (REMOTE_DB) must be set"))
+	}
+	if c.MigrationsPath == "" {
+		errs = append(errs, errors.New("migrations_path must be set"))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks every setting the server needs
+func (c Config) Validate() error {
+	errs := []error{c.ValidateDatabase()}
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is not between 1 and 65535", c.Port))
+	}
+	if c.MetricsPort < 0 || c.MetricsPort > 65535 {
+		errs = append(errs, fmt.Errorf("metrics_port %d is not between 0 and 65535", c.MetricsPort))
+	}
+	if c.MetricsPort == c.Port {
+		errs = append(errs, errors.New("metrics_port must differ from port"))
+	}
+	if c.DBMaxConns < 1 {
+		errs = append(errs, errors.New("db_max_conns must be at least 1"))
+	}
+	if c.DBMinConns < 0 || c.DBMinConns > c.DBMaxConns {
+		errs = append(errs, errors.New("db_min_conns must be between 0 and db_max_conns"))
+	}
+	if c.JWTSecret == "" {
+		errs = append(errs, errors.New("JWT_SECRET must be set"))
+	}
+	if c.MaxImageBytes < 1 {
+		errs = append(errs, errors.New("max_image_bytes must be at least 1"))
+	}
+	if c.MaxBodyBytes < 1 {
+		errs = append(errs, errors.New("max_body_bytes must be at least 1"))
+	}
+	if c.MaxUploadBytes < c.MaxImageBytes {
+		errs = append(errs, errors.New("max_upload_bytes must be at least max_image_bytes"))
+	}
+	for name, limit := range map[string]struct {
+		perSecond float64
+		burst     int
+	}{
+		"client_rate":  {c.ClientRateLimit, c.ClientRateBurst},
+		"api_key_rate": {c.APIKeyRateLimit, c.APIKeyRateBurst},
+	} {
+		if limit.perSecond < 0 {
+			errs = append(errs, fmt.Errorf("%s_limit must not be negative", name))
+		}
+		if limit.perSecond > 0 && limit.burst < 1 {
+			errs = append(errs, fmt.Errorf("%s_burst must be at least 1", name))
+		}
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			errs = append(errs, fmt.Errorf("trusted_proxies: %q is not a CIDR like 10.0.0.0/8", proxy))
+		}
+	}
+	if c.ImageStoreURL != "" {
+		if u, err := url.Parse(c.ImageStoreURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("image_store_url %q is not an http or https URL", c.ImageStoreURL))
+		}
+	}
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log_level %q is not debug, info, warn or error", c.LogLevel))
+	}
+	switch strings.ToLower(c.LogFormat) {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("log_format %q is not text or json", c.LogFormat))
+	}
+	switch c.TracesExporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("traces_exporter %q is not none, stdout or otlp", c.TracesExporter))
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("trace_sample_ratio %v is not between 0 and 1", c.TraceSampleRatio))
+	}
+	switch c.CacheBackend {
+	case "none", "memory":
+	case "redis":
+		if c.RedisURL == "" {
+			errs = append(errs, errors.New("REDIS_URL must be set for the redis cache backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cache_backend %q is not none, memory or redis", c.CacheBackend))
+	}
+	if c.CacheMaxBytes < 1 {
+		errs = append(errs, errors.New("cache_max_bytes must be at least 1"))
+	}
+	if c.CacheTTL <= 0 {
+		errs = append(errs, errors.New("cache_ttl must be positive"))
+	}
+	if c.TrashRetention <= 0 {
+		errs = append(errs, errors.New("trash_retention must be positive"))
+	}
+	for name, timeout := range map[string]time.Duration{
+		"db_connect_timeout":  c.DBConnectTimeout,
+		"read_header_timeout": c.ReadHeaderTimeout,
+		"read_timeout":        c.ReadTimeout,
+		"write_timeout":       c.WriteTimeout,
+		"idle_timeout":        c.IdleTimeout,
+		"webhook_timeout":     c.WebhookTimeout,
+		"shutdown_delay":      c.ShutdownDelay,
+		"shutdown_timeout":    c.ShutdownTimeout,
+	} {
+		if timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Address is what the HTTP server listens on
+func (c Config) Address() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// MetricsAddress is what the metrics server listens on
+func (c Config) MetricsAddress() string {
+	return fmt.Sprintf(":%d", c.MetricsPort)
+}
+
+// splitList splits a comma separated list, dropping blanks
+func splitList(value string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
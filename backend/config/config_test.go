@@ -0,0 +1,168 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// inTempDir runs the test from an empty directory, so no .env is picked up
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := inTempDir(t)
+	file := filepath.Join(dir, "config.yaml")
+	writeFile(t, file, "port: 2000\nmetrics_port: 2001\nlog_level: debug\ncache_ttl: 1m\n")
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("PORT", "3000")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example, ,https://b.example")
+
+	cfg, args, err := Load([]string{"-port", "4000", "migrate", "up"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != 4000 {
+		t.Errorf("port = %d, want the flag's 4000", cfg.Port)
+	}
+	if cfg.MetricsPort != 2001 || cfg.LogLevel != "debug" || cfg.CacheTTL != time.Minute {
+		t.Errorf("metrics_port, log_level, cache_ttl = %d, %s, %v, want the file's", cfg.MetricsPort, cfg.LogLevel, cfg.CacheTTL)
+	}
+	if strings.Join(cfg.CORSAllowedOrigins, " ") != "https://a.example https://b.example" {
+		t.Errorf("cors origins = %v", cfg.CORSAllowedOrigins)
+	}
+	if cfg.MaxBodyBytes != Default().MaxBodyBytes {
+		t.Errorf("max_body_bytes = %d, want the default", cfg.MaxBodyBytes)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("args = %v, want migrate up", args)
+	}
+
+	// the environment beats the file when no flag is given
+	if cfg, _, _ = Load(nil); cfg.Port != 3000 {
+		t.Errorf("port = %d, want the environment's 3000", cfg.Port)
+	}
+	// so does .env, but not a variable that is already set
+	writeFile(t, filepath.Join(dir, ".env"), "PORT=5000\nLOG_FORMAT=json\n")
+	t.Cleanup(func() { os.Unsetenv("LOG_FORMAT") })
+	if cfg, _, _ = Load(nil); cfg.Port != 3000 || cfg.LogFormat != "json" {
+		t.Errorf("port, log_format = %d, %s, want 3000, json", cfg.Port, cfg.LogFormat)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+	}{
+		{name: "unknown key in the file", file: "prot: 1\n"},
+		{name: "invalid number", env: map[string]string{"PORT": "http"}},
+		{name: "invalid duration", env: map[string]string{"CACHE_TTL": "5"}},
+		{name: "invalid bool", env: map[string]string{"WEBHOOK_ALLOW_PRIVATE": "sometimes"}},
+		{name: "unknown flag", args: []string{"-prot", "1"}},
+		{name: "missing file", env: map[string]string{"CONFIG_FILE": "missing.yaml"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := inTempDir(t)
+			if test.file != "" {
+				file := filepath.Join(dir, "config.yaml")
+				writeFile(t, file, test.file)
+				t.Setenv("CONFIG_FILE", file)
+			}
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			if _, _, err := Load(test.args); err == nil {
+				t.Fatal("Load succeeded")
+			}
+		})
+	}
+}
+
+func validConfig() Config {
+	cfg := Default()
+	cfg.DatabaseURL = "postgres://localhost/maps"
+	cfg.JWTSecret = "secret"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("Validate of a valid config: %v", err)
+	}
+	if err := Default().ValidateDatabase(); err == nil || !strings.Contains(err.Error(), "REMOTE_DB") {
+		t.Fatalf("ValidateDatabase without a database = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"port", func(c *Config) { c.Port = 70000 }, "port 70000"},
+		{"same ports", func(c *Config) { c.MetricsPort = c.Port }, "metrics_port must differ"},
+		{"pool", func(c *Config) { c.DBMinConns = c.DBMaxConns + 1 }, "db_min_conns"},
+		{"secret", func(c *Config) { c.JWTSecret = "" }, "JWT_SECRET"},
+		{"upload limit", func(c *Config) { c.MaxUploadBytes = c.MaxImageBytes - 1 }, "max_upload_bytes"},
+		{"burst", func(c *Config) { c.ClientRateBurst = 0 }, "client_rate_burst"},
+		{"negative rate", func(c *Config) { c.APIKeyRateLimit = -1 }, "api_key_rate_limit"},
+		{"proxy", func(c *Config) { c.TrustedProxies = []string{"10.0.0.1"} }, "trusted_proxies"},
+		{"image store", func(c *Config) { c.ImageStoreURL = "s3://bucket" }, "image_store_url"},
+		{"log level", func(c *Config) { c.LogLevel = "trace" }, "log_level"},
+		{"log format", func(c *Config) { c.LogFormat = "xml" }, "log_format"},
+		{"exporter", func(c *Config) { c.TracesExporter = "jaeger" }, "traces_exporter"},
+		{"sample ratio", func(c *Config) { c.TraceSampleRatio = 2 }, "trace_sample_ratio"},
+		{"redis without a URL", func(c *Config) { c.CacheBackend = "redis" }, "REDIS_URL"},
+		{"cache backend", func(c *Config) { c.CacheBackend = "disk" }, "cache_backend"},
+		{"trash", func(c *Config) { c.TrashRetention = 0 }, "trash_retention"},
+		{"timeout", func(c *Config) { c.ShutdownTimeout = -time.Second }, "shutdown_timeout"},
+	}
+	for _, test := range tests {
+		cfg := validConfig()
+		test.change(&cfg)
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Validate with a bad %s = %v, want it to mention %s", test.name, err, test.want)
+		}
+	}
+
+	// every problem is reported at once
+	cfg := validConfig()
+	cfg.Port = 0
+	cfg.LogLevel = "loud"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "port 0") || !strings.Contains(err.Error(), "log_level") {
+		t.Errorf("Validate = %v, want both problems", err)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	if got := splitList(""); got == nil || len(got) != 0 {
+		t.Errorf("splitList(\"\") = %#v, want an empty list", got)
+	}
+	if got := splitList(" a ,b,, c"); strings.Join(got, "|") != "a|b|c" {
+		t.Errorf("splitList = %v, want a, b and c", got)
+	}
+}
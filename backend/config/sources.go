@@ -0,0 +1,191 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func loadFile(cfg *Config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := yaml.NewDecoder(file)
+	// a typo in a key should not silently fall back to the default
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func loadEnv(cfg *Config) error {
+	texts := map[string]*string{
+		"REMOTE_DB":       &cfg.DatabaseURL,
+		"MIGRATIONS_PATH": &cfg.MigrationsPath,
+		"JWT_SECRET":      &cfg.JWTSecret,
+		"JWT_ISSUER":      &cfg.JWTIssuer,
+		"JWT_AUDIENCE":    &cfg.JWTAudience,
+		"IMAGE_STORE_URL": &cfg.ImageStoreURL,
+		"LOG_LEVEL":       &cfg.LogLevel,
+		"LOG_FORMAT":      &cfg.LogFormat,
+		"TRACES_EXPORTER": &cfg.TracesExporter,
+		"CACHE_BACKEND":   &cfg.CacheBackend,
+		"REDIS_URL":       &cfg.RedisURL,
+	}
+	for key, field := range texts {
+		if value, ok := os.LookupEnv(key); ok {
+			*field = value
+		}
+	}
+	if value, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		cfg.CORSAllowedOrigins = splitList(value)
+	}
+	if value, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		cfg.TrustedProxies = splitList(value)
+	}
+
+	ints := map[string]*int{
+		"PORT":               &cfg.Port,
+		"METRICS_PORT":       &cfg.MetricsPort,
+		"MAX_IMAGE_BYTES":    &cfg.MaxImageBytes,
+		"MAX_BODY_BYTES":     &cfg.MaxBodyBytes,
+		"MAX_UPLOAD_BYTES":   &cfg.MaxUploadBytes,
+		"CLIENT_RATE_BURST":  &cfg.ClientRateBurst,
+		"API_KEY_RATE_BURST": &cfg.APIKeyRateBurst,
+		"CACHE_MAX_BYTES":    &cfg.CacheMaxBytes,
+	}
+	for key, field := range ints {
+		if value, ok := os.LookupEnv(key); ok {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", key, value)
+			}
+			*field = number
+		}
+	}
+	int32s := map[string]*int32{
+		"DB_MAX_CONNS": &cfg.DBMaxConns,
+		"DB_MIN_CONNS": &cfg.DBMinConns,
+	}
+	for key, field := range int32s {
+		if value, ok := os.LookupEnv(key); ok {
+			number, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", key, value)
+			}
+			*field = int32(number)
+		}
+	}
+	if value, ok := os.LookupEnv("WEBHOOK_ALLOW_PRIVATE"); ok {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("WEBHOOK_ALLOW_PRIVATE: %q is not true or false", value)
+		}
+		cfg.WebhookAllowPrivate = allow
+	}
+	floats := map[string]*float64{
+		"TRACE_SAMPLE_RATIO": &cfg.TraceSampleRatio,
+		"CLIENT_RATE_LIMIT":  &cfg.ClientRateLimit,
+		"API_KEY_RATE_LIMIT": &cfg.APIKeyRateLimit,
+	}
+	for key, field := range floats {
+		if value, ok := os.LookupEnv(key); ok {
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a number", key, value)
+			}
+			*field = number
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"DB_CONNECT_TIMEOUT":  &cfg.DBConnectTimeout,
+		"TRASH_RETENTION":     &cfg.TrashRetention,
+		"CACHE_TTL":           &cfg.CacheTTL,
+		"READ_HEADER_TIMEOUT": &cfg.ReadHeaderTimeout,
+		"READ_TIMEOUT":        &cfg.ReadTimeout,
+		"WRITE_TIMEOUT":       &cfg.WriteTimeout,
+		"IDLE_TIMEOUT":        &cfg.IdleTimeout,
+		"WEBHOOK_TIMEOUT":     &cfg.WebhookTimeout,
+		"SHUTDOWN_DELAY":      &cfg.ShutdownDelay,
+		"SHUTDOWN_TIMEOUT":    &cfg.ShutdownTimeout,
+	}
+	for key, field := range durations {
+		if value, ok := os.LookupEnv(key); ok {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a duration like 30s or 720h", key, value)
+			}
+			*field = duration
+		}
+	}
+	return nil
+}
+
+// flags binds a flag to every setting, defaulting to what cfg already holds
+// so only the flags given on the command line change anything
+func flags(cfg *Config, configFile *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("backend", flag.ContinueOnError)
+	fs.StringVar(configFile, "config", *configFile, "YAML config file")
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "HTTP port")
+	fs.IntVar(&cfg.MetricsPort, "metrics-port", cfg.MetricsPort, "port of the metrics server, 0 turns it off")
+	fs.StringVar(&cfg.DatabaseURL, "db", cfg.DatabaseURL, "Postgres connection string")
+	fs.Func("db-max-conns", "largest number of pooled connections", int32Flag(&cfg.DBMaxConns))
+	fs.Func("db-min-conns", "number of pooled connections kept open", int32Flag(&cfg.DBMinConns))
+	fs.DurationVar(&cfg.DBConnectTimeout, "db-connect-timeout", cfg.DBConnectTimeout, "timeout for opening a database connection")
+	fs.StringVar(&cfg.MigrationsPath, "migrations", cfg.MigrationsPath, "directory of the SQL migrations")
+	fs.StringVar(&cfg.JWTIssuer, "jwt-issuer", cfg.JWTIssuer, "required iss claim of JWTs")
+	fs.StringVar(&cfg.JWTAudience, "jwt-audience", cfg.JWTAudience, "required aud claim of JWTs")
+	fs.Func("cors-origins", "comma separated origins allowed to call the API", func(value string) error {
+		cfg.CORSAllowedOrigins = splitList(value)
+		return nil
+	})
+	fs.IntVar(&cfg.MaxImageBytes, "max-image-bytes", cfg.MaxImageBytes, "longest image_url a map may have")
+	fs.IntVar(&cfg.MaxBodyBytes, "max-body-bytes", cfg.MaxBodyBytes, "largest request body")
+	fs.IntVar(&cfg.MaxUploadBytes, "max-upload-bytes", cfg.MaxUploadBytes, "largest request body of routes that carry map images")
+	fs.Float64Var(&cfg.ClientRateLimit, "client-rate-limit", cfg.ClientRateLimit, "requests per second allowed per client IP, 0 for no limit")
+	fs.IntVar(&cfg.ClientRateBurst, "client-rate-burst", cfg.ClientRateBurst, "requests a client IP may send at once")
+	fs.Float64Var(&cfg.APIKeyRateLimit, "api-key-rate-limit", cfg.APIKeyRateLimit, "requests per second allowed per API key, 0 for no limit")
+	fs.IntVar(&cfg.APIKeyRateBurst, "api-key-rate-burst", cfg.APIKeyRateBurst, "requests an API key may send at once")
+	fs.Func("trusted-proxies", "comma separated CIDRs of proxies whose X-Forwarded-For is believed", func(value string) error {
+		cfg.TrustedProxies = splitList(value)
+		return nil
+	})
+	fs.StringVar(&cfg.ImageStoreURL, "image-store-url", cfg.ImageStoreURL, "where map images are hosted, checked for readiness")
+	fs.DurationVar(&cfg.TrashRetention, "trash-retention", cfg.TrashRetention, "how long deleted maps stay in the trash")
+	fs.DurationVar(&cfg.ReadHeaderTimeout, "read-header-timeout", cfg.ReadHeaderTimeout, "timeout for reading request headers")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout, "timeout for reading whole requests")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "timeout for writing responses")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "how long idle keep-alive connections stay open")
+	fs.DurationVar(&cfg.WebhookTimeout, "webhook-timeout", cfg.WebhookTimeout, "timeout for delivering a webhook")
+	fs.BoolVar(&cfg.WebhookAllowPrivate, "webhook-allow-private", cfg.WebhookAllowPrivate, "let webhooks reach loopback and private addresses")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "text or json")
+	fs.StringVar(&cfg.TracesExporter, "traces-exporter", cfg.TracesExporter, "none, stdout or otlp")
+	fs.Float64Var(&cfg.TraceSampleRatio, "trace-sample-ratio", cfg.TraceSampleRatio, "share of new traces that are recorded")
+	fs.StringVar(&cfg.CacheBackend, "cache-backend", cfg.CacheBackend, "none, memory or redis")
+	fs.IntVar(&cfg.CacheMaxBytes, "cache-max-bytes", cfg.CacheMaxBytes, "bytes the memory cache may hold")
+	fs.DurationVar(&cfg.CacheTTL, "cache-ttl", cfg.CacheTTL, "how long a cached map version is kept")
+	fs.StringVar(&cfg.RedisURL, "redis-url", cfg.RedisURL, "Redis connection string for the redis cache backend")
+	fs.DurationVar(&cfg.ShutdownDelay, "shutdown-delay", cfg.ShutdownDelay, "how long to keep serving after turning not ready")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "how long requests and workers get to finish on shutdown")
+	return fs
+}
+
+func int32Flag(field *int32) func(string) error {
+	return func(value string) error {
+		number, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		*field = int32(number)
+		return nil
+	}
+}
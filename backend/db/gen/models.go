@@ -11,11 +11,41 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ApiKey struct {
+	ID          uuid.UUID          `json:"id"`
+	CreatedAt   time.Time          `json:"created_at"`
+	Name        string             `json:"name"`
+	Prefix      string             `json:"prefix"`
+	KeyHash     string             `json:"key_hash"`
+	CreatedBy   string             `json:"created_by"`
+	LastUsedAt  pgtype.Timestamptz `json:"last_used_at"`
+	RevokedAt   pgtype.Timestamptz `json:"revoked_at"`
+	WorkspaceID uuid.UUID          `json:"workspace_id"`
+}
+
+type AuditLog struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Actor       string      `json:"actor"`
+	RequestID   pgtype.Text `json:"request_id"`
+	Action      string      `json:"action"`
+	EntityType  string      `json:"entity_type"`
+	EntityID    uuid.UUID   `json:"entity_id"`
+	MapID       pgtype.UUID `json:"map_id"`
+	Before      []byte      `json:"before"`
+	After       []byte      `json:"after"`
+	WorkspaceID uuid.UUID   `json:"workspace_id"`
+}
+
 type Map struct {
-	ID        uuid.UUID   `json:"id"`
-	CreatedAt time.Time   `json:"created_at"`
-	Name      pgtype.Text `json:"name"`
-	ImageUrl  pgtype.Text `json:"image_url"`
+	ID          uuid.UUID          `json:"id"`
+	CreatedAt   time.Time          `json:"created_at"`
+	Name        pgtype.Text        `json:"name"`
+	ImageUrl    pgtype.Text        `json:"image_url"`
+	Version     int32              `json:"version"`
+	IsLatest    pgtype.Bool        `json:"is_latest"`
+	DeletedAt   pgtype.Timestamptz `json:"deleted_at"`
+	WorkspaceID uuid.UUID          `json:"workspace_id"`
 }
 
 type MapAnnotationsRoute struct {
@@ -29,3 +59,75 @@ type MapAnnotationsZone struct {
 	Zone  pgtype.Polygon `json:"zone"`
 	MapID pgtype.UUID    `json:"map_id"`
 }
+
+type MapEvent struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	MapID       uuid.UUID `json:"map_id"`
+	Type        string    `json:"type"`
+	EntityID    uuid.UUID `json:"entity_id"`
+	Data        []byte    `json:"data"`
+	TxID        int64     `json:"tx_id"`
+}
+
+type MapRole struct {
+	MapID     uuid.UUID `json:"map_id"`
+	Subject   string    `json:"subject"`
+	Role      string    `json:"role"`
+	GrantedBy string    `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MapShareLink struct {
+	ID          uuid.UUID          `json:"id"`
+	MapID       uuid.UUID          `json:"map_id"`
+	WorkspaceID uuid.UUID          `json:"workspace_id"`
+	TokenHash   string             `json:"token_hash"`
+	CreatedBy   string             `json:"created_by"`
+	CreatedAt   time.Time          `json:"created_at"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+	RevokedAt   pgtype.Timestamptz `json:"revoked_at"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID          `json:"id"`
+	SubscriptionID uuid.UUID          `json:"subscription_id"`
+	EventID        int64              `json:"event_id"`
+	Status         string             `json:"status"`
+	Attempts       int32              `json:"attempts"`
+	NextAttemptAt  time.Time          `json:"next_attempt_at"`
+	LastAttemptAt  pgtype.Timestamptz `json:"last_attempt_at"`
+	ResponseStatus pgtype.Int4        `json:"response_status"`
+	LastError      pgtype.Text        `json:"last_error"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+type WebhookDispatchState struct {
+	ID          int32 `json:"id"`
+	LastEventID int64 `json:"last_event_id"`
+}
+
+type WebhookSubscription struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	Url         string    `json:"url"`
+	EventTypes  []string  `json:"event_types"`
+	Secret      string    `json:"secret"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Workspace struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+}
+
+type WorkspaceMember struct {
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	Subject     string    `json:"subject"`
+	Role        string    `json:"role"`
+	GrantedBy   string    `json:"granted_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -12,19 +12,86 @@ import (
 )
 
 type Querier interface {
+	BumpMapVersion(ctx context.Context, arg BumpMapVersionParams) (int32, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int32) ([]ClaimWebhookDeliveriesRow, error)
+	CountTotals(ctx context.Context) (CountTotalsRow, error)
+	CreateApiKey(ctx context.Context, arg CreateApiKeyParams) (ApiKey, error)
+	CreateAuditEntry(ctx context.Context, arg CreateAuditEntryParams) (AuditLog, error)
 	CreateMap(ctx context.Context, arg CreateMapParams) (Map, error)
+	CreateMapEvent(ctx context.Context, arg CreateMapEventParams) error
 	CreateRoute(ctx context.Context, arg CreateRouteParams) (MapAnnotationsRoute, error)
+	CreateShareLink(ctx context.Context, arg CreateShareLinkParams) (MapShareLink, error)
+	CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (WebhookSubscription, error)
+	CreateWorkspace(ctx context.Context, name string) (Workspace, error)
 	CreateZone(ctx context.Context, arg CreateZoneParams) (MapAnnotationsZone, error)
-	DeleteMapById(ctx context.Context, id uuid.UUID) error
-	GetMapById(ctx context.Context, id uuid.UUID) (Map, error)
-	GetMaps(ctx context.Context) ([]Map, error)
-	GetPaths(ctx context.Context) ([]MapAnnotationsRoute, error)
-	GetRouteById(ctx context.Context, id uuid.UUID) (pgtype.Path, error)
-	GetRoutesByMapId(ctx context.Context, mapID pgtype.UUID) ([]pgtype.Path, error)
-	GetZoneById(ctx context.Context, id uuid.UUID) (pgtype.Polygon, error)
-	GetZones(ctx context.Context) ([]MapAnnotationsZone, error)
-	GetZonesByMapId(ctx context.Context, mapID pgtype.UUID) ([]pgtype.Polygon, error)
-	UpdateMapById(ctx context.Context, arg UpdateMapByIdParams) error
+	DeleteMapById(ctx context.Context, arg DeleteMapByIdParams) error
+	DeleteRoute(ctx context.Context, arg DeleteRouteParams) (MapAnnotationsRoute, error)
+	DeleteRoutesByMapId(ctx context.Context, mapID pgtype.UUID) ([]uuid.UUID, error)
+	DeleteWebhookSubscription(ctx context.Context, arg DeleteWebhookSubscriptionParams) (int64, error)
+	DeleteZone(ctx context.Context, arg DeleteZoneParams) (MapAnnotationsZone, error)
+	DeleteZonesByMapId(ctx context.Context, mapID pgtype.UUID) ([]uuid.UUID, error)
+	EnqueueWebhookDeliveries(ctx context.Context) error
+	GetActiveApiKeyByHash(ctx context.Context, keyHash string) (ApiKey, error)
+	GetApiKeys(ctx context.Context, workspaceID uuid.UUID) ([]ApiKey, error)
+	GetAuditEntries(ctx context.Context, arg GetAuditEntriesParams) ([]AuditLog, error)
+	GetAuditEntriesByMapId(ctx context.Context, arg GetAuditEntriesByMapIdParams) ([]AuditLog, error)
+	GetLatestMapEventId(ctx context.Context, workspaceID uuid.UUID) (int64, error)
+	GetMapById(ctx context.Context, arg GetMapByIdParams) (Map, error)
+	GetMapEventsSince(ctx context.Context, arg GetMapEventsSinceParams) ([]MapEvent, error)
+	GetMapRole(ctx context.Context, arg GetMapRoleParams) (string, error)
+	GetMapRolesByMapId(ctx context.Context, mapID uuid.UUID) ([]MapRole, error)
+	GetMapVersion(ctx context.Context, arg GetMapVersionParams) (int32, error)
+	GetMapWithAnnotations(ctx context.Context, arg GetMapWithAnnotationsParams) (GetMapWithAnnotationsRow, error)
+	GetMaps(ctx context.Context, workspaceID uuid.UUID) ([]Map, error)
+	GetMapsByIds(ctx context.Context, arg GetMapsByIdsParams) ([]Map, error)
+	GetMapsBySubject(ctx context.Context, arg GetMapsBySubjectParams) ([]Map, error)
+	GetPaths(ctx context.Context, workspaceID uuid.UUID) ([]MapAnnotationsRoute, error)
+	GetRouteAnnotationsByMapId(ctx context.Context, mapID pgtype.UUID) ([]MapAnnotationsRoute, error)
+	GetRouteById(ctx context.Context, arg GetRouteByIdParams) (pgtype.Path, error)
+	GetRoutesByIds(ctx context.Context, arg GetRoutesByIdsParams) ([]MapAnnotationsRoute, error)
+	GetRoutesByMapId(ctx context.Context, arg GetRoutesByMapIdParams) ([]pgtype.Path, error)
+	GetRoutesByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]MapAnnotationsRoute, error)
+	GetShareLinksByMapId(ctx context.Context, arg GetShareLinksByMapIdParams) ([]MapShareLink, error)
+	GetSharedMapByTokenHash(ctx context.Context, tokenHash string) (Map, error)
+	GetTrashedMaps(ctx context.Context, workspaceID uuid.UUID) ([]Map, error)
+	GetTrashedMapsByOwner(ctx context.Context, arg GetTrashedMapsByOwnerParams) ([]Map, error)
+	GetWebhookDeliveries(ctx context.Context, arg GetWebhookDeliveriesParams) ([]GetWebhookDeliveriesRow, error)
+	GetWebhookSubscriptionById(ctx context.Context, arg GetWebhookSubscriptionByIdParams) (WebhookSubscription, error)
+	GetWebhookSubscriptions(ctx context.Context, workspaceID uuid.UUID) ([]WebhookSubscription, error)
+	GetWorkspaceMembers(ctx context.Context, workspaceID uuid.UUID) ([]WorkspaceMember, error)
+	GetWorkspaceRole(ctx context.Context, arg GetWorkspaceRoleParams) (string, error)
+	GetWorkspacesBySubject(ctx context.Context, subject string) ([]GetWorkspacesBySubjectRow, error)
+	GetZoneAnnotationsByMapId(ctx context.Context, mapID pgtype.UUID) ([]MapAnnotationsZone, error)
+	GetZoneById(ctx context.Context, arg GetZoneByIdParams) (pgtype.Polygon, error)
+	GetZones(ctx context.Context, workspaceID uuid.UUID) ([]MapAnnotationsZone, error)
+	GetZonesByIds(ctx context.Context, arg GetZonesByIdsParams) ([]MapAnnotationsZone, error)
+	GetZonesByMapId(ctx context.Context, arg GetZonesByMapIdParams) ([]pgtype.Polygon, error)
+	GetZonesByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]MapAnnotationsZone, error)
+	GrantMapRole(ctx context.Context, arg GrantMapRoleParams) (MapRole, error)
+	GrantWorkspaceRole(ctx context.Context, arg GrantWorkspaceRoleParams) (WorkspaceMember, error)
+	// locks the owners of a map until the transaction ends, so two changes can't
+	// each leave the other as the last owner
+	LockMapOwners(ctx context.Context, mapID uuid.UUID) ([]string, error)
+	// locks the map row until the transaction ends, every change to a map or its
+	// zones and routes bumps the version so they can't change either
+	LockMapVersion(ctx context.Context, arg LockMapVersionParams) (int32, error)
+	// see LockMapOwners
+	LockWorkspaceOwners(ctx context.Context, workspaceID uuid.UUID) ([]string, error)
+	MapEventExistsInWorkspace(ctx context.Context, arg MapEventExistsInWorkspaceParams) (bool, error)
+	MapExistsInWorkspace(ctx context.Context, arg MapExistsInWorkspaceParams) (bool, error)
+	PurgeDeletedMaps(ctx context.Context, deletedAt pgtype.Timestamptz) ([]PurgeDeletedMapsRow, error)
+	RecordWebhookAttempt(ctx context.Context, arg RecordWebhookAttemptParams) error
+	RedeliverWebhookDelivery(ctx context.Context, arg RedeliverWebhookDeliveryParams) (int64, error)
+	RestoreMapById(ctx context.Context, arg RestoreMapByIdParams) (int64, error)
+	RevokeApiKeyById(ctx context.Context, arg RevokeApiKeyByIdParams) (int64, error)
+	RevokeMapRole(ctx context.Context, arg RevokeMapRoleParams) (int64, error)
+	RevokeShareLink(ctx context.Context, arg RevokeShareLinkParams) (int64, error)
+	RevokeWorkspaceRole(ctx context.Context, arg RevokeWorkspaceRoleParams) (int64, error)
+	SoftDeleteMapById(ctx context.Context, arg SoftDeleteMapByIdParams) (int64, error)
+	TouchApiKeyById(ctx context.Context, id uuid.UUID) error
+	UpdateMapById(ctx context.Context, arg UpdateMapByIdParams) (int32, error)
+	UpdateRoute(ctx context.Context, arg UpdateRouteParams) (MapAnnotationsRoute, error)
+	UpdateZone(ctx context.Context, arg UpdateZoneParams) (MapAnnotationsZone, error)
 	UpdateZoneById(ctx context.Context, arg UpdateZoneByIdParams) error
 }
 
@@ -13,31 +13,287 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const bumpMapVersion = `-- name: BumpMapVersion :one
+UPDATE
+    map
+SET
+    version = version + 1
+WHERE
+    id = $1
+    AND workspace_id = $2
+    AND deleted_at IS NULL
+    AND ($3::int IS NULL OR version = $3) RETURNING version
+`
+
+type BumpMapVersionParams struct {
+	ID              uuid.UUID   `json:"id"`
+	WorkspaceID     uuid.UUID   `json:"workspace_id"`
+	ExpectedVersion pgtype.Int4 `json:"expected_version"`
+}
+
+func (q *Queries) BumpMapVersion(ctx context.Context, arg BumpMapVersionParams) (int32, error) {
+	row := q.db.QueryRow(ctx,
+		bumpMapVersion,
+		arg.ID,
+		arg.WorkspaceID,
+		arg.ExpectedVersion,
+	)
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+UPDATE
+    webhook_deliveries
+SET
+    next_attempt_at = NOW() + INTERVAL '5 minutes'
+FROM
+    webhook_subscriptions,
+    map_events
+WHERE
+    webhook_deliveries.id IN (
+        SELECT
+            id
+        FROM
+            webhook_deliveries
+        WHERE
+            status = 'pending' AND next_attempt_at <= NOW()
+        ORDER BY
+            next_attempt_at
+        LIMIT
+            $1 FOR
+        UPDATE
+            SKIP LOCKED
+    )
+    AND webhook_subscriptions.id = webhook_deliveries.subscription_id
+    AND map_events.id = webhook_deliveries.event_id RETURNING webhook_deliveries.id,
+    webhook_deliveries.attempts,
+    webhook_subscriptions.url,
+    webhook_subscriptions.secret,
+    map_events.id AS event_id,
+    map_events.type,
+    map_events.created_at,
+    map_events.map_id,
+    map_events.entity_id,
+    map_events.data
+`
+
+type ClaimWebhookDeliveriesRow struct {
+	ID        uuid.UUID `json:"id"`
+	Attempts  int32     `json:"attempts"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	EventID   int64     `json:"event_id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	MapID     uuid.UUID `json:"map_id"`
+	EntityID  uuid.UUID `json:"entity_id"`
+	Data      []byte    `json:"data"`
+}
+
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, limit int32) ([]ClaimWebhookDeliveriesRow, error) {
+	rows, err := q.db.Query(ctx, claimWebhookDeliveries, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimWebhookDeliveriesRow
+	for rows.Next() {
+		var i ClaimWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Attempts,
+			&i.Url,
+			&i.Secret,
+			&i.EventID,
+			&i.Type,
+			&i.CreatedAt,
+			&i.MapID,
+			&i.EntityID,
+			&i.Data,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countTotals = `-- name: CountTotals :one
+SELECT
+    (SELECT COUNT(*) FROM map WHERE map.deleted_at IS NULL) AS maps,
+    (SELECT COUNT(*) FROM map_annotations_zones JOIN map ON map.id = map_annotations_zones.map_id WHERE map.deleted_at IS NULL) AS zones,
+    (SELECT COUNT(*) FROM map_annotations_routes JOIN map ON map.id = map_annotations_routes.map_id WHERE map.deleted_at IS NULL) AS routes
+`
+
+type CountTotalsRow struct {
+	Maps   int64 `json:"maps"`
+	Zones  int64 `json:"zones"`
+	Routes int64 `json:"routes"`
+}
+
+func (q *Queries) CountTotals(ctx context.Context) (CountTotalsRow, error) {
+	row := q.db.QueryRow(ctx, countTotals)
+	var i CountTotalsRow
+	err := row.Scan(&i.Maps, &i.Zones, &i.Routes)
+	return i, err
+}
+
+const createApiKey = `-- name: CreateApiKey :one
+INSERT INTO
+    api_keys (name, prefix, key_hash, created_by, workspace_id)
+VALUES
+    ($1, $2, $3, $4, $5) RETURNING id, created_at, name, prefix, key_hash, created_by, last_used_at, revoked_at, workspace_id
+`
+
+type CreateApiKeyParams struct {
+	Name        string    `json:"name"`
+	Prefix      string    `json:"prefix"`
+	KeyHash     string    `json:"key_hash"`
+	CreatedBy   string    `json:"created_by"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) CreateApiKey(ctx context.Context, arg CreateApiKeyParams) (ApiKey, error) {
+	row := q.db.QueryRow(ctx,
+		createApiKey,
+		arg.Name,
+		arg.Prefix,
+		arg.KeyHash,
+		arg.CreatedBy,
+		arg.WorkspaceID,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.CreatedBy,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const createAuditEntry = `-- name: CreateAuditEntry :one
+INSERT INTO
+    audit_log (actor, request_id, action, entity_type, entity_id, map_id, before, after, workspace_id)
+VALUES
+    ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at, actor, request_id, action, entity_type, entity_id, map_id, before, after, workspace_id
+`
+
+type CreateAuditEntryParams struct {
+	Actor       string      `json:"actor"`
+	RequestID   pgtype.Text `json:"request_id"`
+	Action      string      `json:"action"`
+	EntityType  string      `json:"entity_type"`
+	EntityID    uuid.UUID   `json:"entity_id"`
+	MapID       pgtype.UUID `json:"map_id"`
+	Before      []byte      `json:"before"`
+	After       []byte      `json:"after"`
+	WorkspaceID uuid.UUID   `json:"workspace_id"`
+}
+
+func (q *Queries) CreateAuditEntry(ctx context.Context, arg CreateAuditEntryParams) (AuditLog, error) {
+	row := q.db.QueryRow(ctx,
+		createAuditEntry,
+		arg.Actor,
+		arg.RequestID,
+		arg.Action,
+		arg.EntityType,
+		arg.EntityID,
+		arg.MapID,
+		arg.Before,
+		arg.After,
+		arg.WorkspaceID,
+	)
+	var i AuditLog
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Actor,
+		&i.RequestID,
+		&i.Action,
+		&i.EntityType,
+		&i.EntityID,
+		&i.MapID,
+		&i.Before,
+		&i.After,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
 const createMap = `-- name: CreateMap :one
 INSERT INTO
-    map (name, image_url, created_at)
+    map (name, image_url, created_at, workspace_id)
 VALUES
-    ($1, $2, $3) RETURNING id, created_at, name, image_url
+    ($1, $2, $3, $4) RETURNING id, created_at, name, image_url, version, is_latest, deleted_at, workspace_id
 `
 
 type CreateMapParams struct {
-	Name      pgtype.Text `json:"name"`
-	ImageUrl  pgtype.Text `json:"image_url"`
-	CreatedAt time.Time   `json:"created_at"`
+	Name        pgtype.Text `json:"name"`
+	ImageUrl    pgtype.Text `json:"image_url"`
+	CreatedAt   time.Time   `json:"created_at"`
+	WorkspaceID uuid.UUID   `json:"workspace_id"`
 }
 
 func (q *Queries) CreateMap(ctx context.Context, arg CreateMapParams) (Map, error) {
-	row := q.db.QueryRow(ctx, createMap, arg.Name, arg.ImageUrl, arg.CreatedAt)
+	row := q.db.QueryRow(ctx,
+		createMap,
+		arg.Name,
+		arg.ImageUrl,
+		arg.CreatedAt,
+		arg.WorkspaceID,
+	)
 	var i Map
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.Name,
 		&i.ImageUrl,
+		&i.Version,
+		&i.IsLatest,
+		&i.DeletedAt,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
 
+const createMapEvent = `-- name: CreateMapEvent :exec
+INSERT INTO
+    map_events (workspace_id, map_id, type, entity_id, data)
+VALUES
+    ($1, $2, $3, $4, $5)
+`
+
+type CreateMapEventParams struct {
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	MapID       uuid.UUID `json:"map_id"`
+	Type        string    `json:"type"`
+	EntityID    uuid.UUID `json:"entity_id"`
+	Data        []byte    `json:"data"`
+}
+
+func (q *Queries) CreateMapEvent(ctx context.Context, arg CreateMapEventParams) error {
+	_, err := q.db.Exec(ctx,
+		createMapEvent,
+		arg.WorkspaceID,
+		arg.MapID,
+		arg.Type,
+		arg.EntityID,
+		arg.Data,
+	)
+	return err
+}
+
 const createRoute = `-- name: CreateRoute :one
 INSERT INTO
     map_annotations_routes (route, map_id)
@@ -57,6 +313,95 @@ func (q *Queries) CreateRoute(ctx context.Context, arg CreateRouteParams) (MapAn
 	return i, err
 }
 
+const createShareLink = `-- name: CreateShareLink :one
+INSERT INTO
+    map_share_links (map_id, workspace_id, token_hash, created_by, expires_at)
+VALUES
+    ($1, $2, $3, $4, $5) RETURNING id, map_id, workspace_id, token_hash, created_by, created_at, expires_at, revoked_at
+`
+
+type CreateShareLinkParams struct {
+	MapID       uuid.UUID          `json:"map_id"`
+	WorkspaceID uuid.UUID          `json:"workspace_id"`
+	TokenHash   string             `json:"token_hash"`
+	CreatedBy   string             `json:"created_by"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateShareLink(ctx context.Context, arg CreateShareLinkParams) (MapShareLink, error) {
+	row := q.db.QueryRow(ctx,
+		createShareLink,
+		arg.MapID,
+		arg.WorkspaceID,
+		arg.TokenHash,
+		arg.CreatedBy,
+		arg.ExpiresAt,
+	)
+	var i MapShareLink
+	err := row.Scan(
+		&i.ID,
+		&i.MapID,
+		&i.WorkspaceID,
+		&i.TokenHash,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const createWebhookSubscription = `-- name: CreateWebhookSubscription :one
+INSERT INTO
+    webhook_subscriptions (workspace_id, url, event_types, secret, created_by)
+VALUES
+    ($1, $2, $3, $4, $5) RETURNING id, workspace_id, url, event_types, secret, created_by, created_at
+`
+
+type CreateWebhookSubscriptionParams struct {
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	Url         string    `json:"url"`
+	EventTypes  []string  `json:"event_types"`
+	Secret      string    `json:"secret"`
+	CreatedBy   string    `json:"created_by"`
+}
+
+func (q *Queries) CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (WebhookSubscription, error) {
+	row := q.db.QueryRow(ctx,
+		createWebhookSubscription,
+		arg.WorkspaceID,
+		arg.Url,
+		arg.EventTypes,
+		arg.Secret,
+		arg.CreatedBy,
+	)
+	var i WebhookSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.WorkspaceID,
+		&i.Url,
+		&i.EventTypes,
+		&i.Secret,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createWorkspace = `-- name: CreateWorkspace :one
+INSERT INTO
+    workspace (name)
+VALUES
+    ($1) RETURNING id, created_at, name
+`
+
+func (q *Queries) CreateWorkspace(ctx context.Context, name string) (Workspace, error) {
+	row := q.db.QueryRow(ctx, createWorkspace, name)
+	var i Workspace
+	err := row.Scan(&i.ID, &i.CreatedAt, &i.Name)
+	return i, err
+}
+
 const createZone = `-- name: CreateZone :one
 INSERT INTO
     map_annotations_zones (zone, map_id)
@@ -80,60 +425,58 @@ const deleteMapById = `-- name: DeleteMapById :exec
 DELETE FROM
     map
 WHERE
-    id = $1
+    id = $1 AND workspace_id = $2
 `
 
-func (q *Queries) DeleteMapById(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.Exec(ctx, deleteMapById, id)
+type DeleteMapByIdParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) DeleteMapById(ctx context.Context, arg DeleteMapByIdParams) error {
+	_, err := q.db.Exec(ctx, deleteMapById, arg.ID, arg.WorkspaceID)
 	return err
 }
 
-const getMapById = `-- name: GetMapById :one
-SELECT
-    id, created_at, name, image_url
-FROM
-    map
+const deleteRoute = `-- name: DeleteRoute :one
+DELETE FROM
+    map_annotations_routes
 WHERE
-    id = $1
+    id = $1 AND map_id = $2 RETURNING id, route, map_id
 `
 
-func (q *Queries) GetMapById(ctx context.Context, id uuid.UUID) (Map, error) {
-	row := q.db.QueryRow(ctx, getMapById, id)
-	var i Map
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.Name,
-		&i.ImageUrl,
-	)
+type DeleteRouteParams struct {
+	ID    uuid.UUID   `json:"id"`
+	MapID pgtype.UUID `json:"map_id"`
+}
+
+func (q *Queries) DeleteRoute(ctx context.Context, arg DeleteRouteParams) (MapAnnotationsRoute, error) {
+	row := q.db.QueryRow(ctx, deleteRoute, arg.ID, arg.MapID)
+	var i MapAnnotationsRoute
+	err := row.Scan(&i.ID, &i.Route, &i.MapID)
 	return i, err
 }
 
-const getMaps = `-- name: GetMaps :many
-SELECT
-    id, created_at, name, image_url
-FROM
-    map
+const deleteRoutesByMapId = `-- name: DeleteRoutesByMapId :many
+DELETE FROM
+    map_annotations_routes
+WHERE
+    map_id = $1 RETURNING id
 `
 
-func (q *Queries) GetMaps(ctx context.Context) ([]Map, error) {
-	rows, err := q.db.Query(ctx, getMaps)
+func (q *Queries) DeleteRoutesByMapId(ctx context.Context, mapID pgtype.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, deleteRoutesByMapId, mapID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Map
+	var items []uuid.UUID
 	for rows.Next() {
-		var i Map
-		if err := rows.Scan(
-			&i.ID,
-			&i.CreatedAt,
-			&i.Name,
-			&i.ImageUrl,
-		); err != nil {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		items = append(items, i)
+		items = append(items, id)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -141,71 +484,65 @@ func (q *Queries) GetMaps(ctx context.Context) ([]Map, error) {
 	return items, nil
 }
 
-const getPaths = `-- name: GetPaths :many
-SELECT
-    id, route, map_id
-FROM
-    map_annotations_routes
+const deleteWebhookSubscription = `-- name: DeleteWebhookSubscription :execrows
+DELETE FROM
+    webhook_subscriptions
+WHERE
+    id = $1 AND workspace_id = $2
 `
 
-func (q *Queries) GetPaths(ctx context.Context) ([]MapAnnotationsRoute, error) {
-	rows, err := q.db.Query(ctx, getPaths)
+type DeleteWebhookSubscriptionParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) DeleteWebhookSubscription(ctx context.Context, arg DeleteWebhookSubscriptionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWebhookSubscription, arg.ID, arg.WorkspaceID)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []MapAnnotationsRoute
-	for rows.Next() {
-		var i MapAnnotationsRoute
-		if err := rows.Scan(&i.ID, &i.Route, &i.MapID); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
+		return 0, err
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+	return result.RowsAffected(), nil
 }
 
-const getRouteById = `-- name: GetRouteById :one
-SELECT
-    route
-FROM
-    map_annotations_routes
+const deleteZone = `-- name: DeleteZone :one
+DELETE FROM
+    map_annotations_zones
 WHERE
-    id = $1
+    id = $1 AND map_id = $2 RETURNING id, zone, map_id
 `
 
-func (q *Queries) GetRouteById(ctx context.Context, id uuid.UUID) (pgtype.Path, error) {
-	row := q.db.QueryRow(ctx, getRouteById, id)
-	var route pgtype.Path
-	err := row.Scan(&route)
-	return route, err
+type DeleteZoneParams struct {
+	ID    uuid.UUID   `json:"id"`
+	MapID pgtype.UUID `json:"map_id"`
 }
 
-const getRoutesByMapId = `-- name: GetRoutesByMapId :many
-SELECT
-    route
-FROM
-    map_annotations_routes
+func (q *Queries) DeleteZone(ctx context.Context, arg DeleteZoneParams) (MapAnnotationsZone, error) {
+	row := q.db.QueryRow(ctx, deleteZone, arg.ID, arg.MapID)
+	var i MapAnnotationsZone
+	err := row.Scan(&i.ID, &i.Zone, &i.MapID)
+	return i, err
+}
+
+const deleteZonesByMapId = `-- name: DeleteZonesByMapId :many
+DELETE FROM
+    map_annotations_zones
 WHERE
-    map_id = $1
+    map_id = $1 RETURNING id
 `
 
-func (q *Queries) GetRoutesByMapId(ctx context.Context, mapID pgtype.UUID) ([]pgtype.Path, error) {
-	rows, err := q.db.Query(ctx, getRoutesByMapId, mapID)
+func (q *Queries) DeleteZonesByMapId(ctx context.Context, mapID pgtype.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, deleteZonesByMapId, mapID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []pgtype.Path
+	var items []uuid.UUID
 	for rows.Next() {
-		var route pgtype.Path
-		if err := rows.Scan(&route); err != nil {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		items = append(items, route)
+		items = append(items, id)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -213,39 +550,146 @@ func (q *Queries) GetRoutesByMapId(ctx context.Context, mapID pgtype.UUID) ([]pg
 	return items, nil
 }
 
-const getZoneById = `-- name: GetZoneById :one
+const enqueueWebhookDeliveries = `-- name: EnqueueWebhookDeliveries :exec
+WITH state AS (
+    SELECT
+        last_event_id
+    FROM
+        webhook_dispatch_state
+    WHERE
+        id = 1 FOR
+    UPDATE
+),
+batch AS (
+    SELECT
+        id, created_at, workspace_id, map_id, type, entity_id, data, tx_id
+    FROM
+        map_events
+    WHERE
+        (tx_id, id) > (
+            COALESCE(
+                (
+                    SELECT
+                        tx_id
+                    FROM
+                        map_events AS cursor
+                    WHERE
+                        cursor.id = (
+                            SELECT
+                                last_event_id
+                            FROM
+                                state
+                        )
+                ),
+                0
+            ),
+            (
+                SELECT
+                    last_event_id
+                FROM
+                    state
+            )
+        )
+        AND tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+    ORDER BY
+        tx_id,
+        id
+    LIMIT
+        1000
+), enqueued AS (
+    INSERT INTO
+        webhook_deliveries (subscription_id, event_id)
+    SELECT
+        webhook_subscriptions.id, batch.id
+    FROM
+        batch
+        JOIN webhook_subscriptions ON webhook_subscriptions.workspace_id = batch.workspace_id
+        AND batch.type = ANY (webhook_subscriptions.event_types)
+        AND webhook_subscriptions.created_at <= batch.created_at ON CONFLICT (subscription_id, event_id) DO NOTHING
+)
+UPDATE
+    webhook_dispatch_state
+SET
+    last_event_id = COALESCE(
+        (
+            SELECT
+                id
+            FROM
+                batch
+            ORDER BY
+                tx_id DESC,
+                id DESC
+            LIMIT
+                1
+        ),
+        last_event_id
+    )
+WHERE
+    id = 1
+`
+
+func (q *Queries) EnqueueWebhookDeliveries(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, enqueueWebhookDeliveries)
+	return err
+}
+
+const getActiveApiKeyByHash = `-- name: GetActiveApiKeyByHash :one
 SELECT
-    zone
+    id, created_at, name, prefix, key_hash, created_by, last_used_at, revoked_at, workspace_id
 FROM
-    map_annotations_zones
+    api_keys
 WHERE
-    id = $1
+    key_hash = $1 AND revoked_at IS NULL
 `
 
-func (q *Queries) GetZoneById(ctx context.Context, id uuid.UUID) (pgtype.Polygon, error) {
-	row := q.db.QueryRow(ctx, getZoneById, id)
-	var zone pgtype.Polygon
-	err := row.Scan(&zone)
-	return zone, err
+func (q *Queries) GetActiveApiKeyByHash(ctx context.Context, keyHash string) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, getActiveApiKeyByHash, keyHash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.CreatedBy,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
 }
 
-const getZones = `-- name: GetZones :many
+const getApiKeys = `-- name: GetApiKeys :many
 SELECT
-    id, zone, map_id
+    id, created_at, name, prefix, key_hash, created_by, last_used_at, revoked_at, workspace_id
 FROM
-    map_annotations_zones
+    api_keys
+WHERE
+    workspace_id = $1
+ORDER BY
+    created_at DESC
 `
 
-func (q *Queries) GetZones(ctx context.Context) ([]MapAnnotationsZone, error) {
-	rows, err := q.db.Query(ctx, getZones)
+func (q *Queries) GetApiKeys(ctx context.Context, workspaceID uuid.UUID) ([]ApiKey, error) {
+	rows, err := q.db.Query(ctx, getApiKeys, workspaceID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []MapAnnotationsZone
+	var items []ApiKey
 	for rows.Next() {
-		var i MapAnnotationsZone
-		if err := rows.Scan(&i.ID, &i.Zone, &i.MapID); err != nil {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Name,
+			&i.Prefix,
+			&i.KeyHash,
+			&i.CreatedBy,
+			&i.LastUsedAt,
+			&i.RevokedAt,
+			&i.WorkspaceID,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -256,28 +700,1513 @@ func (q *Queries) GetZones(ctx context.Context) ([]MapAnnotationsZone, error) {
 	return items, nil
 }
 
-const getZonesByMapId = `-- name: GetZonesByMapId :many
+const getAuditEntries = `-- name: GetAuditEntries :many
 SELECT
-    zone
+    id, created_at, actor, request_id, action, entity_type, entity_id, map_id, before, after, workspace_id
 FROM
-    map_annotations_zones
+    audit_log
 WHERE
-    map_id = $1
+    workspace_id = $1
+    AND ($2::text IS NULL OR actor = $2)
+    AND ($3::text IS NULL OR action = $3)
+    AND ($4::text IS NULL OR entity_type = $4)
+    AND ($5::uuid IS NULL OR map_id = $5)
+    AND ($6::timestamptz IS NULL OR created_at >= $6)
+    AND ($7::timestamptz IS NULL OR created_at < $7)
+ORDER BY
+    id DESC
+LIMIT
+    $8
 `
 
-func (q *Queries) GetZonesByMapId(ctx context.Context, mapID pgtype.UUID) ([]pgtype.Polygon, error) {
-	rows, err := q.db.Query(ctx, getZonesByMapId, mapID)
-	if err != nil {
+type GetAuditEntriesParams struct {
+	WorkspaceID uuid.UUID          `json:"workspace_id"`
+	Actor       pgtype.Text        `json:"actor"`
+	Action      pgtype.Text        `json:"action"`
+	EntityType  pgtype.Text        `json:"entity_type"`
+	MapID       pgtype.UUID        `json:"map_id"`
+	Since       pgtype.Timestamptz `json:"since"`
+	Until       pgtype.Timestamptz `json:"until"`
+	Limit       int32              `json:"limit"`
+}
+
+func (q *Queries) GetAuditEntries(ctx context.Context, arg GetAuditEntriesParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx,
+		getAuditEntries,
+		arg.WorkspaceID,
+		arg.Actor,
+		arg.Action,
+		arg.EntityType,
+		arg.MapID,
+		arg.Since,
+		arg.Until,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Actor,
+			&i.RequestID,
+			&i.Action,
+			&i.EntityType,
+			&i.EntityID,
+			&i.MapID,
+			&i.Before,
+			&i.After,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAuditEntriesByMapId = `-- name: GetAuditEntriesByMapId :many
+SELECT
+    id, created_at, actor, request_id, action, entity_type, entity_id, map_id, before, after, workspace_id
+FROM
+    audit_log
+WHERE
+    map_id = $1 AND workspace_id = $2
+ORDER BY
+    id DESC
+LIMIT
+    $3
+`
+
+type GetAuditEntriesByMapIdParams struct {
+	MapID       pgtype.UUID `json:"map_id"`
+	WorkspaceID uuid.UUID   `json:"workspace_id"`
+	Limit       int32       `json:"limit"`
+}
+
+func (q *Queries) GetAuditEntriesByMapId(ctx context.Context, arg GetAuditEntriesByMapIdParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx,
+		getAuditEntriesByMapId,
+		arg.MapID,
+		arg.WorkspaceID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Actor,
+			&i.RequestID,
+			&i.Action,
+			&i.EntityType,
+			&i.EntityID,
+			&i.MapID,
+			&i.Before,
+			&i.After,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestMapEventId = `-- name: GetLatestMapEventId :one
+SELECT
+    COALESCE(
+        (
+            SELECT
+                id
+            FROM
+                map_events
+            WHERE
+                workspace_id = $1
+                AND tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+            ORDER BY
+                tx_id DESC,
+                id DESC
+            LIMIT
+                1
+        ),
+        0
+    )::bigint AS id
+`
+
+// The last event GetMapEventsSince would return.
+func (q *Queries) GetLatestMapEventId(ctx context.Context, workspaceID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, getLatestMapEventId, workspaceID)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getMapById = `-- name: GetMapById :one
+SELECT
+    id, created_at, name, image_url, version, is_latest, deleted_at, workspace_id
+FROM
+    map
+WHERE
+    id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+`
+
+type GetMapByIdParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) GetMapById(ctx context.Context, arg GetMapByIdParams) (Map, error) {
+	row := q.db.QueryRow(ctx, getMapById, arg.ID, arg.WorkspaceID)
+	var i Map
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Name,
+		&i.ImageUrl,
+		&i.Version,
+		&i.IsLatest,
+		&i.DeletedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const getMapEventsSince = `-- name: GetMapEventsSince :many
+SELECT
+    id, created_at, workspace_id, map_id, type, entity_id, data, tx_id
+FROM
+    map_events
+WHERE
+    workspace_id = $1
+    AND (tx_id, id) > (
+        COALESCE(
+            (
+                SELECT
+                    tx_id
+                FROM
+                    map_events AS cursor
+                WHERE
+                    cursor.id = $2 AND cursor.workspace_id = $1
+            ),
+            0
+        ),
+        $2
+    )
+    AND tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+ORDER BY
+    tx_id,
+    id
+LIMIT
+    $3
+`
+
+type GetMapEventsSinceParams struct {
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	ID          int64     `json:"id"`
+	Limit       int32     `json:"limit"`
+}
+
+// Events come in (tx_id, id) order after the event $2, or from the start for
+// 0. Only transactions older than every running one are read, so nothing can
+// commit behind a cursor later.
+func (q *Queries) GetMapEventsSince(ctx context.Context, arg GetMapEventsSinceParams) ([]MapEvent, error) {
+	rows, err := q.db.Query(ctx,
+		getMapEventsSince,
+		arg.WorkspaceID,
+		arg.ID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapEvent
+	for rows.Next() {
+		var i MapEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.WorkspaceID,
+			&i.MapID,
+			&i.Type,
+			&i.EntityID,
+			&i.Data,
+			&i.TxID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMapRole = `-- name: GetMapRole :one
+SELECT
+    role
+FROM
+    map_roles
+WHERE
+    map_id = $1 AND subject = $2
+`
+
+type GetMapRoleParams struct {
+	MapID   uuid.UUID `json:"map_id"`
+	Subject string    `json:"subject"`
+}
+
+func (q *Queries) GetMapRole(ctx context.Context, arg GetMapRoleParams) (string, error) {
+	row := q.db.QueryRow(ctx, getMapRole, arg.MapID, arg.Subject)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
+const getMapRolesByMapId = `-- name: GetMapRolesByMapId :many
+SELECT
+    map_id, subject, role, granted_by, created_at
+FROM
+    map_roles
+WHERE
+    map_id = $1
+ORDER BY
+    created_at
+`
+
+func (q *Queries) GetMapRolesByMapId(ctx context.Context, mapID uuid.UUID) ([]MapRole, error) {
+	rows, err := q.db.Query(ctx, getMapRolesByMapId, mapID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapRole
+	for rows.Next() {
+		var i MapRole
+		if err := rows.Scan(
+			&i.MapID,
+			&i.Subject,
+			&i.Role,
+			&i.GrantedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMapVersion = `-- name: GetMapVersion :one
+SELECT
+    version
+FROM
+    map
+WHERE
+    id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+`
+
+type GetMapVersionParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) GetMapVersion(ctx context.Context, arg GetMapVersionParams) (int32, error) {
+	row := q.db.QueryRow(ctx, getMapVersion, arg.ID, arg.WorkspaceID)
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
+const getMapWithAnnotations = `-- name: GetMapWithAnnotations :one
+SELECT
+    map.id, map.created_at, map.name, map.image_url, map.version, map.is_latest, map.deleted_at, map.workspace_id,
+    COALESCE((SELECT array_agg(zone ORDER BY id) FROM map_annotations_zones WHERE map_annotations_zones.map_id = map.id), '{}')::polygon[] AS zones,
+    COALESCE((SELECT array_agg(route ORDER BY id) FROM map_annotations_routes WHERE map_annotations_routes.map_id = map.id), '{}')::path[] AS routes,
+    COALESCE((SELECT array_agg(id ORDER BY id) FROM map_annotations_zones WHERE map_annotations_zones.map_id = map.id), '{}')::uuid[] AS zone_ids,
+    COALESCE((SELECT array_agg(id ORDER BY id) FROM map_annotations_routes WHERE map_annotations_routes.map_id = map.id), '{}')::uuid[] AS route_ids
+FROM
+    map
+WHERE
+    map.id = $1 AND map.workspace_id = $2 AND map.deleted_at IS NULL
+`
+
+type GetMapWithAnnotationsParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+type GetMapWithAnnotationsRow struct {
+	Map      Map              `json:"map"`
+	Zones    []pgtype.Polygon `json:"zones"`
+	Routes   []pgtype.Path    `json:"routes"`
+	ZoneIds  []uuid.UUID      `json:"zone_ids"`
+	RouteIds []uuid.UUID      `json:"route_ids"`
+}
+
+func (q *Queries) GetMapWithAnnotations(ctx context.Context, arg GetMapWithAnnotationsParams) (GetMapWithAnnotationsRow, error) {
+	row := q.db.QueryRow(ctx, getMapWithAnnotations, arg.ID, arg.WorkspaceID)
+	var i GetMapWithAnnotationsRow
+	err := row.Scan(
+		&i.Map.ID,
+		&i.Map.CreatedAt,
+		&i.Map.Name,
+		&i.Map.ImageUrl,
+		&i.Map.Version,
+		&i.Map.IsLatest,
+		&i.Map.DeletedAt,
+		&i.Map.WorkspaceID,
+		&i.Zones,
+		&i.Routes,
+		&i.ZoneIds,
+		&i.RouteIds,
+	)
+	return i, err
+}
+
+const getMaps = `-- name: GetMaps :many
+SELECT
+    id, created_at, name, image_url, version, is_latest, deleted_at, workspace_id
+FROM
+    map
+WHERE
+    workspace_id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetMaps(ctx context.Context, workspaceID uuid.UUID) ([]Map, error) {
+	rows, err := q.db.Query(ctx, getMaps, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Map
+	for rows.Next() {
+		var i Map
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Name,
+			&i.ImageUrl,
+			&i.Version,
+			&i.IsLatest,
+			&i.DeletedAt,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMapsByIds = `-- name: GetMapsByIds :many
+SELECT
+    id, created_at, name, image_url, version, is_latest, deleted_at, workspace_id
+FROM
+    map
+WHERE
+    workspace_id = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL
+`
+
+type GetMapsByIdsParams struct {
+	WorkspaceID uuid.UUID   `json:"workspace_id"`
+	Ids         []uuid.UUID `json:"ids"`
+}
+
+func (q *Queries) GetMapsByIds(ctx context.Context, arg GetMapsByIdsParams) ([]Map, error) {
+	rows, err := q.db.Query(ctx, getMapsByIds, arg.WorkspaceID, arg.Ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Map
+	for rows.Next() {
+		var i Map
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Name,
+			&i.ImageUrl,
+			&i.Version,
+			&i.IsLatest,
+			&i.DeletedAt,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMapsBySubject = `-- name: GetMapsBySubject :many
+SELECT
+    map.id, map.created_at, map.name, map.image_url, map.version, map.is_latest, map.deleted_at, map.workspace_id
+FROM
+    map
+    JOIN map_roles ON map_roles.map_id = map.id
+WHERE
+    map_roles.subject = $1 AND map.workspace_id = $2 AND map.deleted_at IS NULL
+`
+
+type GetMapsBySubjectParams struct {
+	Subject     string    `json:"subject"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) GetMapsBySubject(ctx context.Context, arg GetMapsBySubjectParams) ([]Map, error) {
+	rows, err := q.db.Query(ctx, getMapsBySubject, arg.Subject, arg.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Map
+	for rows.Next() {
+		var i Map
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Name,
+			&i.ImageUrl,
+			&i.Version,
+			&i.IsLatest,
+			&i.DeletedAt,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPaths = `-- name: GetPaths :many
+SELECT
+    map_annotations_routes.id, map_annotations_routes.route, map_annotations_routes.map_id
+FROM
+    map_annotations_routes
+    JOIN map ON map.id = map_annotations_routes.map_id
+WHERE
+    map.workspace_id = $1
+`
+
+func (q *Queries) GetPaths(ctx context.Context, workspaceID uuid.UUID) ([]MapAnnotationsRoute, error) {
+	rows, err := q.db.Query(ctx, getPaths, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapAnnotationsRoute
+	for rows.Next() {
+		var i MapAnnotationsRoute
+		if err := rows.Scan(&i.ID, &i.Route, &i.MapID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRouteAnnotationsByMapId = `-- name: GetRouteAnnotationsByMapId :many
+SELECT
+    id, route, map_id
+FROM
+    map_annotations_routes
+WHERE
+    map_id = $1
+ORDER BY
+    id
+`
+
+func (q *Queries) GetRouteAnnotationsByMapId(ctx context.Context, mapID pgtype.UUID) ([]MapAnnotationsRoute, error) {
+	rows, err := q.db.Query(ctx, getRouteAnnotationsByMapId, mapID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapAnnotationsRoute
+	for rows.Next() {
+		var i MapAnnotationsRoute
+		if err := rows.Scan(&i.ID, &i.Route, &i.MapID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRouteById = `-- name: GetRouteById :one
+SELECT
+    route
+FROM
+    map_annotations_routes
+    JOIN map ON map.id = map_annotations_routes.map_id
+WHERE
+    map_annotations_routes.id = $1 AND map.workspace_id = $2
+`
+
+type GetRouteByIdParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) GetRouteById(ctx context.Context, arg GetRouteByIdParams) (pgtype.Path, error) {
+	row := q.db.QueryRow(ctx, getRouteById, arg.ID, arg.WorkspaceID)
+	var route pgtype.Path
+	err := row.Scan(&route)
+	return route, err
+}
+
+const getRoutesByIds = `-- name: GetRoutesByIds :many
+SELECT
+    map_annotations_routes.id, map_annotations_routes.route, map_annotations_routes.map_id
+FROM
+    map_annotations_routes
+    JOIN map ON map.id = map_annotations_routes.map_id
+WHERE
+    map.workspace_id = $1
+    AND map.deleted_at IS NULL
+    AND map_annotations_routes.id = ANY($2::uuid[])
+`
+
+type GetRoutesByIdsParams struct {
+	WorkspaceID uuid.UUID   `json:"workspace_id"`
+	Ids         []uuid.UUID `json:"ids"`
+}
+
+func (q *Queries) GetRoutesByIds(ctx context.Context, arg GetRoutesByIdsParams) ([]MapAnnotationsRoute, error) {
+	rows, err := q.db.Query(ctx, getRoutesByIds, arg.WorkspaceID, arg.Ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapAnnotationsRoute
+	for rows.Next() {
+		var i MapAnnotationsRoute
+		if err := rows.Scan(&i.ID, &i.Route, &i.MapID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoutesByMapId = `-- name: GetRoutesByMapId :many
+SELECT
+    route
+FROM
+    map_annotations_routes
+    JOIN map ON map.id = map_annotations_routes.map_id
+WHERE
+    map_id = $1 AND map.workspace_id = $2
+`
+
+type GetRoutesByMapIdParams struct {
+	MapID       pgtype.UUID `json:"map_id"`
+	WorkspaceID uuid.UUID   `json:"workspace_id"`
+}
+
+func (q *Queries) GetRoutesByMapId(ctx context.Context, arg GetRoutesByMapIdParams) ([]pgtype.Path, error) {
+	rows, err := q.db.Query(ctx, getRoutesByMapId, arg.MapID, arg.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.Path
+	for rows.Next() {
+		var route pgtype.Path
+		if err := rows.Scan(&route); err != nil {
+			return nil, err
+		}
+		items = append(items, route)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoutesByWorkspace = `-- name: GetRoutesByWorkspace :many
+SELECT
+    map_annotations_routes.id, map_annotations_routes.route, map_annotations_routes.map_id
+FROM
+    map_annotations_routes
+    JOIN map ON map.id = map_annotations_routes.map_id
+WHERE
+    map.workspace_id = $1 AND map.deleted_at IS NULL
+`
+
+func (q *Queries) GetRoutesByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]MapAnnotationsRoute, error) {
+	rows, err := q.db.Query(ctx, getRoutesByWorkspace, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapAnnotationsRoute
+	for rows.Next() {
+		var i MapAnnotationsRoute
+		if err := rows.Scan(&i.ID, &i.Route, &i.MapID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getShareLinksByMapId = `-- name: GetShareLinksByMapId :many
+SELECT
+    id, map_id, workspace_id, token_hash, created_by, created_at, expires_at, revoked_at
+FROM
+    map_share_links
+WHERE
+    map_id = $1 AND workspace_id = $2
+ORDER BY
+    created_at DESC
+`
+
+type GetShareLinksByMapIdParams struct {
+	MapID       uuid.UUID `json:"map_id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) GetShareLinksByMapId(ctx context.Context, arg GetShareLinksByMapIdParams) ([]MapShareLink, error) {
+	rows, err := q.db.Query(ctx, getShareLinksByMapId, arg.MapID, arg.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapShareLink
+	for rows.Next() {
+		var i MapShareLink
+		if err := rows.Scan(
+			&i.ID,
+			&i.MapID,
+			&i.WorkspaceID,
+			&i.TokenHash,
+			&i.CreatedBy,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSharedMapByTokenHash = `-- name: GetSharedMapByTokenHash :one
+SELECT
+    map.id, map.created_at, map.name, map.image_url, map.version, map.is_latest, map.deleted_at, map.workspace_id
+FROM
+    map_share_links
+    JOIN map ON map.id = map_share_links.map_id
+WHERE
+    map_share_links.token_hash = $1
+    AND map_share_links.revoked_at IS NULL
+    AND (map_share_links.expires_at IS NULL OR map_share_links.expires_at > NOW())
+    AND map.deleted_at IS NULL
+`
+
+func (q *Queries) GetSharedMapByTokenHash(ctx context.Context, tokenHash string) (Map, error) {
+	row := q.db.QueryRow(ctx, getSharedMapByTokenHash, tokenHash)
+	var i Map
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Name,
+		&i.ImageUrl,
+		&i.Version,
+		&i.IsLatest,
+		&i.DeletedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const getTrashedMaps = `-- name: GetTrashedMaps :many
+SELECT
+    id, created_at, name, image_url, version, is_latest, deleted_at, workspace_id
+FROM
+    map
+WHERE
+    workspace_id = $1 AND deleted_at IS NOT NULL
+ORDER BY
+    deleted_at DESC
+`
+
+func (q *Queries) GetTrashedMaps(ctx context.Context, workspaceID uuid.UUID) ([]Map, error) {
+	rows, err := q.db.Query(ctx, getTrashedMaps, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Map
+	for rows.Next() {
+		var i Map
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Name,
+			&i.ImageUrl,
+			&i.Version,
+			&i.IsLatest,
+			&i.DeletedAt,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTrashedMapsByOwner = `-- name: GetTrashedMapsByOwner :many
+SELECT
+    map.id, map.created_at, map.name, map.image_url, map.version, map.is_latest, map.deleted_at, map.workspace_id
+FROM
+    map
+    JOIN map_roles ON map_roles.map_id = map.id
+WHERE
+    map_roles.subject = $1 AND map_roles.role = 'owner' AND map.workspace_id = $2 AND map.deleted_at IS NOT NULL
+ORDER BY
+    map.deleted_at DESC
+`
+
+type GetTrashedMapsByOwnerParams struct {
+	Subject     string    `json:"subject"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) GetTrashedMapsByOwner(ctx context.Context, arg GetTrashedMapsByOwnerParams) ([]Map, error) {
+	rows, err := q.db.Query(ctx, getTrashedMapsByOwner, arg.Subject, arg.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Map
+	for rows.Next() {
+		var i Map
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Name,
+			&i.ImageUrl,
+			&i.Version,
+			&i.IsLatest,
+			&i.DeletedAt,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookDeliveries = `-- name: GetWebhookDeliveries :many
+SELECT
+    webhook_deliveries.id, webhook_deliveries.subscription_id, webhook_deliveries.event_id, webhook_deliveries.status, webhook_deliveries.attempts, webhook_deliveries.next_attempt_at, webhook_deliveries.last_attempt_at, webhook_deliveries.response_status, webhook_deliveries.last_error, webhook_deliveries.created_at,
+    map_events.type AS event_type
+FROM
+    webhook_deliveries
+    JOIN map_events ON map_events.id = webhook_deliveries.event_id
+WHERE
+    webhook_deliveries.subscription_id = $1
+ORDER BY
+    webhook_deliveries.created_at DESC
+LIMIT
+    $2
+`
+
+type GetWebhookDeliveriesParams struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	Limit          int32     `json:"limit"`
+}
+
+type GetWebhookDeliveriesRow struct {
+	ID             uuid.UUID          `json:"id"`
+	SubscriptionID uuid.UUID          `json:"subscription_id"`
+	EventID        int64              `json:"event_id"`
+	Status         string             `json:"status"`
+	Attempts       int32              `json:"attempts"`
+	NextAttemptAt  time.Time          `json:"next_attempt_at"`
+	LastAttemptAt  pgtype.Timestamptz `json:"last_attempt_at"`
+	ResponseStatus pgtype.Int4        `json:"response_status"`
+	LastError      pgtype.Text        `json:"last_error"`
+	CreatedAt      time.Time          `json:"created_at"`
+	EventType      string             `json:"event_type"`
+}
+
+func (q *Queries) GetWebhookDeliveries(ctx context.Context, arg GetWebhookDeliveriesParams) ([]GetWebhookDeliveriesRow, error) {
+	rows, err := q.db.Query(ctx, getWebhookDeliveries, arg.SubscriptionID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetWebhookDeliveriesRow
+	for rows.Next() {
+		var i GetWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SubscriptionID,
+			&i.EventID,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+			&i.ResponseStatus,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.EventType,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebhookSubscriptionById = `-- name: GetWebhookSubscriptionById :one
+SELECT
+    id, workspace_id, url, event_types, secret, created_by, created_at
+FROM
+    webhook_subscriptions
+WHERE
+    id = $1 AND workspace_id = $2
+`
+
+type GetWebhookSubscriptionByIdParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) GetWebhookSubscriptionById(ctx context.Context, arg GetWebhookSubscriptionByIdParams) (WebhookSubscription, error) {
+	row := q.db.QueryRow(ctx, getWebhookSubscriptionById, arg.ID, arg.WorkspaceID)
+	var i WebhookSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.WorkspaceID,
+		&i.Url,
+		&i.EventTypes,
+		&i.Secret,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getWebhookSubscriptions = `-- name: GetWebhookSubscriptions :many
+SELECT
+    id, workspace_id, url, event_types, secret, created_by, created_at
+FROM
+    webhook_subscriptions
+WHERE
+    workspace_id = $1
+ORDER BY
+    created_at
+`
+
+func (q *Queries) GetWebhookSubscriptions(ctx context.Context, workspaceID uuid.UUID) ([]WebhookSubscription, error) {
+	rows, err := q.db.Query(ctx, getWebhookSubscriptions, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookSubscription
+	for rows.Next() {
+		var i WebhookSubscription
+		if err := rows.Scan(
+			&i.ID,
+			&i.WorkspaceID,
+			&i.Url,
+			&i.EventTypes,
+			&i.Secret,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWorkspaceMembers = `-- name: GetWorkspaceMembers :many
+SELECT
+    workspace_id, subject, role, granted_by, created_at
+FROM
+    workspace_members
+WHERE
+    workspace_id = $1
+ORDER BY
+    created_at
+`
+
+func (q *Queries) GetWorkspaceMembers(ctx context.Context, workspaceID uuid.UUID) ([]WorkspaceMember, error) {
+	rows, err := q.db.Query(ctx, getWorkspaceMembers, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WorkspaceMember
+	for rows.Next() {
+		var i WorkspaceMember
+		if err := rows.Scan(
+			&i.WorkspaceID,
+			&i.Subject,
+			&i.Role,
+			&i.GrantedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWorkspaceRole = `-- name: GetWorkspaceRole :one
+SELECT
+    role
+FROM
+    workspace_members
+WHERE
+    workspace_id = $1 AND subject = $2
+`
+
+type GetWorkspaceRoleParams struct {
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	Subject     string    `json:"subject"`
+}
+
+func (q *Queries) GetWorkspaceRole(ctx context.Context, arg GetWorkspaceRoleParams) (string, error) {
+	row := q.db.QueryRow(ctx, getWorkspaceRole, arg.WorkspaceID, arg.Subject)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
+const getWorkspacesBySubject = `-- name: GetWorkspacesBySubject :many
+SELECT
+    workspace.id, workspace.created_at, workspace.name,
+    workspace_members.role
+FROM
+    workspace
+    JOIN workspace_members ON workspace_members.workspace_id = workspace.id
+WHERE
+    workspace_members.subject = $1
+ORDER BY
+    workspace.created_at
+`
+
+type GetWorkspacesBySubjectRow struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+}
+
+func (q *Queries) GetWorkspacesBySubject(ctx context.Context, subject string) ([]GetWorkspacesBySubjectRow, error) {
+	rows, err := q.db.Query(ctx, getWorkspacesBySubject, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetWorkspacesBySubjectRow
+	for rows.Next() {
+		var i GetWorkspacesBySubjectRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Name,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getZoneAnnotationsByMapId = `-- name: GetZoneAnnotationsByMapId :many
+SELECT
+    id, zone, map_id
+FROM
+    map_annotations_zones
+WHERE
+    map_id = $1
+ORDER BY
+    id
+`
+
+func (q *Queries) GetZoneAnnotationsByMapId(ctx context.Context, mapID pgtype.UUID) ([]MapAnnotationsZone, error) {
+	rows, err := q.db.Query(ctx, getZoneAnnotationsByMapId, mapID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapAnnotationsZone
+	for rows.Next() {
+		var i MapAnnotationsZone
+		if err := rows.Scan(&i.ID, &i.Zone, &i.MapID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getZoneById = `-- name: GetZoneById :one
+SELECT
+    zone
+FROM
+    map_annotations_zones
+    JOIN map ON map.id = map_annotations_zones.map_id
+WHERE
+    map_annotations_zones.id = $1 AND map.workspace_id = $2
+`
+
+type GetZoneByIdParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) GetZoneById(ctx context.Context, arg GetZoneByIdParams) (pgtype.Polygon, error) {
+	row := q.db.QueryRow(ctx, getZoneById, arg.ID, arg.WorkspaceID)
+	var zone pgtype.Polygon
+	err := row.Scan(&zone)
+	return zone, err
+}
+
+const getZones = `-- name: GetZones :many
+SELECT
+    map_annotations_zones.id, map_annotations_zones.zone, map_annotations_zones.map_id
+FROM
+    map_annotations_zones
+    JOIN map ON map.id = map_annotations_zones.map_id
+WHERE
+    map.workspace_id = $1
+`
+
+func (q *Queries) GetZones(ctx context.Context, workspaceID uuid.UUID) ([]MapAnnotationsZone, error) {
+	rows, err := q.db.Query(ctx, getZones, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapAnnotationsZone
+	for rows.Next() {
+		var i MapAnnotationsZone
+		if err := rows.Scan(&i.ID, &i.Zone, &i.MapID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getZonesByIds = `-- name: GetZonesByIds :many
+SELECT
+    map_annotations_zones.id, map_annotations_zones.zone, map_annotations_zones.map_id
+FROM
+    map_annotations_zones
+    JOIN map ON map.id = map_annotations_zones.map_id
+WHERE
+    map.workspace_id = $1
+    AND map.deleted_at IS NULL
+    AND map_annotations_zones.id = ANY($2::uuid[])
+`
+
+type GetZonesByIdsParams struct {
+	WorkspaceID uuid.UUID   `json:"workspace_id"`
+	Ids         []uuid.UUID `json:"ids"`
+}
+
+func (q *Queries) GetZonesByIds(ctx context.Context, arg GetZonesByIdsParams) ([]MapAnnotationsZone, error) {
+	rows, err := q.db.Query(ctx, getZonesByIds, arg.WorkspaceID, arg.Ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapAnnotationsZone
+	for rows.Next() {
+		var i MapAnnotationsZone
+		if err := rows.Scan(&i.ID, &i.Zone, &i.MapID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getZonesByMapId = `-- name: GetZonesByMapId :many
+SELECT
+    zone
+FROM
+    map_annotations_zones
+    JOIN map ON map.id = map_annotations_zones.map_id
+WHERE
+    map_id = $1 AND map.workspace_id = $2
+`
+
+type GetZonesByMapIdParams struct {
+	MapID       pgtype.UUID `json:"map_id"`
+	WorkspaceID uuid.UUID   `json:"workspace_id"`
+}
+
+func (q *Queries) GetZonesByMapId(ctx context.Context, arg GetZonesByMapIdParams) ([]pgtype.Polygon, error) {
+	rows, err := q.db.Query(ctx, getZonesByMapId, arg.MapID, arg.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.Polygon
+	for rows.Next() {
+		var zone pgtype.Polygon
+		if err := rows.Scan(&zone); err != nil {
+			return nil, err
+		}
+		items = append(items, zone)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getZonesByWorkspace = `-- name: GetZonesByWorkspace :many
+SELECT
+    map_annotations_zones.id, map_annotations_zones.zone, map_annotations_zones.map_id
+FROM
+    map_annotations_zones
+    JOIN map ON map.id = map_annotations_zones.map_id
+WHERE
+    map.workspace_id = $1 AND map.deleted_at IS NULL
+`
+
+func (q *Queries) GetZonesByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]MapAnnotationsZone, error) {
+	rows, err := q.db.Query(ctx, getZonesByWorkspace, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MapAnnotationsZone
+	for rows.Next() {
+		var i MapAnnotationsZone
+		if err := rows.Scan(&i.ID, &i.Zone, &i.MapID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const grantMapRole = `-- name: GrantMapRole :one
+INSERT INTO
+    map_roles (map_id, subject, role, granted_by)
+VALUES
+    ($1, $2, $3, $4) ON CONFLICT (map_id, subject) DO
+UPDATE
+SET
+    role = EXCLUDED.role, granted_by = EXCLUDED.granted_by RETURNING map_id, subject, role, granted_by, created_at
+`
+
+type GrantMapRoleParams struct {
+	MapID     uuid.UUID `json:"map_id"`
+	Subject   string    `json:"subject"`
+	Role      string    `json:"role"`
+	GrantedBy string    `json:"granted_by"`
+}
+
+func (q *Queries) GrantMapRole(ctx context.Context, arg GrantMapRoleParams) (MapRole, error) {
+	row := q.db.QueryRow(ctx,
+		grantMapRole,
+		arg.MapID,
+		arg.Subject,
+		arg.Role,
+		arg.GrantedBy,
+	)
+	var i MapRole
+	err := row.Scan(
+		&i.MapID,
+		&i.Subject,
+		&i.Role,
+		&i.GrantedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const grantWorkspaceRole = `-- name: GrantWorkspaceRole :one
+INSERT INTO
+    workspace_members (workspace_id, subject, role, granted_by)
+VALUES
+    ($1, $2, $3, $4) ON CONFLICT (workspace_id, subject) DO
+UPDATE
+SET
+    role = EXCLUDED.role, granted_by = EXCLUDED.granted_by RETURNING workspace_id, subject, role, granted_by, created_at
+`
+
+type GrantWorkspaceRoleParams struct {
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	Subject     string    `json:"subject"`
+	Role        string    `json:"role"`
+	GrantedBy   string    `json:"granted_by"`
+}
+
+func (q *Queries) GrantWorkspaceRole(ctx context.Context, arg GrantWorkspaceRoleParams) (WorkspaceMember, error) {
+	row := q.db.QueryRow(ctx,
+		grantWorkspaceRole,
+		arg.WorkspaceID,
+		arg.Subject,
+		arg.Role,
+		arg.GrantedBy,
+	)
+	var i WorkspaceMember
+	err := row.Scan(
+		&i.WorkspaceID,
+		&i.Subject,
+		&i.Role,
+		&i.GrantedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const lockMapOwners = `-- name: LockMapOwners :many
+SELECT
+    subject
+FROM
+    map_roles
+WHERE
+    map_id = $1 AND role = 'owner' FOR UPDATE
+`
+
+// locks the owners of a map until the transaction ends, so two changes can't
+// each leave the other as the last owner
+func (q *Queries) LockMapOwners(ctx context.Context, mapID uuid.UUID) ([]string, error) {
+	rows, err := q.db.Query(ctx, lockMapOwners, mapID)
+	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []pgtype.Polygon
+	var items []string
 	for rows.Next() {
-		var zone pgtype.Polygon
-		if err := rows.Scan(&zone); err != nil {
+		var subject string
+		if err := rows.Scan(&subject); err != nil {
 			return nil, err
 		}
-		items = append(items, zone)
+		items = append(items, subject)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockMapVersion = `-- name: LockMapVersion :one
+SELECT
+    version
+FROM
+    map
+WHERE
+    id = $1 AND workspace_id = $2 AND deleted_at IS NULL FOR UPDATE
+`
+
+type LockMapVersionParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+// locks the map row until the transaction ends, every change to a map or its
+// zones and routes bumps the version so they can't change either
+func (q *Queries) LockMapVersion(ctx context.Context, arg LockMapVersionParams) (int32, error) {
+	row := q.db.QueryRow(ctx, lockMapVersion, arg.ID, arg.WorkspaceID)
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
+const lockWorkspaceOwners = `-- name: LockWorkspaceOwners :many
+SELECT
+    subject
+FROM
+    workspace_members
+WHERE
+    workspace_id = $1 AND role = 'owner' FOR UPDATE
+`
+
+// see LockMapOwners
+func (q *Queries) LockWorkspaceOwners(ctx context.Context, workspaceID uuid.UUID) ([]string, error) {
+	rows, err := q.db.Query(ctx, lockWorkspaceOwners, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var subject string
+		if err := rows.Scan(&subject); err != nil {
+			return nil, err
+		}
+		items = append(items, subject)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const mapEventExistsInWorkspace = `-- name: MapEventExistsInWorkspace :one
+SELECT
+    EXISTS (
+        SELECT
+            1
+        FROM
+            map_events
+        WHERE
+            id = $1 AND workspace_id = $2
+    )
+`
+
+type MapEventExistsInWorkspaceParams struct {
+	ID          int64     `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) MapEventExistsInWorkspace(ctx context.Context, arg MapEventExistsInWorkspaceParams) (bool, error) {
+	row := q.db.QueryRow(ctx, mapEventExistsInWorkspace, arg.ID, arg.WorkspaceID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const mapExistsInWorkspace = `-- name: MapExistsInWorkspace :one
+SELECT
+    EXISTS (
+        SELECT
+            1
+        FROM
+            map
+        WHERE
+            id = $1 AND workspace_id = $2
+            AND (deleted_at IS NULL OR $3::boolean)
+    )
+`
+
+type MapExistsInWorkspaceParams struct {
+	ID             uuid.UUID `json:"id"`
+	WorkspaceID    uuid.UUID `json:"workspace_id"`
+	IncludeTrashed bool      `json:"include_trashed"`
+}
+
+func (q *Queries) MapExistsInWorkspace(ctx context.Context, arg MapExistsInWorkspaceParams) (bool, error) {
+	row := q.db.QueryRow(ctx, mapExistsInWorkspace, arg.ID, arg.WorkspaceID, arg.IncludeTrashed)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const purgeDeletedMaps = `-- name: PurgeDeletedMaps :many
+DELETE FROM
+    map
+WHERE
+    deleted_at IS NOT NULL AND deleted_at < $1 RETURNING id, workspace_id
+`
+
+type PurgeDeletedMapsRow struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) PurgeDeletedMaps(ctx context.Context, deletedAt pgtype.Timestamptz) ([]PurgeDeletedMapsRow, error) {
+	rows, err := q.db.Query(ctx, purgeDeletedMaps, deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PurgeDeletedMapsRow
+	for rows.Next() {
+		var i PurgeDeletedMapsRow
+		if err := rows.Scan(&i.ID, &i.WorkspaceID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -285,30 +2214,305 @@ func (q *Queries) GetZonesByMapId(ctx context.Context, mapID pgtype.UUID) ([]pgt
 	return items, nil
 }
 
-const updateMapById = `-- name: UpdateMapById :exec
+const recordWebhookAttempt = `-- name: RecordWebhookAttempt :exec
+UPDATE
+    webhook_deliveries
+SET
+    status = $2,
+    attempts = attempts + 1,
+    last_attempt_at = NOW(),
+    next_attempt_at = $3,
+    response_status = $4,
+    last_error = $5
+WHERE
+    id = $1
+`
+
+type RecordWebhookAttemptParams struct {
+	ID             uuid.UUID   `json:"id"`
+	Status         string      `json:"status"`
+	NextAttemptAt  time.Time   `json:"next_attempt_at"`
+	ResponseStatus pgtype.Int4 `json:"response_status"`
+	LastError      pgtype.Text `json:"last_error"`
+}
+
+func (q *Queries) RecordWebhookAttempt(ctx context.Context, arg RecordWebhookAttemptParams) error {
+	_, err := q.db.Exec(ctx,
+		recordWebhookAttempt,
+		arg.ID,
+		arg.Status,
+		arg.NextAttemptAt,
+		arg.ResponseStatus,
+		arg.LastError,
+	)
+	return err
+}
+
+const redeliverWebhookDelivery = `-- name: RedeliverWebhookDelivery :execrows
+UPDATE
+    webhook_deliveries
+SET
+    status = 'pending', attempts = 0, next_attempt_at = NOW()
+WHERE
+    id = $1 AND subscription_id = $2
+`
+
+type RedeliverWebhookDeliveryParams struct {
+	ID             uuid.UUID `json:"id"`
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+}
+
+func (q *Queries) RedeliverWebhookDelivery(ctx context.Context, arg RedeliverWebhookDeliveryParams) (int64, error) {
+	result, err := q.db.Exec(ctx, redeliverWebhookDelivery, arg.ID, arg.SubscriptionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const restoreMapById = `-- name: RestoreMapById :execrows
+UPDATE
+    map
+SET
+    deleted_at = NULL
+WHERE
+    id = $1 AND workspace_id = $2 AND deleted_at IS NOT NULL
+`
+
+type RestoreMapByIdParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) RestoreMapById(ctx context.Context, arg RestoreMapByIdParams) (int64, error) {
+	result, err := q.db.Exec(ctx, restoreMapById, arg.ID, arg.WorkspaceID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeApiKeyById = `-- name: RevokeApiKeyById :execrows
+UPDATE
+    api_keys
+SET
+    revoked_at = NOW()
+WHERE
+    id = $1 AND workspace_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeApiKeyByIdParams struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) RevokeApiKeyById(ctx context.Context, arg RevokeApiKeyByIdParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeApiKeyById, arg.ID, arg.WorkspaceID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeMapRole = `-- name: RevokeMapRole :execrows
+DELETE FROM
+    map_roles
+WHERE
+    map_id = $1 AND subject = $2
+`
+
+type RevokeMapRoleParams struct {
+	MapID   uuid.UUID `json:"map_id"`
+	Subject string    `json:"subject"`
+}
+
+func (q *Queries) RevokeMapRole(ctx context.Context, arg RevokeMapRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeMapRole, arg.MapID, arg.Subject)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeShareLink = `-- name: RevokeShareLink :execrows
+UPDATE
+    map_share_links
+SET
+    revoked_at = NOW()
+WHERE
+    id = $1 AND map_id = $2 AND workspace_id = $3 AND revoked_at IS NULL
+`
+
+type RevokeShareLinkParams struct {
+	ID          uuid.UUID `json:"id"`
+	MapID       uuid.UUID `json:"map_id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) RevokeShareLink(ctx context.Context, arg RevokeShareLinkParams) (int64, error) {
+	result, err := q.db.Exec(ctx,
+		revokeShareLink,
+		arg.ID,
+		arg.MapID,
+		arg.WorkspaceID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeWorkspaceRole = `-- name: RevokeWorkspaceRole :execrows
+DELETE FROM
+    workspace_members
+WHERE
+    workspace_id = $1 AND subject = $2
+`
+
+type RevokeWorkspaceRoleParams struct {
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	Subject     string    `json:"subject"`
+}
+
+func (q *Queries) RevokeWorkspaceRole(ctx context.Context, arg RevokeWorkspaceRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeWorkspaceRole, arg.WorkspaceID, arg.Subject)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const softDeleteMapById = `-- name: SoftDeleteMapById :execrows
 UPDATE
     map
 SET
-    name = $2, image_url = $3, created_at = $4
+    deleted_at = NOW()
 WHERE
     id = $1
+    AND workspace_id = $2
+    AND deleted_at IS NULL
+    AND ($3::int IS NULL OR version = $3)
+`
+
+type SoftDeleteMapByIdParams struct {
+	ID              uuid.UUID   `json:"id"`
+	WorkspaceID     uuid.UUID   `json:"workspace_id"`
+	ExpectedVersion pgtype.Int4 `json:"expected_version"`
+}
+
+func (q *Queries) SoftDeleteMapById(ctx context.Context, arg SoftDeleteMapByIdParams) (int64, error) {
+	result, err := q.db.Exec(ctx,
+		softDeleteMapById,
+		arg.ID,
+		arg.WorkspaceID,
+		arg.ExpectedVersion,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const touchApiKeyById = `-- name: TouchApiKeyById :exec
+UPDATE
+    api_keys
+SET
+    last_used_at = NOW()
+WHERE
+    id = $1
+`
+
+func (q *Queries) TouchApiKeyById(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, touchApiKeyById, id)
+	return err
+}
+
+const updateMapById = `-- name: UpdateMapById :one
+UPDATE
+    map
+SET
+    name = $2, image_url = $3, version = version + 1
+WHERE
+    id = $1
+    AND workspace_id = $4
+    AND deleted_at IS NULL
+    AND ($5::int IS NULL OR version = $5) RETURNING version
 `
 
 type UpdateMapByIdParams struct {
-	ID        uuid.UUID   `json:"id"`
-	Name      pgtype.Text `json:"name"`
-	ImageUrl  pgtype.Text `json:"image_url"`
-	CreatedAt time.Time   `json:"created_at"`
+	ID              uuid.UUID   `json:"id"`
+	Name            pgtype.Text `json:"name"`
+	ImageUrl        pgtype.Text `json:"image_url"`
+	WorkspaceID     uuid.UUID   `json:"workspace_id"`
+	ExpectedVersion pgtype.Int4 `json:"expected_version"`
 }
 
-func (q *Queries) UpdateMapById(ctx context.Context, arg UpdateMapByIdParams) error {
-	_, err := q.db.Exec(ctx, updateMapById,
+func (q *Queries) UpdateMapById(ctx context.Context, arg UpdateMapByIdParams) (int32, error) {
+	row := q.db.QueryRow(ctx,
+		updateMapById,
 		arg.ID,
 		arg.Name,
 		arg.ImageUrl,
-		arg.CreatedAt,
+		arg.WorkspaceID,
+		arg.ExpectedVersion,
 	)
-	return err
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
+const updateRoute = `-- name: UpdateRoute :one
+UPDATE
+    map_annotations_routes
+SET
+    route = $3
+WHERE
+    id = $1 AND map_id = $2 RETURNING id, route, map_id
+`
+
+type UpdateRouteParams struct {
+	ID    uuid.UUID   `json:"id"`
+	MapID pgtype.UUID `json:"map_id"`
+	Route pgtype.Path `json:"route"`
+}
+
+func (q *Queries) UpdateRoute(ctx context.Context, arg UpdateRouteParams) (MapAnnotationsRoute, error) {
+	row := q.db.QueryRow(ctx,
+		updateRoute,
+		arg.ID,
+		arg.MapID,
+		arg.Route,
+	)
+	var i MapAnnotationsRoute
+	err := row.Scan(&i.ID, &i.Route, &i.MapID)
+	return i, err
+}
+
+const updateZone = `-- name: UpdateZone :one
+UPDATE
+    map_annotations_zones
+SET
+    zone = $3
+WHERE
+    id = $1 AND map_id = $2 RETURNING id, zone, map_id
+`
+
+type UpdateZoneParams struct {
+	ID    uuid.UUID      `json:"id"`
+	MapID pgtype.UUID    `json:"map_id"`
+	Zone  pgtype.Polygon `json:"zone"`
+}
+
+func (q *Queries) UpdateZone(ctx context.Context, arg UpdateZoneParams) (MapAnnotationsZone, error) {
+	row := q.db.QueryRow(ctx,
+		updateZone,
+		arg.ID,
+		arg.MapID,
+		arg.Zone,
+	)
+	var i MapAnnotationsZone
+	err := row.Scan(&i.ID, &i.Zone, &i.MapID)
+	return i, err
 }
 
 const updateZoneById = `-- name: UpdateZoneById :exec
@@ -317,15 +2521,28 @@ UPDATE
 SET
     zone = $2
 WHERE
-    map_id = $1
+    map_id = $1 AND map_id IN (
+        SELECT
+            id
+        FROM
+            map
+        WHERE
+            workspace_id = $3
+    )
 `
 
 type UpdateZoneByIdParams struct {
-	MapID pgtype.UUID    `json:"map_id"`
-	Zone  pgtype.Polygon `json:"zone"`
+	MapID       pgtype.UUID    `json:"map_id"`
+	Zone        pgtype.Polygon `json:"zone"`
+	WorkspaceID uuid.UUID      `json:"workspace_id"`
 }
 
 func (q *Queries) UpdateZoneById(ctx context.Context, arg UpdateZoneByIdParams) error {
-	_, err := q.db.Exec(ctx, updateZoneById, arg.MapID, arg.Zone)
+	_, err := q.db.Exec(ctx,
+		updateZoneById,
+		arg.MapID,
+		arg.Zone,
+		arg.WorkspaceID,
+	)
 	return err
 }
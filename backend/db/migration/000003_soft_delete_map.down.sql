@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS map_deleted_at_idx;
+
+ALTER TABLE
+    map
+DROP
+    COLUMN IF EXISTS deleted_at;
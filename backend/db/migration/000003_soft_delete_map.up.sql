@@ -0,0 +1,8 @@
+ALTER TABLE
+    map
+ADD
+    COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS map_deleted_at_idx ON map (deleted_at)
+WHERE
+    deleted_at IS NOT NULL;
@@ -0,0 +1,10 @@
+CREATE TABLE if NOT EXISTS api_keys (
+    id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    name VARCHAR(50) NOT NULL,
+    prefix VARCHAR(12) NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    created_by TEXT NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,10 @@
+CREATE TABLE if NOT EXISTS map_roles (
+    map_id uuid NOT NULL REFERENCES map (id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    granted_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (map_id, subject)
+);
+
+CREATE INDEX IF NOT EXISTS map_roles_subject_idx ON map_roles (subject);
@@ -0,0 +1,18 @@
+ALTER TABLE
+    audit_log
+DROP
+    COLUMN IF EXISTS workspace_id;
+
+ALTER TABLE
+    api_keys
+DROP
+    COLUMN IF EXISTS workspace_id;
+
+ALTER TABLE
+    map
+DROP
+    COLUMN IF EXISTS workspace_id;
+
+DROP TABLE IF EXISTS workspace_members;
+
+DROP TABLE IF EXISTS workspace;
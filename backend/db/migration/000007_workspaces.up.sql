@@ -0,0 +1,90 @@
+CREATE TABLE if NOT EXISTS workspace (
+    id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    name VARCHAR(50) NOT NULL
+);
+
+CREATE TABLE if NOT EXISTS workspace_members (
+    workspace_id uuid NOT NULL REFERENCES workspace (id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    granted_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, subject)
+);
+
+CREATE INDEX IF NOT EXISTS workspace_members_subject_idx ON workspace_members (subject);
+
+-- everything created before workspaces existed moves into a default workspace
+INSERT INTO
+    workspace (id, name)
+VALUES
+    ('00000000-0000-0000-0000-000000000001', 'Default') ON CONFLICT (id) DO NOTHING;
+
+ALTER TABLE
+    map
+ADD
+    COLUMN IF NOT EXISTS workspace_id uuid REFERENCES workspace (id) ON DELETE CASCADE;
+
+UPDATE
+    map
+SET
+    workspace_id = '00000000-0000-0000-0000-000000000001'
+WHERE
+    workspace_id IS NULL;
+
+ALTER TABLE
+    map
+ALTER COLUMN
+    workspace_id
+SET
+    NOT NULL;
+
+CREATE INDEX IF NOT EXISTS map_workspace_id_idx ON map (workspace_id);
+
+ALTER TABLE
+    api_keys
+ADD
+    COLUMN IF NOT EXISTS workspace_id uuid REFERENCES workspace (id) ON DELETE CASCADE;
+
+UPDATE
+    api_keys
+SET
+    workspace_id = '00000000-0000-0000-0000-000000000001'
+WHERE
+    workspace_id IS NULL;
+
+ALTER TABLE
+    api_keys
+ALTER COLUMN
+    workspace_id
+SET
+    NOT NULL;
+
+-- audit entries are kept even when their workspace is removed
+ALTER TABLE
+    audit_log
+ADD
+    COLUMN IF NOT EXISTS workspace_id uuid;
+
+ALTER TABLE
+    audit_log DISABLE TRIGGER audit_log_append_only;
+
+UPDATE
+    audit_log
+SET
+    workspace_id = '00000000-0000-0000-0000-000000000001'
+WHERE
+    workspace_id IS NULL;
+
+ALTER TABLE
+    audit_log ENABLE TRIGGER audit_log_append_only;
+
+ALTER TABLE
+    audit_log
+ALTER COLUMN
+    workspace_id
+SET
+    NOT NULL;
+
+CREATE INDEX IF NOT EXISTS audit_log_workspace_id_idx ON audit_log (workspace_id, id);
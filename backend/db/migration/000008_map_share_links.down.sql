@@ -0,0 +1 @@
+DROP TABLE IF EXISTS map_share_links;
@@ -0,0 +1,12 @@
+CREATE TABLE if NOT EXISTS map_share_links (
+    id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
+    map_id uuid NOT NULL REFERENCES map (id) ON DELETE CASCADE,
+    workspace_id uuid NOT NULL REFERENCES workspace (id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS map_share_links_map_id_idx ON map_share_links (map_id);
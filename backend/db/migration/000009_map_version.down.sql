@@ -0,0 +1,4 @@
+ALTER TABLE
+    map
+ALTER COLUMN
+    version DROP NOT NULL;
@@ -0,0 +1,17 @@
+-- 000002 never ran its ALTER on some databases, make sure the column exists
+ALTER TABLE
+    map
+ADD
+    COLUMN IF NOT EXISTS version INT default 1;
+
+UPDATE
+    map
+SET
+    version = 1
+WHERE
+    version IS NULL;
+
+ALTER TABLE
+    map
+ALTER COLUMN
+    version SET NOT NULL;
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS map_events_notify ON map_events;
+
+DROP FUNCTION IF EXISTS map_events_notify();
+
+DROP TABLE IF EXISTS map_events;
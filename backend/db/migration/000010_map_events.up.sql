@@ -0,0 +1,27 @@
+-- outbox of map changes, written in the same transaction as the change itself.
+-- map_id has no foreign key so deletions stay visible after a map is purged.
+CREATE TABLE if NOT EXISTS map_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    workspace_id uuid NOT NULL REFERENCES workspace (id) ON DELETE CASCADE,
+    map_id uuid NOT NULL,
+    type VARCHAR(30) NOT NULL,
+    entity_id uuid NOT NULL,
+    data JSONB
+);
+
+CREATE INDEX IF NOT EXISTS map_events_workspace_id_idx ON map_events (workspace_id, id);
+
+-- wake up every instance streaming the workspace once the change commits
+CREATE OR REPLACE FUNCTION map_events_notify() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('map_events', NEW.workspace_id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS map_events_notify ON map_events;
+
+CREATE TRIGGER map_events_notify AFTER
+INSERT
+    ON map_events FOR EACH ROW EXECUTE FUNCTION map_events_notify();
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS webhook_dispatch_state;
+
+DROP TABLE IF EXISTS webhook_deliveries;
+
+DROP TABLE IF EXISTS webhook_subscriptions;
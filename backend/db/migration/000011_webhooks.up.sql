@@ -0,0 +1,43 @@
+CREATE TABLE if NOT EXISTS webhook_subscriptions (
+    id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
+    workspace_id uuid NOT NULL REFERENCES workspace (id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    event_types TEXT [] NOT NULL,
+    secret TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_workspace_id_idx ON webhook_subscriptions (workspace_id);
+
+CREATE TABLE if NOT EXISTS webhook_deliveries (
+    id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
+    subscription_id uuid NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id BIGINT NOT NULL REFERENCES map_events (id) ON DELETE CASCADE,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_attempt_at TIMESTAMPTZ,
+    response_status INT,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at)
+WHERE
+    status = 'pending';
+
+-- how far into map_events deliveries have been queued, a single row
+CREATE TABLE if NOT EXISTS webhook_dispatch_state (
+    id INT PRIMARY KEY CHECK (id = 1),
+    last_event_id BIGINT NOT NULL
+);
+
+-- start from now rather than sending every past event
+INSERT INTO
+    webhook_dispatch_state (id, last_event_id)
+SELECT
+    1, COALESCE(MAX(id), 0)
+FROM
+    map_events ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS map_annotations_routes_map_id_idx;
+DROP INDEX IF EXISTS map_annotations_zones_map_id_idx;
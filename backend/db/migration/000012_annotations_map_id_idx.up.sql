@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS map_annotations_zones_map_id_idx ON map_annotations_zones (map_id);
+CREATE INDEX IF NOT EXISTS map_annotations_routes_map_id_idx ON map_annotations_routes (map_id);
@@ -0,0 +1,6 @@
+CREATE OR REPLACE FUNCTION map_events_notify() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('map_events', NEW.workspace_id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
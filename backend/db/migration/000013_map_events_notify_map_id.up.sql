@@ -0,0 +1,7 @@
+-- name the map as well, so every instance can drop it from its cache
+CREATE OR REPLACE FUNCTION map_events_notify() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('map_events', NEW.workspace_id::text || ':' || NEW.map_id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS map_events_tx_id_idx;
+
+DROP INDEX IF EXISTS map_events_workspace_id_tx_id_idx;
+
+ALTER TABLE map_events DROP COLUMN IF EXISTS tx_id;
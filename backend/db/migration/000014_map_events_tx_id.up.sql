@@ -0,0 +1,10 @@
+-- the transaction that wrote each event. Ids are handed out before commit, so
+-- a lower id can commit after a higher one has been read. Readers go by
+-- (tx_id, id) instead and leave out transactions that may still be running.
+-- Existing events all get this migration's transaction, keeping their order.
+ALTER TABLE map_events
+ADD COLUMN IF NOT EXISTS tx_id BIGINT NOT NULL DEFAULT pg_current_xact_id()::text::bigint;
+
+CREATE INDEX IF NOT EXISTS map_events_workspace_id_tx_id_idx ON map_events (workspace_id, tx_id, id);
+
+CREATE INDEX IF NOT EXISTS map_events_tx_id_idx ON map_events (tx_id, id);
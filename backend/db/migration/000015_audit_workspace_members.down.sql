@@ -0,0 +1,17 @@
+ALTER TABLE
+    audit_log DISABLE TRIGGER audit_log_append_only;
+
+DELETE FROM
+    audit_log
+WHERE
+    map_id IS NULL;
+
+ALTER TABLE
+    audit_log ENABLE TRIGGER audit_log_append_only;
+
+ALTER TABLE
+    audit_log
+ALTER COLUMN
+    map_id
+SET
+    NOT NULL;
@@ -0,0 +1,5 @@
+-- changes to workspace membership are audited too, they belong to no map
+ALTER TABLE
+    audit_log
+ALTER COLUMN
+    map_id DROP NOT NULL;
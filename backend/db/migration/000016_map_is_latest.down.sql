@@ -0,0 +1 @@
+-- is_latest may predate 000016 on older databases, so it is left in place
@@ -0,0 +1,6 @@
+-- 000002 shipped without its ALTER, databases created from the migrations
+-- alone never got is_latest
+ALTER TABLE
+    map
+ADD
+    COLUMN IF NOT EXISTS is_latest BOOLEAN default true;
@@ -3,50 +3,72 @@ SELECT
     zone
 FROM
     map_annotations_zones
+    JOIN map ON map.id = map_annotations_zones.map_id
 WHERE
-    id = $1;
+    map_annotations_zones.id = $1 AND map.workspace_id = $2;
 
 -- name: GetRouteById :one
 SELECT
     route
 FROM
     map_annotations_routes
+    JOIN map ON map.id = map_annotations_routes.map_id
 WHERE
-    id = $1;
+    map_annotations_routes.id = $1 AND map.workspace_id = $2;
 
 -- name: GetRoutesByMapId :many
 SELECT
     route
 FROM
     map_annotations_routes
+    JOIN map ON map.id = map_annotations_routes.map_id
 WHERE
-    map_id = $1;
+    map_id = $1 AND map.workspace_id = $2;
 
 -- name: GetZonesByMapId :many
 SELECT
     zone
 FROM
     map_annotations_zones
+    JOIN map ON map.id = map_annotations_zones.map_id
 WHERE
-    map_id = $1;
+    map_id = $1 AND map.workspace_id = $2;
 
 -- name: GetMaps :many
 SELECT
     *
 FROM
-    map;
+    map
+WHERE
+    workspace_id = $1 AND deleted_at IS NULL;
 
--- name: GetZones :many
+-- name: GetTrashedMaps :many
 SELECT
     *
 FROM
-    map_annotations_zones;
+    map
+WHERE
+    workspace_id = $1 AND deleted_at IS NOT NULL
+ORDER BY
+    deleted_at DESC;
+
+-- name: GetZones :many
+SELECT
+    map_annotations_zones.*
+FROM
+    map_annotations_zones
+    JOIN map ON map.id = map_annotations_zones.map_id
+WHERE
+    map.workspace_id = $1;
 
 -- name: GetPaths :many
 SELECT
-    *
+    map_annotations_routes.*
 FROM
-    map_annotations_routes;
+    map_annotations_routes
+    JOIN map ON map.id = map_annotations_routes.map_id
+WHERE
+    map.workspace_id = $1;
 
 -- name: GetMapById :one
 SELECT
@@ -54,7 +76,19 @@ SELECT
 FROM
     map
 WHERE
-    id = $1;
+    id = $1 AND workspace_id = $2 AND deleted_at IS NULL;
+
+-- name: GetMapWithAnnotations :one
+SELECT
+    sqlc.embed(map),
+    COALESCE((SELECT array_agg(zone ORDER BY id) FROM map_annotations_zones WHERE map_annotations_zones.map_id = map.id), '{}')::polygon[] AS zones,
+    COALESCE((SELECT array_agg(route ORDER BY id) FROM map_annotations_routes WHERE map_annotations_routes.map_id = map.id), '{}')::path[] AS routes,
+    COALESCE((SELECT array_agg(id ORDER BY id) FROM map_annotations_zones WHERE map_annotations_zones.map_id = map.id), '{}')::uuid[] AS zone_ids,
+    COALESCE((SELECT array_agg(id ORDER BY id) FROM map_annotations_routes WHERE map_annotations_routes.map_id = map.id), '{}')::uuid[] AS route_ids
+FROM
+    map
+WHERE
+    map.id = $1 AND map.workspace_id = $2 AND map.deleted_at IS NULL;
 
 -- name: CreateZone :one
 INSERT INTO
@@ -70,17 +104,20 @@ VALUES
 
 -- name: CreateMap :one
 INSERT INTO
-    map (name, image_url, created_at)
+    map (name, image_url, created_at, workspace_id)
 VALUES
-    ($1, $2, $3) RETURNING *;
+    ($1, $2, $3, $4) RETURNING *;
 
--- name: UpdateMapById :exec
+-- name: UpdateMapById :one
 UPDATE
     map
 SET
-    name = $2, image_url = $3, created_at = $4
+    name = $2, image_url = $3, version = version + 1
 WHERE
-    id = $1;
+    id = $1
+    AND workspace_id = $4
+    AND deleted_at IS NULL
+    AND (sqlc.narg('expected_version')::int IS NULL OR version = sqlc.narg('expected_version')) RETURNING version;
 
 -- name: UpdateZoneById :exec
 UPDATE
@@ -88,10 +125,678 @@ UPDATE
 SET
     zone = $2
 WHERE
-    map_id = $1;
+    map_id = $1 AND map_id IN (
+        SELECT
+            id
+        FROM
+            map
+        WHERE
+            workspace_id = $3
+    );
 
 -- name: DeleteMapById :exec
 DELETE FROM
     map
+WHERE
+    id = $1 AND workspace_id = $2;
+
+-- name: SoftDeleteMapById :execrows
+UPDATE
+    map
+SET
+    deleted_at = NOW()
+WHERE
+    id = $1
+    AND workspace_id = $2
+    AND deleted_at IS NULL
+    AND (sqlc.narg('expected_version')::int IS NULL OR version = sqlc.narg('expected_version'));
+
+-- name: RestoreMapById :execrows
+UPDATE
+    map
+SET
+    deleted_at = NULL
+WHERE
+    id = $1 AND workspace_id = $2 AND deleted_at IS NOT NULL;
+
+-- name: PurgeDeletedMaps :many
+DELETE FROM
+    map
+WHERE
+    deleted_at IS NOT NULL AND deleted_at < $1 RETURNING id, workspace_id;
+
+-- name: CreateAuditEntry :one
+INSERT INTO
+    audit_log (actor, request_id, action, entity_type, entity_id, map_id, before, after, workspace_id)
+VALUES
+    ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
+
+-- name: GetAuditEntriesByMapId :many
+SELECT
+    *
+FROM
+    audit_log
+WHERE
+    map_id = $1 AND workspace_id = $2
+ORDER BY
+    id DESC
+LIMIT
+    $3;
+
+-- name: GetAuditEntries :many
+SELECT
+    *
+FROM
+    audit_log
+WHERE
+    workspace_id = sqlc.arg('workspace_id')
+    AND (sqlc.narg('actor')::text IS NULL OR actor = sqlc.narg('actor'))
+    AND (sqlc.narg('action')::text IS NULL OR action = sqlc.narg('action'))
+    AND (sqlc.narg('entity_type')::text IS NULL OR entity_type = sqlc.narg('entity_type'))
+    AND (sqlc.narg('map_id')::uuid IS NULL OR map_id = sqlc.narg('map_id'))
+    AND (sqlc.narg('since')::timestamptz IS NULL OR created_at >= sqlc.narg('since'))
+    AND (sqlc.narg('until')::timestamptz IS NULL OR created_at < sqlc.narg('until'))
+ORDER BY
+    id DESC
+LIMIT
+    sqlc.arg('limit');
+
+-- name: CreateApiKey :one
+INSERT INTO
+    api_keys (name, prefix, key_hash, created_by, workspace_id)
+VALUES
+    ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: GetApiKeys :many
+SELECT
+    *
+FROM
+    api_keys
+WHERE
+    workspace_id = $1
+ORDER BY
+    created_at DESC;
+
+-- name: GetActiveApiKeyByHash :one
+SELECT
+    *
+FROM
+    api_keys
+WHERE
+    key_hash = $1 AND revoked_at IS NULL;
+
+-- name: TouchApiKeyById :exec
+UPDATE
+    api_keys
+SET
+    last_used_at = NOW()
 WHERE
     id = $1;
+
+-- name: RevokeApiKeyById :execrows
+UPDATE
+    api_keys
+SET
+    revoked_at = NOW()
+WHERE
+    id = $1 AND workspace_id = $2 AND revoked_at IS NULL;
+
+-- name: GetMapsBySubject :many
+SELECT
+    map.*
+FROM
+    map
+    JOIN map_roles ON map_roles.map_id = map.id
+WHERE
+    map_roles.subject = $1 AND map.workspace_id = $2 AND map.deleted_at IS NULL;
+
+-- name: GetTrashedMapsByOwner :many
+SELECT
+    map.*
+FROM
+    map
+    JOIN map_roles ON map_roles.map_id = map.id
+WHERE
+    map_roles.subject = $1 AND map_roles.role = 'owner' AND map.workspace_id = $2 AND map.deleted_at IS NOT NULL
+ORDER BY
+    map.deleted_at DESC;
+
+-- name: GetMapRole :one
+SELECT
+    role
+FROM
+    map_roles
+WHERE
+    map_id = $1 AND subject = $2;
+
+-- name: GetMapRolesByMapId :many
+SELECT
+    *
+FROM
+    map_roles
+WHERE
+    map_id = $1
+ORDER BY
+    created_at;
+
+-- name: LockMapOwners :many
+-- locks the owners of a map until the transaction ends, so two changes can't
+-- each leave the other as the last owner
+SELECT
+    subject
+FROM
+    map_roles
+WHERE
+    map_id = $1 AND role = 'owner' FOR UPDATE;
+
+-- name: GrantMapRole :one
+INSERT INTO
+    map_roles (map_id, subject, role, granted_by)
+VALUES
+    ($1, $2, $3, $4) ON CONFLICT (map_id, subject) DO
+UPDATE
+SET
+    role = EXCLUDED.role, granted_by = EXCLUDED.granted_by RETURNING *;
+
+-- name: RevokeMapRole :execrows
+DELETE FROM
+    map_roles
+WHERE
+    map_id = $1 AND subject = $2;
+
+-- name: MapEventExistsInWorkspace :one
+SELECT
+    EXISTS (
+        SELECT
+            1
+        FROM
+            map_events
+        WHERE
+            id = $1 AND workspace_id = $2
+    );
+
+-- name: MapExistsInWorkspace :one
+SELECT
+    EXISTS (
+        SELECT
+            1
+        FROM
+            map
+        WHERE
+            id = $1 AND workspace_id = $2
+            AND (deleted_at IS NULL OR sqlc.arg('include_trashed')::boolean)
+    );
+
+-- name: CreateWorkspace :one
+INSERT INTO
+    workspace (name)
+VALUES
+    ($1) RETURNING *;
+
+-- name: GetWorkspacesBySubject :many
+SELECT
+    workspace.*,
+    workspace_members.role
+FROM
+    workspace
+    JOIN workspace_members ON workspace_members.workspace_id = workspace.id
+WHERE
+    workspace_members.subject = $1
+ORDER BY
+    workspace.created_at;
+
+-- name: GetWorkspaceRole :one
+SELECT
+    role
+FROM
+    workspace_members
+WHERE
+    workspace_id = $1 AND subject = $2;
+
+-- name: GetWorkspaceMembers :many
+SELECT
+    *
+FROM
+    workspace_members
+WHERE
+    workspace_id = $1
+ORDER BY
+    created_at;
+
+-- name: CountTotals :one
+SELECT
+    (SELECT COUNT(*) FROM map WHERE map.deleted_at IS NULL) AS maps,
+    (SELECT COUNT(*) FROM map_annotations_zones JOIN map ON map.id = map_annotations_zones.map_id WHERE map.deleted_at IS NULL) AS zones,
+    (SELECT COUNT(*) FROM map_annotations_routes JOIN map ON map.id = map_annotations_routes.map_id WHERE map.deleted_at IS NULL) AS routes;
+
+-- name: LockWorkspaceOwners :many
+-- see LockMapOwners
+SELECT
+    subject
+FROM
+    workspace_members
+WHERE
+    workspace_id = $1 AND role = 'owner' FOR UPDATE;
+
+-- name: GrantWorkspaceRole :one
+INSERT INTO
+    workspace_members (workspace_id, subject, role, granted_by)
+VALUES
+    ($1, $2, $3, $4) ON CONFLICT (workspace_id, subject) DO
+UPDATE
+SET
+    role = EXCLUDED.role, granted_by = EXCLUDED.granted_by RETURNING *;
+
+-- name: RevokeWorkspaceRole :execrows
+DELETE FROM
+    workspace_members
+WHERE
+    workspace_id = $1 AND subject = $2;
+
+-- name: CreateShareLink :one
+INSERT INTO
+    map_share_links (map_id, workspace_id, token_hash, created_by, expires_at)
+VALUES
+    ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: GetShareLinksByMapId :many
+SELECT
+    *
+FROM
+    map_share_links
+WHERE
+    map_id = $1 AND workspace_id = $2
+ORDER BY
+    created_at DESC;
+
+-- name: RevokeShareLink :execrows
+UPDATE
+    map_share_links
+SET
+    revoked_at = NOW()
+WHERE
+    id = $1 AND map_id = $2 AND workspace_id = $3 AND revoked_at IS NULL;
+
+-- name: GetSharedMapByTokenHash :one
+SELECT
+    map.*
+FROM
+    map_share_links
+    JOIN map ON map.id = map_share_links.map_id
+WHERE
+    map_share_links.token_hash = $1
+    AND map_share_links.revoked_at IS NULL
+    AND (map_share_links.expires_at IS NULL OR map_share_links.expires_at > NOW())
+    AND map.deleted_at IS NULL;
+
+-- name: GetMapVersion :one
+SELECT
+    version
+FROM
+    map
+WHERE
+    id = $1 AND workspace_id = $2 AND deleted_at IS NULL;
+
+-- name: LockMapVersion :one
+-- locks the map row until the transaction ends, every change to a map or its
+-- zones and routes bumps the version so they can't change either
+SELECT
+    version
+FROM
+    map
+WHERE
+    id = $1 AND workspace_id = $2 AND deleted_at IS NULL FOR UPDATE;
+
+-- name: DeleteZonesByMapId :many
+DELETE FROM
+    map_annotations_zones
+WHERE
+    map_id = $1 RETURNING id;
+
+-- name: DeleteRoutesByMapId :many
+DELETE FROM
+    map_annotations_routes
+WHERE
+    map_id = $1 RETURNING id;
+
+-- name: BumpMapVersion :one
+UPDATE
+    map
+SET
+    version = version + 1
+WHERE
+    id = $1
+    AND workspace_id = $2
+    AND deleted_at IS NULL
+    AND (sqlc.narg('expected_version')::int IS NULL OR version = sqlc.narg('expected_version')) RETURNING version;
+
+-- name: GetZoneAnnotationsByMapId :many
+SELECT
+    *
+FROM
+    map_annotations_zones
+WHERE
+    map_id = $1
+ORDER BY
+    id;
+
+-- name: GetRouteAnnotationsByMapId :many
+SELECT
+    *
+FROM
+    map_annotations_routes
+WHERE
+    map_id = $1
+ORDER BY
+    id;
+
+-- name: UpdateZone :one
+UPDATE
+    map_annotations_zones
+SET
+    zone = $3
+WHERE
+    id = $1 AND map_id = $2 RETURNING *;
+
+-- name: DeleteZone :one
+DELETE FROM
+    map_annotations_zones
+WHERE
+    id = $1 AND map_id = $2 RETURNING *;
+
+-- name: UpdateRoute :one
+UPDATE
+    map_annotations_routes
+SET
+    route = $3
+WHERE
+    id = $1 AND map_id = $2 RETURNING *;
+
+-- name: DeleteRoute :one
+DELETE FROM
+    map_annotations_routes
+WHERE
+    id = $1 AND map_id = $2 RETURNING *;
+
+-- name: CreateMapEvent :exec
+INSERT INTO
+    map_events (workspace_id, map_id, type, entity_id, data)
+VALUES
+    ($1, $2, $3, $4, $5);
+
+-- name: GetMapEventsSince :many
+-- Events come in (tx_id, id) order after the event $2, or from the start for
+-- 0. Only transactions older than every running one are read, so nothing can
+-- commit behind a cursor later.
+SELECT
+    *
+FROM
+    map_events
+WHERE
+    workspace_id = $1
+    AND (tx_id, id) > (
+        COALESCE(
+            (
+                SELECT
+                    tx_id
+                FROM
+                    map_events AS cursor
+                WHERE
+                    cursor.id = $2 AND cursor.workspace_id = $1
+            ),
+            0
+        ),
+        $2
+    )
+    AND tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+ORDER BY
+    tx_id,
+    id
+LIMIT
+    $3;
+
+-- name: GetLatestMapEventId :one
+-- The last event GetMapEventsSince would return.
+SELECT
+    COALESCE(
+        (
+            SELECT
+                id
+            FROM
+                map_events
+            WHERE
+                workspace_id = $1
+                AND tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+            ORDER BY
+                tx_id DESC,
+                id DESC
+            LIMIT
+                1
+        ),
+        0
+    )::bigint AS id;
+
+-- name: CreateWebhookSubscription :one
+INSERT INTO
+    webhook_subscriptions (workspace_id, url, event_types, secret, created_by)
+VALUES
+    ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: GetWebhookSubscriptions :many
+SELECT
+    *
+FROM
+    webhook_subscriptions
+WHERE
+    workspace_id = $1
+ORDER BY
+    created_at;
+
+-- name: GetWebhookSubscriptionById :one
+SELECT
+    *
+FROM
+    webhook_subscriptions
+WHERE
+    id = $1 AND workspace_id = $2;
+
+-- name: DeleteWebhookSubscription :execrows
+DELETE FROM
+    webhook_subscriptions
+WHERE
+    id = $1 AND workspace_id = $2;
+
+-- name: GetWebhookDeliveries :many
+SELECT
+    webhook_deliveries.*,
+    map_events.type AS event_type
+FROM
+    webhook_deliveries
+    JOIN map_events ON map_events.id = webhook_deliveries.event_id
+WHERE
+    webhook_deliveries.subscription_id = $1
+ORDER BY
+    webhook_deliveries.created_at DESC
+LIMIT
+    $2;
+
+-- name: RedeliverWebhookDelivery :execrows
+UPDATE
+    webhook_deliveries
+SET
+    status = 'pending', attempts = 0, next_attempt_at = NOW()
+WHERE
+    id = $1 AND subscription_id = $2;
+
+-- name: EnqueueWebhookDeliveries :exec
+WITH state AS (
+    SELECT
+        last_event_id
+    FROM
+        webhook_dispatch_state
+    WHERE
+        id = 1 FOR
+    UPDATE
+),
+batch AS (
+    SELECT
+        *
+    FROM
+        map_events
+    WHERE
+        (tx_id, id) > (
+            COALESCE(
+                (
+                    SELECT
+                        tx_id
+                    FROM
+                        map_events AS cursor
+                    WHERE
+                        cursor.id = (
+                            SELECT
+                                last_event_id
+                            FROM
+                                state
+                        )
+                ),
+                0
+            ),
+            (
+                SELECT
+                    last_event_id
+                FROM
+                    state
+            )
+        )
+        AND tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint
+    ORDER BY
+        tx_id,
+        id
+    LIMIT
+        1000
+), enqueued AS (
+    INSERT INTO
+        webhook_deliveries (subscription_id, event_id)
+    SELECT
+        webhook_subscriptions.id, batch.id
+    FROM
+        batch
+        JOIN webhook_subscriptions ON webhook_subscriptions.workspace_id = batch.workspace_id
+        AND batch.type = ANY (webhook_subscriptions.event_types)
+        AND webhook_subscriptions.created_at <= batch.created_at ON CONFLICT (subscription_id, event_id) DO NOTHING
+)
+UPDATE
+    webhook_dispatch_state
+SET
+    last_event_id = COALESCE(
+        (
+            SELECT
+                id
+            FROM
+                batch
+            ORDER BY
+                tx_id DESC,
+                id DESC
+            LIMIT
+                1
+        ),
+        last_event_id
+    )
+WHERE
+    id = 1;
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE
+    webhook_deliveries
+SET
+    next_attempt_at = NOW() + INTERVAL '5 minutes'
+FROM
+    webhook_subscriptions,
+    map_events
+WHERE
+    webhook_deliveries.id IN (
+        SELECT
+            id
+        FROM
+            webhook_deliveries
+        WHERE
+            status = 'pending' AND next_attempt_at <= NOW()
+        ORDER BY
+            next_attempt_at
+        LIMIT
+            $1 FOR
+        UPDATE
+            SKIP LOCKED
+    )
+    AND webhook_subscriptions.id = webhook_deliveries.subscription_id
+    AND map_events.id = webhook_deliveries.event_id RETURNING webhook_deliveries.id,
+    webhook_deliveries.attempts,
+    webhook_subscriptions.url,
+    webhook_subscriptions.secret,
+    map_events.id AS event_id,
+    map_events.type,
+    map_events.created_at,
+    map_events.map_id,
+    map_events.entity_id,
+    map_events.data;
+
+-- name: RecordWebhookAttempt :exec
+UPDATE
+    webhook_deliveries
+SET
+    status = $2,
+    attempts = attempts + 1,
+    last_attempt_at = NOW(),
+    next_attempt_at = $3,
+    response_status = $4,
+    last_error = $5
+WHERE
+    id = $1;
+
+-- name: GetMapsByIds :many
+SELECT
+    *
+FROM
+    map
+WHERE
+    workspace_id = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL;
+
+-- name: GetZonesByIds :many
+SELECT
+    map_annotations_zones.*
+FROM
+    map_annotations_zones
+    JOIN map ON map.id = map_annotations_zones.map_id
+WHERE
+    map.workspace_id = $1
+    AND map.deleted_at IS NULL
+    AND map_annotations_zones.id = ANY($2::uuid[]);
+
+-- name: GetRoutesByIds :many
+SELECT
+    map_annotations_routes.*
+FROM
+    map_annotations_routes
+    JOIN map ON map.id = map_annotations_routes.map_id
+WHERE
+    map.workspace_id = $1
+    AND map.deleted_at IS NULL
+    AND map_annotations_routes.id = ANY($2::uuid[]);
+
+-- name: GetZonesByWorkspace :many
+SELECT
+    map_annotations_zones.*
+FROM
+    map_annotations_zones
+    JOIN map ON map.id = map_annotations_zones.map_id
+WHERE
+    map.workspace_id = $1 AND map.deleted_at IS NULL;
+
+-- name: GetRoutesByWorkspace :many
+SELECT
+    map_annotations_routes.*
+FROM
+    map_annotations_routes
+    JOIN map ON map.id = map_annotations_routes.map_id
+WHERE
+    map.workspace_id = $1 AND map.deleted_at IS NULL;
@@ -1,12 +1,29 @@
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
+CREATE TABLE if NOT EXISTS workspace (
+    id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    name VARCHAR(50) NOT NULL
+);
+
+CREATE TABLE if NOT EXISTS workspace_members (
+    workspace_id uuid NOT NULL REFERENCES workspace (id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    granted_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, subject)
+);
+
 CREATE TABLE if NOT EXISTS map (
     id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     name VARCHAR(50),
     image_url TEXT,
-    version INT,
-    is_latest bool
+    version INT NOT NULL DEFAULT 1,
+    is_latest bool,
+    deleted_at TIMESTAMPTZ,
+    workspace_id uuid NOT NULL REFERENCES workspace (id) ON DELETE CASCADE
 );
 
 CREATE TABLE if NOT EXISTS map_annotations_zones (
@@ -21,3 +38,90 @@ CREATE TABLE if NOT EXISTS map_annotations_routes (
     map_id uuid REFERENCES map (id) ON DELETE CASCADE
 );
 
+
+CREATE TABLE if NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    actor TEXT NOT NULL,
+    request_id TEXT,
+    action VARCHAR(20) NOT NULL,
+    entity_type VARCHAR(20) NOT NULL,
+    entity_id uuid NOT NULL,
+    map_id uuid,
+    before JSONB,
+    after JSONB,
+    workspace_id uuid NOT NULL
+);
+
+CREATE TABLE if NOT EXISTS api_keys (
+    id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    name VARCHAR(50) NOT NULL,
+    prefix VARCHAR(12) NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    created_by TEXT NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    workspace_id uuid NOT NULL REFERENCES workspace (id) ON DELETE CASCADE
+);
+
+CREATE TABLE if NOT EXISTS map_roles (
+    map_id uuid NOT NULL REFERENCES map (id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    granted_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (map_id, subject)
+);
+
+CREATE TABLE if NOT EXISTS map_share_links (
+    id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
+    map_id uuid NOT NULL REFERENCES map (id) ON DELETE CASCADE,
+    workspace_id uuid NOT NULL REFERENCES workspace (id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE TABLE if NOT EXISTS map_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    workspace_id uuid NOT NULL REFERENCES workspace (id) ON DELETE CASCADE,
+    map_id uuid NOT NULL,
+    type VARCHAR(30) NOT NULL,
+    entity_id uuid NOT NULL,
+    data JSONB,
+    tx_id BIGINT NOT NULL DEFAULT pg_current_xact_id()::text::bigint
+);
+
+CREATE TABLE if NOT EXISTS webhook_subscriptions (
+    id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
+    workspace_id uuid NOT NULL REFERENCES workspace (id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    event_types TEXT [] NOT NULL,
+    secret TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE if NOT EXISTS webhook_deliveries (
+    id uuid PRIMARY KEY NOT NULL DEFAULT uuid_generate_v4(),
+    subscription_id uuid NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id BIGINT NOT NULL REFERENCES map_events (id) ON DELETE CASCADE,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_attempt_at TIMESTAMPTZ,
+    response_status INT,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (subscription_id, event_id)
+);
+
+-- how far into map_events deliveries have been queued, a single row
+CREATE TABLE if NOT EXISTS webhook_dispatch_state (
+    id INT PRIMARY KEY CHECK (id = 1),
+    last_event_id BIGINT NOT NULL
+);
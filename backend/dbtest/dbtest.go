@@ -0,0 +1,85 @@
+// Package dbtest gives tests a real database. Tests using it are skipped
+// unless TEST_DATABASE_URL names one, which is migrated to the latest version
+// first. Tests share the database, so each should work in its own workspace.
+package dbtest
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/migrations"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const urlVariable = "TEST_DATABASE_URL"
+
+var (
+	migrateOnce sync.Once
+	migrateErr  error
+)
+
+// Pool connects to the test database, closing the pool when t ends
+func Pool(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv(urlVariable)
+	if url == "" {
+		t.Skip(urlVariable + " is not set")
+	}
+	migrateOnce.Do(func() {
+		migrateErr = migrations.Run([]string{"up"}, migrationsDir(), url, io.Discard)
+	})
+	if migrateErr != nil {
+		t.Fatalf("Migrating the test database failed: %v", migrateErr)
+	}
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatalf("Connecting to the test database failed: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// db/migration, found from this file so tests work from any package
+func migrationsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "db", "migration")
+}
+
+// Workspace creates a new workspace owned by the user subject and returns a
+// context acting as them in it
+func Workspace(t testing.TB, q db.Querier, subject string) (context.Context, uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+	workspace, err := q.CreateWorkspace(ctx, "test")
+	if err != nil {
+		t.Fatalf("Creating a workspace failed: %v", err)
+	}
+	if _, err := q.GrantWorkspaceRole(ctx, db.GrantWorkspaceRoleParams{
+		WorkspaceID: workspace.ID,
+		Subject:     auth.KindUser + ":" + subject,
+		Role:        auth.RoleOwner,
+		GrantedBy:   "test",
+	}); err != nil {
+		t.Fatalf("Granting the workspace owner failed: %v", err)
+	}
+	return As(workspace.ID, subject, auth.RoleOwner), workspace.ID
+}
+
+// As returns a context acting as the user subject with role in the
+// workspace, role is empty for users who aren't members
+func As(workspaceID uuid.UUID, subject string, role string) context.Context {
+	return auth.WithPrincipal(context.Background(), auth.Principal{
+		Kind:          auth.KindUser,
+		Subject:       subject,
+		WorkspaceID:   workspaceID,
+		WorkspaceRole: role,
+	})
+}
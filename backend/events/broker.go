@@ -0,0 +1,148 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const channel = "map_events"
+
+// Broker listens for outbox notifications from Postgres and wakes up the
+// streams of the workspace that changed, on every instance of the server
+type Broker struct {
+	pool        *pgxpool.Pool
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan struct{}]struct{}
+	onChange    []func(workspaceID uuid.UUID, mapID uuid.UUID)
+	closing     chan struct{}
+	closeOnce   sync.Once
+}
+
+func NewBroker(pool *pgxpool.Pool) *Broker {
+	return &Broker{
+		pool:        pool,
+		subscribers: make(map[uuid.UUID]map[chan struct{}]struct{}),
+		closing:     make(chan struct{}),
+	}
+}
+
+// Close ends every open stream so the server can shut down, clients
+// reconnect with Last-Event-ID and miss nothing
+func (b *Broker) Close() {
+	b.closeOnce.Do(func() { close(b.closing) })
+}
+
+// OnChange registers fn to be called with every map that changed, wherever
+// the change was made. Calls happen on the listening goroutine so fn must be
+// quick.
+func (b *Broker) OnChange(fn func(workspaceID uuid.UUID, mapID uuid.UUID)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = append(b.onChange, fn)
+}
+
+// subscribe returns a channel that receives a value whenever the workspace
+// has new events. Wake-ups are coalesced, readers should fetch everything
+// since the last event they saw.
+func (b *Broker) subscribe(workspaceID uuid.UUID) chan struct{} {
+	wake := make(chan struct{}, 1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[workspaceID] == nil {
+		b.subscribers[workspaceID] = make(map[chan struct{}]struct{})
+	}
+	b.subscribers[workspaceID][wake] = struct{}{}
+	return wake
+}
+
+func (b *Broker) unsubscribe(workspaceID uuid.UUID, wake chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers[workspaceID], wake)
+	if len(b.subscribers[workspaceID]) == 0 {
+		delete(b.subscribers, workspaceID)
+	}
+}
+
+func (b *Broker) notify(workspaceID uuid.UUID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for wake := range b.subscribers[workspaceID] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run listens until ctx is cancelled, reconnecting when the connection drops.
+// Streams also poll on their heartbeat, so a missed notification only delays
+// events.
+func (b *Broker) Run(ctx context.Context) {
+	for {
+		if err := b.listen(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Listening for map events failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (b *Broker) listen(ctx context.Context) error {
+	pooled, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// LISTEN is tied to the connection, so take it out of the pool for good
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		workspaceID, mapID, err := parsePayload(notification.Payload)
+		if err != nil {
+			slog.WarnContext(ctx, "Ignoring map event notification", "payload", notification.Payload, "err", err)
+			continue
+		}
+		b.notify(workspaceID)
+		if mapID != uuid.Nil {
+			b.changed(workspaceID, mapID)
+		}
+	}
+}
+
+func (b *Broker) changed(workspaceID uuid.UUID, mapID uuid.UUID) {
+	b.mu.Lock()
+	hooks := b.onChange
+	b.mu.Unlock()
+	for _, fn := range hooks {
+		fn(workspaceID, mapID)
+	}
+}
+
+// parsePayload reads "workspace_id:map_id", or just the workspace id as sent
+// before migration 13, mapID is then uuid.Nil
+func parsePayload(payload string) (uuid.UUID, uuid.UUID, error) {
+	workspace, mapPart, found := strings.Cut(payload, ":")
+	workspaceID, err := uuid.Parse(workspace)
+	if err != nil || !found {
+		return workspaceID, uuid.Nil, err
+	}
+	mapID, err := uuid.Parse(mapPart)
+	return workspaceID, mapID, err
+}
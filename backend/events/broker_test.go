@@ -0,0 +1,82 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParsePayload(t *testing.T) {
+	workspaceID := uuid.New()
+	mapID := uuid.New()
+	tests := []struct {
+		payload   string
+		workspace uuid.UUID
+		mapID     uuid.UUID
+		ok        bool
+	}{
+		{workspaceID.String() + ":" + mapID.String(), workspaceID, mapID, true},
+		// sent before migration 13
+		{workspaceID.String(), workspaceID, uuid.Nil, true},
+		{workspaceID.String() + ":nope", workspaceID, uuid.Nil, false},
+		{"nope:" + mapID.String(), uuid.Nil, uuid.Nil, false},
+		{"", uuid.Nil, uuid.Nil, false},
+	}
+	for _, test := range tests {
+		workspace, mapID, err := parsePayload(test.payload)
+		if (err == nil) != test.ok {
+			t.Errorf("parsePayload(%q) error = %v, want ok %v", test.payload, err, test.ok)
+			continue
+		}
+		if test.ok && (workspace != test.workspace || mapID != test.mapID) {
+			t.Errorf("parsePayload(%q) = %v, %v, want %v, %v", test.payload, workspace, mapID, test.workspace, test.mapID)
+		}
+	}
+}
+
+func TestBrokerNotify(t *testing.T) {
+	b := NewBroker(nil)
+	workspaceID := uuid.New()
+	wake := b.subscribe(workspaceID)
+	other := b.subscribe(uuid.New())
+
+	// wake-ups are coalesced, notifying twice must not block
+	b.notify(workspaceID)
+	b.notify(workspaceID)
+	select {
+	case <-wake:
+	default:
+		t.Fatal("subscriber wasn't woken up")
+	}
+	select {
+	case <-wake:
+		t.Fatal("subscriber was woken up twice")
+	case <-other:
+		t.Fatal("subscriber of another workspace was woken up")
+	default:
+	}
+
+	b.unsubscribe(workspaceID, wake)
+	if _, ok := b.subscribers[workspaceID]; ok {
+		t.Fatal("workspace kept after its last subscriber left")
+	}
+	b.notify(workspaceID)
+}
+
+func TestBrokerOnChange(t *testing.T) {
+	b := NewBroker(nil)
+	workspaceID := uuid.New()
+	mapID := uuid.New()
+	var got []uuid.UUID
+	b.OnChange(func(workspace uuid.UUID, changed uuid.UUID) {
+		if workspace == workspaceID {
+			got = append(got, changed)
+		}
+	})
+	b.changed(workspaceID, mapID)
+	if len(got) != 1 || got[0] != mapID {
+		t.Fatalf("OnChange hook got %v, want %v", got, mapID)
+	}
+	b.Close()
+	b.Close()
+}
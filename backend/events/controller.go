@@ -0,0 +1,111 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/echo-backend/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// heartbeat keeps proxies from closing idle streams and doubles as a poll in
+// case a notification was missed
+const heartbeat = 15 * time.Second
+
+type Controller struct {
+	e       *echo.Echo
+	service *Service
+}
+
+func NewController(e *echo.Echo, service *Service) *Controller {
+	c := &Controller{e: e, service: service}
+	e.GET("/events", c.streamEvents)
+	return c
+}
+
+// streamEvents sends the workspace's map, zone and route changes as
+// Server-Sent Events. Clients resume with the Last-Event-ID header (or the
+// last_event_id query parameter), otherwise the stream starts from now.
+// Events span every map of the workspace, so only members may listen.
+func (con *Controller) streamEvents(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || !principal.HasWorkspace() {
+		return auth.NoWorkspaceError()
+	}
+	if !auth.RoleAtLeast(principal.WorkspaceRole, auth.RoleViewer) {
+		return auth.ForbiddenError()
+	}
+
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("last_event_id")
+	}
+	var cursor int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			return InvalidEventIdError()
+		}
+		cursor = id
+	} else {
+		id, err := con.service.getLatestEventId(ctx, principal.WorkspaceID)
+		if err != nil {
+			return err
+		}
+		cursor = id
+	}
+
+	// subscribe before catching up so nothing committed in between is missed
+	wake := con.service.broker.subscribe(principal.WorkspaceID)
+	defer con.service.broker.unsubscribe(principal.WorkspaceID, wake)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		for {
+			events, err := con.service.getEventsSince(ctx, principal.WorkspaceID, cursor)
+			if err != nil {
+				return nil
+			}
+			for _, event := range events {
+				data, err := json.Marshal(event)
+				if err != nil {
+					return nil
+				}
+				if _, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+					return nil
+				}
+				cursor = event.ID
+			}
+			res.Flush()
+			if len(events) < pageSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-con.service.broker.closing:
+			return nil
+		case <-wake:
+		case <-ticker.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
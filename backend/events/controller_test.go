@@ -0,0 +1,142 @@
+package events
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/problem"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeQuerier serves events from memory, any other query panics
+type fakeQuerier struct {
+	db.Querier
+	events []db.MapEvent
+}
+
+func (q *fakeQuerier) GetMapEventsSince(ctx context.Context, arg db.GetMapEventsSinceParams) ([]db.MapEvent, error) {
+	var events []db.MapEvent
+	for _, event := range q.events {
+		if event.WorkspaceID == arg.WorkspaceID && event.ID > arg.ID && len(events) < int(arg.Limit) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (q *fakeQuerier) GetLatestMapEventId(ctx context.Context, workspaceID uuid.UUID) (int64, error) {
+	var latest int64
+	for _, event := range q.events {
+		if event.WorkspaceID == workspaceID {
+			latest = event.ID
+		}
+	}
+	return latest, nil
+}
+
+func (q *fakeQuerier) CreateMapEvent(ctx context.Context, arg db.CreateMapEventParams) error {
+	q.events = append(q.events, db.MapEvent{
+		ID:          int64(len(q.events) + 1),
+		CreatedAt:   time.Now(),
+		WorkspaceID: arg.WorkspaceID,
+		MapID:       arg.MapID,
+		Type:        arg.Type,
+		EntityID:    arg.EntityID,
+		Data:        arg.Data,
+	})
+	return nil
+}
+
+func TestTypeOf(t *testing.T) {
+	if got := TypeOf(EntityZone, ActionUpdated); got != "zone.updated" {
+		t.Fatalf("TypeOf = %q, want zone.updated", got)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	workspaceID := uuid.New()
+	q := &fakeQuerier{}
+	for i, entity := range []string{EntityMap, EntityZone, EntityRoute} {
+		err := Append(context.Background(), q, Event{
+			Type:        TypeOf(entity, ActionCreated),
+			MapID:       uuid.New(),
+			EntityID:    uuid.New(),
+			WorkspaceID: workspaceID,
+			Data:        map[string]int{"n": i},
+		})
+		if err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	Append(context.Background(), q, Event{Type: "map.created", WorkspaceID: uuid.New()})
+
+	broker := NewBroker(nil)
+	// a closed broker ends the stream once it has caught up
+	broker.Close()
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	NewController(e, NewService(q, broker))
+	stream := func(role string, header string, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/events"+query, nil)
+		if header != "" {
+			req.Header.Set("Last-Event-ID", header)
+		}
+		principal := auth.Principal{Kind: auth.KindUser, Subject: "1", WorkspaceID: workspaceID, WorkspaceRole: role}
+		req = req.WithContext(auth.WithPrincipal(req.Context(), principal))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name   string
+		role   string
+		header string
+		query  string
+		status int
+		ids    []string
+	}{
+		{name: "from the start", role: auth.RoleViewer, header: "0", status: http.StatusOK, ids: []string{"1", "2", "3"}},
+		{name: "resumed", role: auth.RoleViewer, header: "2", status: http.StatusOK, ids: []string{"3"}},
+		{name: "resumed from the query", role: auth.RoleViewer, query: "?last_event_id=1", status: http.StatusOK, ids: []string{"2", "3"}},
+		{name: "from now", role: auth.RoleViewer, status: http.StatusOK},
+		{name: "invalid id", role: auth.RoleViewer, header: "abc", status: http.StatusBadRequest},
+		{name: "negative id", role: auth.RoleViewer, header: "-1", status: http.StatusBadRequest},
+		{name: "not a member", role: "", header: "0", status: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := stream(test.role, test.header, test.query)
+			if rec.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			if rec.Header().Get(echo.HeaderContentType) != "text/event-stream" {
+				t.Fatalf("content type = %q", rec.Header().Get(echo.HeaderContentType))
+			}
+			var ids []string
+			for _, line := range strings.Split(rec.Body.String(), "\n") {
+				if id, ok := strings.CutPrefix(line, "id: "); ok {
+					ids = append(ids, id)
+				}
+			}
+			if strings.Join(ids, ",") != strings.Join(test.ids, ",") {
+				t.Fatalf("streamed events %v, want %v", ids, test.ids)
+			}
+		})
+	}
+
+	body := stream(auth.RoleViewer, "2", "").Body.String()
+	if !strings.Contains(body, "event: route.created\n") || !strings.Contains(body, `"data":{"n":2}`) {
+		t.Fatalf("event isn't sent with its type and data: %s", body)
+	}
+}
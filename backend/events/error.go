@@ -0,0 +1,25 @@
+package events
+
+import (
+	"net/http"
+
+	"example.com/echo-backend/problem"
+)
+
+type CustomError = problem.Error
+
+func InternalServerError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusInternalServerError
+	err.Code = "internal_error"
+	err.Message = "Internal Server Error, try again"
+	return &err
+}
+
+func InvalidEventIdError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_event_id"
+	err.Message = "Last-Event-ID must be the id of an event"
+	return &err
+}
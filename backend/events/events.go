@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+)
+
+const (
+	EntityMap   = "map"
+	EntityZone  = "zone"
+	EntityRoute = "route"
+
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+)
+
+// TypeOf names an event after what changed, e.g. "zone.updated"
+func TypeOf(entity string, action string) string {
+	return entity + "." + action
+}
+
+// Event is one change written to the outbox
+type Event struct {
+	Type        string
+	MapID       uuid.UUID
+	EntityID    uuid.UUID
+	WorkspaceID uuid.UUID
+	Data        interface{}
+}
+
+// Append writes event to the outbox. Pass queries bound to the transaction
+// making the change so the event is only visible once the change commits.
+func Append(ctx context.Context, q db.Querier, event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	return q.CreateMapEvent(ctx, db.CreateMapEventParams{
+		WorkspaceID: event.WorkspaceID,
+		MapID:       event.MapID,
+		Type:        event.Type,
+		EntityID:    event.EntityID,
+		Data:        data,
+	})
+}
+
+// EventRes is an outbox entry as sent to clients
+type EventRes struct {
+	ID        int64           `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Type      string          `json:"type"`
+	MapID     uuid.UUID       `json:"map_id"`
+	EntityID  uuid.UUID       `json:"entity_id"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func toEventRes(row db.MapEvent) EventRes {
+	return EventRes{
+		ID:        row.ID,
+		CreatedAt: row.CreatedAt,
+		Type:      row.Type,
+		MapID:     row.MapID,
+		EntityID:  row.EntityID,
+		Data:      json.RawMessage(row.Data),
+	}
+}
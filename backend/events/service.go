@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("example.com/echo-backend/events")
+
+// events are read in pages of this size when a client catches up
+const pageSize = 500
+
+type Service struct {
+	db     db.Querier
+	broker *Broker
+}
+
+func NewService(db db.Querier, broker *Broker) *Service {
+	service := Service{
+		db:     db,
+		broker: broker,
+	}
+	return &service
+}
+
+func (s *Service) getEventsSince(ctx context.Context, workspaceID uuid.UUID, id int64) ([]EventRes, error) {
+	ctx, span := tracer.Start(ctx, "events.getEventsSince")
+	defer span.End()
+	rows, err := s.db.GetMapEventsSince(ctx, db.GetMapEventsSinceParams{
+		WorkspaceID: workspaceID,
+		ID:          id,
+		Limit:       pageSize,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing map events failed", "err", err)
+		return nil, InternalServerError()
+	}
+	events := make([]EventRes, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, toEventRes(row))
+	}
+	return events, nil
+}
+
+func (s *Service) getLatestEventId(ctx context.Context, workspaceID uuid.UUID) (int64, error) {
+	ctx, span := tracer.Start(ctx, "events.getLatestEventId")
+	defer span.End()
+	id, err := s.db.GetLatestMapEventId(ctx, workspaceID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Reading latest map event failed", "err", err)
+		return 0, InternalServerError()
+	}
+	return id, nil
+}
@@ -0,0 +1,27 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ImageStore checks that the host serving map images answers, any status
+// below 500 means it is up
+func ImageStore(client *http.Client, url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("answered %s", res.Status)
+		}
+		return nil
+	}
+}
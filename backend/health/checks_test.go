@@ -0,0 +1,39 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestImageStore(t *testing.T) {
+	status := http.StatusOK
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method = %s, want HEAD", r.Method)
+		}
+		w.WriteHeader(status)
+	}))
+	defer store.Close()
+
+	check := ImageStore(store.Client(), store.URL)
+	for _, test := range []struct {
+		status int
+		up     bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusNotFound, true},
+		{http.StatusBadGateway, false},
+	} {
+		status = test.status
+		if err := check(context.Background()); (err == nil) != test.up {
+			t.Errorf("check with the store answering %d = %v", test.status, err)
+		}
+	}
+
+	store.Close()
+	if err := check(context.Background()); err == nil {
+		t.Error("check of a stopped store succeeded")
+	}
+}
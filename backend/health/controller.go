@@ -0,0 +1,109 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+	// before startup finished and during shutdown
+	StatusNotReady = "not_ready"
+
+	checkTimeout = 2 * time.Second
+)
+
+// Check reports whether one dependency works
+type Check func(ctx context.Context) error
+
+type Controller struct {
+	e      *echo.Echo
+	checks map[string]Check
+	ready  atomic.Bool
+}
+
+type HealthRes struct {
+	Status string `json:"status"`
+}
+
+type CheckRes struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type ReadinessRes struct {
+	Status string              `json:"status"`
+	Checks map[string]CheckRes `json:"checks,omitempty"`
+}
+
+// NewController serves GET /healthz and GET /readyz, /readyz runs checks and
+// is not ready until SetReady(true)
+func NewController(e *echo.Echo, checks map[string]Check) *Controller {
+	c := &Controller{e: e, checks: checks}
+	e.GET("/healthz", c.healthz)
+	e.GET("/readyz", c.readyz)
+	return c
+}
+
+// SetReady flips readiness, the server turns not ready as soon as it starts
+// shutting down so load balancers stop routing to it
+func (con *Controller) SetReady(ready bool) {
+	con.ready.Store(ready)
+}
+
+// healthz only says the process is alive and serving, it doesn't touch
+// any dependency so a database outage doesn't get the process restarted
+func (con *Controller) healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, HealthRes{Status: StatusOK})
+}
+
+func (con *Controller) readyz(c echo.Context) error {
+	if !con.ready.Load() {
+		return c.JSON(http.StatusServiceUnavailable, ReadinessRes{Status: StatusNotReady})
+	}
+	res := ReadinessRes{Status: StatusOK, Checks: con.runChecks(c.Request().Context())}
+	for _, check := range res.Checks {
+		if check.Status != StatusOK {
+			res.Status = StatusFailing
+			return c.JSON(http.StatusServiceUnavailable, res)
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// runChecks runs every check at once, each with its own timeout
+func (con *Controller) runChecks(ctx context.Context) map[string]CheckRes {
+	results := make(map[string]CheckRes, len(con.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range con.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			start := time.Now()
+			err := check(checkCtx)
+			res := CheckRes{
+				Status:    StatusOK,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				res.Status = StatusFailing
+				res.Error = err.Error()
+			}
+			mu.Lock()
+			results[name] = res
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func get(e *echo.Echo, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestHealthz(t *testing.T) {
+	e := echo.New()
+	// a failing dependency doesn't make the process unhealthy
+	NewController(e, map[string]Check{"database": func(context.Context) error { return errors.New("down") }})
+	rec := get(e, "/healthz")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("healthz = %d, want 200", rec.Code)
+	}
+	var res HealthRes
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.Status != StatusOK {
+		t.Fatalf("healthz body = %s", rec.Body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("ping failed") }
+	tests := []struct {
+		name   string
+		ready  bool
+		checks map[string]Check
+		status int
+		want   string
+		failed string
+	}{
+		{name: "starting", checks: map[string]Check{"database": ok}, status: http.StatusServiceUnavailable, want: StatusNotReady},
+		{name: "all ok", ready: true, checks: map[string]Check{"database": ok, "migrations": ok}, status: http.StatusOK, want: StatusOK},
+		{name: "one failing", ready: true, checks: map[string]Check{"database": failing, "migrations": ok}, status: http.StatusServiceUnavailable, want: StatusFailing, failed: "database"},
+		{name: "no checks", ready: true, status: http.StatusOK, want: StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			NewController(e, test.checks).SetReady(test.ready)
+			rec := get(e, "/readyz")
+			if rec.Code != test.status {
+				t.Fatalf("readyz = %d, want %d", rec.Code, test.status)
+			}
+			var res ReadinessRes
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != test.want {
+				t.Fatalf("status = %s, want %s", res.Status, test.want)
+			}
+			if !test.ready {
+				if res.Checks != nil {
+					t.Fatalf("checks ran before ready: %s", rec.Body)
+				}
+				return
+			}
+			if len(res.Checks) != len(test.checks) {
+				t.Fatalf("checks = %s, want one result per check", rec.Body)
+			}
+			for name, check := range res.Checks {
+				if name == test.failed {
+					if check.Status != StatusFailing || check.Error != "ping failed" {
+						t.Errorf("%s = %+v, want failing", name, check)
+					}
+				} else if check.Status != StatusOK || check.Error != "" {
+					t.Errorf("%s = %+v, want ok", name, check)
+				}
+			}
+		})
+	}
+}
+
+// checks run at once, each bounded by its own timeout
+func TestRunChecks(t *testing.T) {
+	slow := func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("no deadline")
+		}
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+	con := &Controller{checks: map[string]Check{"a": slow, "b": slow, "c": slow}}
+	start := time.Now()
+	results := con.runChecks(context.Background())
+	if elapsed := time.Since(start); elapsed > 140*time.Millisecond {
+		t.Errorf("checks took %v, want them run concurrently", elapsed)
+	}
+	for name, res := range results {
+		if res.Status != StatusOK || res.LatencyMs < 50 {
+			t.Errorf("%s = %+v", name, res)
+		}
+	}
+}
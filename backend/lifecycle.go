@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"example.com/echo-backend/cache"
+	"example.com/echo-backend/config"
+	"example.com/echo-backend/events"
+	"example.com/echo-backend/health"
+	"example.com/echo-backend/maps"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+)
+
+// app is everything that has to be stopped on shutdown
+type app struct {
+	pool        *pgxpool.Pool
+	health      *health.Controller
+	metrics     *http.Server // nil when METRICS_PORT is 0
+	maps        *maps.Controller
+	broker      *events.Broker
+	cache       cache.Cache
+	workers     sync.WaitGroup
+	stopWorkers context.CancelFunc
+	// sends the spans still buffered
+	flushTraces func(context.Context) error
+}
+
+// startWorker runs a background loop until the workers are stopped
+func (a *app) startWorker(ctx context.Context, run func(context.Context)) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		run(ctx)
+	}()
+}
+
+// shutdown turns not ready, drains requests and live clients, stops the
+// metrics server and the workers, closes the pool and cache and flushes
+// traces, giving up on anything still running after the shutdown timeout
+func (a *app) shutdown(e *echo.Echo, cfg config.Config) {
+	a.health.SetReady(false)
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	// event streams never end on their own, so they'd hold up draining
+	a.broker.Close()
+	if err := e.Shutdown(ctx); err != nil {
+		slog.Error("Draining HTTP requests failed", "err", err)
+	}
+	if err := a.maps.Close(ctx); err != nil {
+		slog.Error("Closing live editing clients failed", "err", err)
+	}
+	if a.metrics != nil {
+		if err := a.metrics.Shutdown(ctx); err != nil {
+			slog.Error("Stopping metrics server failed", "err", err)
+		}
+	}
+
+	a.stopWorkers()
+	if err := waitUntil(ctx, a.workers.Wait); err != nil {
+		slog.Error("Stopping background workers failed", "err", err)
+	}
+	// Close waits for every connection to be released
+	if err := waitUntil(ctx, a.pool.Close); err != nil {
+		slog.Error("Closing database pool failed", "err", err)
+	}
+	if closer, ok := a.cache.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Error("Closing cache failed", "err", err)
+		}
+	}
+	if err := a.flushTraces(ctx); err != nil {
+		slog.Error("Flushing traces failed", "err", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// waitUntil runs wait, giving up when ctx is done first
+func waitUntil(ctx context.Context, wait func()) error {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/echo-backend/cache"
+	"example.com/echo-backend/config"
+	"example.com/echo-backend/events"
+	"example.com/echo-backend/health"
+	"example.com/echo-backend/maps"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+)
+
+func TestWaitUntil(t *testing.T) {
+	if err := waitUntil(context.Background(), func() {}); err != nil {
+		t.Fatalf("waitUntil = %v, want nil", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	block := make(chan struct{})
+	defer close(block)
+	if err := waitUntil(ctx, func() { <-block }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waitUntil = %v, want it to give up", err)
+	}
+}
+
+// newTestApp builds an app around a pool that never connects, the pool only
+// dials on first use
+func newTestApp(t *testing.T, e *echo.Echo) *app {
+	t.Helper()
+	pool, err := pgxpool.New(context.Background(), "postgres://127.0.0.1:1/maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &app{
+		pool:        pool,
+		health:      health.NewController(e, nil),
+		maps:        maps.NewController(e, maps.NewService(nil, nil, cache.None{}, 0)),
+		broker:      events.NewBroker(pool),
+		cache:       cache.None{},
+		flushTraces: func(context.Context) error { return nil },
+	}
+	_, a.stopWorkers = context.WithCancel(context.Background())
+	return a
+}
+
+func TestShutdown(t *testing.T) {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	a := newTestApp(t, e)
+	started, release := make(chan struct{}), make(chan struct{})
+	e.GET("/slow", func(c echo.Context) error {
+		close(started)
+		<-release
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	workerStopped := make(chan struct{})
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	a.stopWorkers = stopWorkers
+	a.startWorker(workerCtx, func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerStopped)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Listener = listener
+	go e.Start("")
+	a.health.SetReady(true)
+
+	slow := make(chan int)
+	go func() {
+		res, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		res.Body.Close()
+		slow <- res.StatusCode
+	}()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		a.shutdown(e, config.Config{ShutdownDelay: 10 * time.Millisecond, ShutdownTimeout: 5 * time.Second})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("shutdown finished with a request in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz while shutting down = %d, want 503", rec.Code)
+	}
+
+	close(release)
+	if status := <-slow; status != http.StatusNoContent {
+		t.Fatalf("in-flight request got %d, want it drained with 204", status)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown didn't finish")
+	}
+	select {
+	case <-workerStopped:
+	default:
+		t.Fatal("worker still running after shutdown")
+	}
+	if err := a.pool.Ping(context.Background()); err == nil {
+		t.Fatal("pool still usable after shutdown")
+	}
+}
+
+// a worker that ignores its context doesn't hold shutdown up past the timeout
+func TestShutdownTimeout(t *testing.T) {
+	e := echo.New()
+	a := newTestApp(t, e)
+	stuck := make(chan struct{})
+	defer close(stuck)
+	a.startWorker(context.Background(), func(context.Context) { <-stuck })
+
+	start := time.Now()
+	a.shutdown(e, config.Config{ShutdownTimeout: 50 * time.Millisecond})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("shutdown took %v, want it to give up after the timeout", elapsed)
+	}
+}
@@ -0,0 +1,43 @@
+package limits
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Body caps request bodies at limit bytes. Routes in overrides, keyed like
+// "POST /map", get their own cap instead. Bodies are read up front, the
+// OpenAPI validator reads them whole anyway, so bodies sent without a
+// Content-Length get a 413 too rather than failing to bind.
+func Body(limit int64, overrides map[string]int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Body == nil || req.Body == http.NoBody {
+				return next(c)
+			}
+			max := limit
+			if override, ok := overrides[req.Method+" "+c.Path()]; ok {
+				max = override
+			}
+			if req.ContentLength > max {
+				return BodyTooLargeError(max)
+			}
+			body, err := io.ReadAll(io.LimitReader(req.Body, max+1))
+			if err != nil {
+				slog.DebugContext(req.Context(), "Reading request body failed", "err", err)
+				return BodyUnreadableError()
+			}
+			if int64(len(body)) > max {
+				return BodyTooLargeError(max)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package limits
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/echo-backend/problem"
+	"github.com/labstack/echo/v4"
+)
+
+func TestBody(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	e.Use(Body(10, map[string]int64{"POST /map": 20}))
+	echoBody := func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.Blob(http.StatusOK, echo.MIMEOctetStream, body)
+	}
+	e.POST("/map", echoBody)
+	e.PUT("/map/:id", echoBody)
+	e.GET("/maps", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{name: "within the limit", method: http.MethodPut, target: "/map/1", body: strings.Repeat("a", 10), status: http.StatusOK},
+		{name: "over the limit", method: http.MethodPut, target: "/map/1", body: strings.Repeat("a", 11), status: http.StatusRequestEntityTooLarge},
+		{name: "over the limit without a length", method: http.MethodPut, target: "/map/1", body: strings.Repeat("a", 11), chunked: true, status: http.StatusRequestEntityTooLarge},
+		{name: "upload route", method: http.MethodPost, target: "/map", body: strings.Repeat("a", 20), status: http.StatusOK},
+		{name: "over the upload limit", method: http.MethodPost, target: "/map", body: strings.Repeat("a", 21), status: http.StatusRequestEntityTooLarge},
+		{name: "no body", method: http.MethodGet, target: "/maps", status: http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body io.Reader = http.NoBody
+			if test.body != "" {
+				body = strings.NewReader(test.body)
+			}
+			req := httptest.NewRequest(test.method, test.target, body)
+			if test.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Fatalf("status = %d, want %d", rec.Code, test.status)
+			}
+			if test.status == http.StatusOK && rec.Body.String() != test.body {
+				t.Fatalf("handler read %q, want the whole body", rec.Body)
+			}
+			if test.status != http.StatusRequestEntityTooLarge {
+				return
+			}
+			var res struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.Code != "body_too_large" {
+				t.Fatalf("problem = %s, want body_too_large", rec.Body)
+			}
+		})
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, io.ErrUnexpectedEOF }
+
+func TestBodyUnreadable(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/map/1", failingReader{})
+	err := Body(10, nil)(func(c echo.Context) error { return nil })(e.NewContext(req, httptest.NewRecorder()))
+	if problem.StatusOf(err) != http.StatusBadRequest {
+		t.Fatalf("Body with a failing reader = %v, want 400", err)
+	}
+}
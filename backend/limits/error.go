@@ -0,0 +1,34 @@
+package limits
+
+import (
+	"fmt"
+	"net/http"
+
+	"example.com/echo-backend/problem"
+)
+
+type CustomError = problem.Error
+
+func BodyTooLargeError(limit int64) *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusRequestEntityTooLarge
+	err.Code = "body_too_large"
+	err.Message = fmt.Sprintf("Request body is larger than the %d bytes allowed", limit)
+	return &err
+}
+
+func BodyUnreadableError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "bad_request"
+	err.Message = "Request body could not be read, try again"
+	return &err
+}
+
+func RateLimitedError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusTooManyRequests
+	err.Code = "rate_limited"
+	err.Message = "Too many requests, retry after the Retry-After header"
+	return &err
+}
@@ -0,0 +1,60 @@
+package limits
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"strconv"
+
+	"example.com/echo-backend/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+// Rate allows each caller perSecond requests on average and bursts of up to
+// burst, answering 429 beyond that. identify names the caller, requests it
+// returns "" for aren't counted. Counts are kept per instance.
+func Rate(perSecond float64, burst int, identify func(echo.Context) string, skipper middleware.Skipper) echo.MiddlewareFunc {
+	store := middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+		Rate:  rate.Limit(perSecond),
+		Burst: burst,
+	})
+	// the time until the bucket holds a request again
+	retryAfter := strconv.Itoa(int(math.Max(1, math.Ceil(1/perSecond))))
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+			caller := identify(c)
+			if caller == "" {
+				return next(c)
+			}
+			if allowed, _ := store.Allow(caller); !allowed {
+				slog.DebugContext(c.Request().Context(), "Rate limited", "caller", caller)
+				c.Response().Header().Set("Retry-After", retryAfter)
+				return RateLimitedError()
+			}
+			return next(c)
+		}
+	}
+}
+
+// ByClient identifies callers by IP, see echo.Echo.IPExtractor for when
+// proxy headers are believed
+func ByClient(c echo.Context) string {
+	return c.RealIP()
+}
+
+// ByAPIKey identifies callers by the API key they send, valid or not, so
+// guessing keys is limited too. Only a digest of the key is kept.
+func ByAPIKey(c echo.Context) string {
+	key := c.Request().Header.Get(auth.HeaderApiKey)
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:8])
+}
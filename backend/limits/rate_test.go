@@ -0,0 +1,67 @@
+package limits
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/echo-backend/auth"
+	"example.com/echo-backend/problem"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRate(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	probe := func(c echo.Context) bool { return c.Path() == "/healthz" }
+	e.Use(Rate(0.5, 2, ByClient, probe))
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	e.GET("/maps", ok)
+	e.GET("/healthz", ok)
+
+	get := func(target, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	for i := 0; i < 2; i++ {
+		if rec := get("/maps", "192.0.2.1:1000"); rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d within the burst = %d", i, rec.Code)
+		}
+	}
+	rec := get("/maps", "192.0.2.1:1001")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Fatalf("request over the burst = %d, Retry-After %q, want 429 after 2s", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// other clients and probes have their own budget
+	if rec := get("/maps", "192.0.2.2:1000"); rec.Code != http.StatusNoContent {
+		t.Fatalf("another client = %d, want 204", rec.Code)
+	}
+	if rec := get("/healthz", "192.0.2.1:1000"); rec.Code != http.StatusNoContent {
+		t.Fatalf("probe from a limited client = %d, want 204", rec.Code)
+	}
+}
+
+func TestByAPIKey(t *testing.T) {
+	e := echo.New()
+	identify := func(key string) string {
+		req := httptest.NewRequest(http.MethodGet, "/maps", nil)
+		if key != "" {
+			req.Header.Set(auth.HeaderApiKey, key)
+		}
+		return ByAPIKey(e.NewContext(req, httptest.NewRecorder()))
+	}
+	if got := identify(""); got != "" {
+		t.Errorf("ByAPIKey without a key = %q, want it uncounted", got)
+	}
+	a, b := identify("mk_secret_a"), identify("mk_secret_b")
+	if a == b || a != identify("mk_secret_a") || len(a) != len("key:")+16 {
+		t.Errorf("ByAPIKey = %q and %q", a, b)
+	}
+	if strings.Contains(a, "secret") {
+		t.Error("ByAPIKey keeps the key itself")
+	}
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// setup logs JSON to a buffer for the rest of the test
+func setup(t *testing.T, level string) *bytes.Buffer {
+	t.Helper()
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	var buf bytes.Buffer
+	if err := Setup(&buf, level, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// records decodes the JSON lines logged so far
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		out = append(out, record)
+	}
+	return out
+}
+
+func TestSetup(t *testing.T) {
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	tests := []struct {
+		level, format string
+		ok            bool
+	}{
+		{"info", "text", true},
+		{"DEBUG", "JSON", true},
+		{"warn", "json", true},
+		{"trace", "json", false},
+		{"info", "xml", false},
+	}
+	for _, test := range tests {
+		err := Setup(&bytes.Buffer{}, test.level, test.format)
+		if (err == nil) != test.ok {
+			t.Errorf("Setup(%s, %s) = %v", test.level, test.format, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, "warn", FormatText); err != nil {
+		t.Fatal(err)
+	}
+	slog.Info("hidden")
+	slog.Warn("shown", "map_id", "m")
+	if got := buf.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "level=WARN msg=shown map_id=m") {
+		t.Fatalf("logged %q", got)
+	}
+}
+
+func TestWith(t *testing.T) {
+	buf := setup(t, "info")
+	parent := With(context.Background(), "request_id", "r1")
+	child := With(parent, "map_id", "m1", slog.Int("zones", 3))
+	slog.InfoContext(parent, "parent")
+	slog.InfoContext(child, "child", "extra", true)
+	slog.Info("bare")
+
+	logged := records(t, buf)
+	if len(logged) != 3 {
+		t.Fatalf("logged %d records, want 3", len(logged))
+	}
+	if logged[0]["request_id"] != "r1" || logged[0]["map_id"] != nil {
+		t.Errorf("parent record = %v, want only the request ID", logged[0])
+	}
+	if logged[1]["request_id"] != "r1" || logged[1]["map_id"] != "m1" || logged[1]["zones"] != float64(3) || logged[1]["extra"] != true {
+		t.Errorf("child record = %v", logged[1])
+	}
+	if _, ok := logged[2]["request_id"]; ok {
+		t.Errorf("record without a context = %v", logged[2])
+	}
+}
+
+// loggers derived with With or WithGroup keep adding the context's attributes
+func TestContextHandlerDerived(t *testing.T) {
+	buf := setup(t, "info")
+	ctx := With(context.Background(), "request_id", "r1")
+	slog.Default().With("worker", "purger").WithGroup("g").InfoContext(ctx, "derived", "n", 1)
+	logged := records(t, buf)
+	if len(logged) != 1 || logged[0]["worker"] != "purger" || logged[0]["g"] == nil {
+		t.Fatalf("logged %v", logged)
+	}
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// routes polled by load balancers, only logged at debug
+var quietRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// Middleware logs every request once it is answered and adds the request
+// ID, route and map ID to everything logged with the request context. It
+// must run after middleware.RequestID and before anything that turns
+// errors into responses, so it sees the final status.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+			args := []any{
+				"request_id", c.Response().Header().Get(echo.HeaderXRequestID),
+				"method", req.Method,
+				"route", c.Path(),
+			}
+			if strings.HasPrefix(c.Path(), "/map/") && c.Param("id") != "" {
+				args = append(args, "map_id", c.Param("id"))
+			}
+			ctx := With(req.Context(), args...)
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+			level := slog.LevelInfo
+			if quietRoutes[c.Path()] {
+				level = slog.LevelDebug
+			}
+			// the path is left out, shared links carry their token in it
+			slog.Log(ctx, level, "request",
+				"status", c.Response().Status,
+				"latency_ms", float64(time.Since(start).Microseconds())/1000,
+				"bytes", c.Response().Size,
+			)
+			return nil
+		}
+	}
+}
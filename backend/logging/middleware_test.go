@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/echo-backend/problem"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestMiddleware(t *testing.T) {
+	buf := setup(t, "info")
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	e.Use(middleware.RequestID())
+	e.Use(Middleware())
+	e.GET("/map/:id", func(c echo.Context) error {
+		slog.InfoContext(c.Request().Context(), "loading map")
+		return &problem.Error{Status: http.StatusNotFound, Code: "map_not_found"}
+	})
+	e.GET("/shared/:token", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/healthz", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	for _, target := range []string{"/map/42", "/shared/secret-token", "/healthz"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	logged := records(t, buf)
+	// the handler's record, then one per request, probes only at debug
+	if len(logged) != 3 {
+		t.Fatalf("logged %v, want 3 records", logged)
+	}
+	handler, mapRequest, shared := logged[0], logged[1], logged[2]
+	if handler["msg"] != "loading map" || handler["map_id"] != "42" || handler["request_id"] == "" || handler["request_id"] != mapRequest["request_id"] {
+		t.Errorf("handler record = %v, want the request's attributes", handler)
+	}
+	if mapRequest["msg"] != "request" || mapRequest["route"] != "/map/:id" || mapRequest["method"] != http.MethodGet || mapRequest["status"] != float64(http.StatusNotFound) || mapRequest["latency_ms"] == nil {
+		t.Errorf("request record = %v", mapRequest)
+	}
+	if shared["route"] != "/shared/:token" || shared["map_id"] != nil {
+		t.Errorf("shared record = %v", shared)
+	}
+	if strings.Contains(buf.String(), "secret-token") {
+		t.Errorf("the share token was logged: %s", buf)
+	}
+}
@@ -2,19 +2,39 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
 
+	"example.com/echo-backend/audit"
+	"example.com/echo-backend/auth"
+	"example.com/echo-backend/cache"
+	"example.com/echo-backend/config"
 	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/events"
+	"example.com/echo-backend/health"
+	"example.com/echo-backend/limits"
+	"example.com/echo-backend/logging"
 	"example.com/echo-backend/maps"
+	"example.com/echo-backend/metrics"
+	"example.com/echo-backend/migrations"
+	"example.com/echo-backend/openapi"
+	"example.com/echo-backend/problem"
+	"example.com/echo-backend/tracing"
+	"example.com/echo-backend/webhooks"
+	"example.com/echo-backend/workspaces"
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
@@ -26,33 +46,241 @@ type CustomValidator struct {
 
 func (cv *CustomValidator) Validate(i interface{}) error {
   if err := cv.validator.Struct(i); err != nil {
-    // Optionally, you could return the error to give each route more control over the status code
-    return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+    // reported field by field by problem.Handler
+    return problem.Validation(err)
   }
   return nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "benchmark" {
+		runBenchmark(os.Args[2:])
+		return
+	}
+	cfg, _, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := logging.Setup(os.Stderr, cfg.LogLevel, cfg.LogFormat); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	flushTraces, err := tracing.Setup(ctx, cfg.TracesExporter, cfg.TraceSampleRatio)
+	if err != nil {
+		fatal("Setting up tracing failed", "err", err)
+	}
 	e := echo.New()
-	e.Use(middleware.CORS())
-	injectDependencies(e)
-	log.Println("Server is running on PORT 1323")
-    e.Logger.Fatal(e.Start(":1323"))
+	// startup is logged through slog so JSON logs stay parseable
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = problem.Handler
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins: allowedOrigins(cfg),
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, auth.HeaderApiKey, auth.HeaderWorkspaceID, "If-Match", "If-None-Match", "Last-Event-ID", "traceparent", "tracestate"},
+		ExposeHeaders: []string{"ETag"},
+	}))
+	e.Use(middleware.RequestID())
+	e.Use(tracing.Middleware())
+	e.Use(logging.Middleware())
+	m := metrics.New()
+	e.Use(m.Middleware())
+	e.IPExtractor = ipExtractor(cfg)
+	if cfg.ClientRateLimit > 0 {
+		e.Use(limits.Rate(cfg.ClientRateLimit, cfg.ClientRateBurst, limits.ByClient, isProbe))
+	}
+	if cfg.APIKeyRateLimit > 0 {
+		e.Use(limits.Rate(cfg.APIKeyRateLimit, cfg.APIKeyRateBurst, limits.ByAPIKey, isProbe))
+	}
+	e.Use(limits.Body(int64(cfg.MaxBodyBytes), uploadLimits(cfg)))
+	a := injectDependencies(e, cfg, m)
+	a.flushTraces = flushTraces
+	e.Server.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+	e.Server.ReadTimeout = cfg.ReadTimeout
+	e.Server.WriteTimeout = cfg.WriteTimeout
+	e.Server.IdleTimeout = cfg.IdleTimeout
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- e.Start(cfg.Address())
+	}()
+	if cfg.MetricsPort != 0 {
+		a.metrics = metrics.NewServer(cfg.MetricsAddress(), m)
+		go func() {
+			if err := a.metrics.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	}
+	a.health.SetReady(true)
+	slog.Info("Server is running", "port", cfg.Port)
+
+	failed := false
+	select {
+	case err := <-serverErr:
+		slog.Error("Server failed", "err", err)
+		failed = true
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+	}
+	// a second signal kills the process right away
+	stop()
+	a.shutdown(e, cfg)
+	if failed {
+		os.Exit(1)
+	}
 }
 
-// use godot package to load/read the .env file and return the value of the key
-func goDotEnvVariable(key string) string {
-  // load .env file
-  err := godotenv.Load(".env")
-  if err != nil {
-    log.Fatalf("Error loading .env file")
-  }
+// runMigrate is the migrate subcommand, e.g. backend migrate up
+func runMigrate(args []string) {
+	cfg, args, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err == nil {
+		err = cfg.ValidateDatabase()
+	}
+	if err == nil {
+		err = logging.Setup(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := migrations.Run(args, cfg.MigrationsPath, cfg.DatabaseURL, os.Stdout); err != nil {
+		fatal("Migration failed", "err", err)
+	}
+}
+
+// fatal logs an error the server can't run with and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// origins allowed to call the API, defaults to all
+func allowedOrigins(cfg config.Config) []string {
+	if len(cfg.CORSAllowedOrigins) == 0 {
+		return []string{"*"}
+	}
+	return cfg.CORSAllowedOrigins
+}
+
+// routes anyone may call without credentials
+func isPublicRoute(c echo.Context) bool {
+	return strings.HasPrefix(c.Path(), "/shared/") || c.Path() == "/openapi.json" ||
+		c.Path() == "/healthz" || c.Path() == "/readyz"
+}
+
+// probes come from the load balancer, they aren't rate limited
+func isProbe(c echo.Context) bool {
+	return c.Path() == "/healthz" || c.Path() == "/readyz"
+}
 
-  return os.Getenv(key)
+// ipExtractor only believes X-Forwarded-For from the trusted proxies, anyone
+// else could set it to dodge the per-client rate limit
+func ipExtractor(cfg config.Config) echo.IPExtractor {
+	if len(cfg.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range cfg.TrustedProxies {
+		// already validated
+		_, ipRange, _ := net.ParseCIDR(proxy)
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// the routes whose bodies carry map images get the larger upload limit
+func uploadLimits(cfg config.Config) map[string]int64 {
+	limit := int64(cfg.MaxUploadBytes)
+	return map[string]int64{
+		"POST /map":      limit,
+		"PUT /map/:id":   limit,
+		"PATCH /map/:id": limit,
+		"POST /sync":     limit,
+	}
+}
+
+func jwtConfig(cfg config.Config) auth.JWTConfig {
+	return auth.JWTConfig{
+		Secret: []byte(cfg.JWTSecret),
+		Issuer: cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+	}
+}
+
+// readinessChecks are the dependencies GET /readyz checks, errors are logged
+// and only summarised since anyone may call it
+func readinessChecks(cfg config.Config, pool *pgxpool.Pool) map[string]health.Check {
+	latest, err := migrations.Latest(cfg.MigrationsPath)
+	if err != nil {
+		fatal("Reading migrations failed", "err", err)
+	}
+	checks := map[string]health.Check{
+		"database": func(ctx context.Context) error {
+			if err := pool.Ping(ctx); err != nil {
+				slog.WarnContext(ctx, "Readiness: database ping failed", "err", err)
+				return errors.New("ping failed")
+			}
+			return nil
+		},
+		"migrations": func(ctx context.Context) error {
+			if err := migrations.CheckVersion(ctx, pool, latest); err != nil {
+				slog.WarnContext(ctx, "Readiness: schema check failed", "err", err)
+				return errors.New("schema check failed")
+			}
+			return nil
+		},
+	}
+	if cfg.ImageStoreURL != "" {
+		imageStore := health.ImageStore(&http.Client{}, cfg.ImageStoreURL)
+		checks["image_store"] = func(ctx context.Context) error {
+			if err := imageStore(ctx); err != nil {
+				slog.WarnContext(ctx, "Readiness: image store check failed", "err", err)
+				return errors.New("request failed")
+			}
+			return nil
+		}
+	}
+	return checks
+}
+
+// newCache builds the configured cache backend. Redis is not a readiness
+// check, without it every request is a miss but still served.
+func newCache(cfg config.Config) cache.Cache {
+	switch cfg.CacheBackend {
+	case "memory":
+		return cache.NewLRU(cfg.CacheMaxBytes, cfg.CacheTTL)
+	case "redis":
+		redis, err := cache.NewRedis(cfg.RedisURL, cfg.CacheTTL)
+		if err != nil {
+			fatal("Invalid Redis URL", "err", err)
+		}
+		return redis
+	}
+	return cache.None{}
 }
 
 func validatedNumberOfPoints(fl validator.FieldLevel) bool {
-    zones := fl.Field().Interface().([]pgtype.Polygon)
+	var zones []pgtype.Polygon
+	switch field := fl.Field().Interface().(type) {
+	case []pgtype.Polygon:
+		zones = field
+	case []maps.MapZone:
+		for _, zone := range field {
+			zones = append(zones, zone.Polygon)
+		}
+	}
 	// To check for at least 3 points
     for _, zone := range zones {
         if len(zone.P) < 3 {
@@ -68,37 +296,83 @@ func validatedNumberOfPoints(fl validator.FieldLevel) bool {
     return true
 }
 
-func injectDependencies(e *echo.Echo) {
-	dbConnectionString := goDotEnvVariable("REMOTE_DB")
+func injectDependencies(e *echo.Echo, cfg config.Config, m *metrics.Metrics) *app {
 	// Connect to database
-	pool, err := pgxpool.New(context.Background(), dbConnectionString)
+	poolConfig, err := pgxpool.ParseConfig(cfg.DatabaseURL)
+	if err != nil {
+		fatal("Invalid database URL", "err", err)
+	}
+	poolConfig.MaxConns = cfg.DBMaxConns
+	poolConfig.MinConns = cfg.DBMinConns
+	poolConfig.ConnConfig.ConnectTimeout = cfg.DBConnectTimeout
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer(m.QueryTracer())
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
-		panic(err)
+		fatal("Connecting to database failed", "err", err)
+	}
+	slog.Info("Connected to database")
+	// migrations only run through `backend migrate`, never on startup
+	if err := migrations.Verify(cfg.MigrationsPath, cfg.DatabaseURL); err != nil {
+		fatal("Database schema check failed", "err", err)
 	}
-	log.Println("Connected to database")
 
 	// Create new instance of querier, service and controller
 	queries := db.New(pool)
-	mapService := maps.NewService(queries)
-	maps.NewController(e, mapService)
-
-	// Database Migrations
-	m, err := migrate.New(
-		"file://db/migration",
-		dbConnectionString)
+	totals := metrics.NewTotals(queries)
+	m.Register(metrics.Pool(pool), totals)
+	authService := auth.NewService(queries, jwtConfig(cfg))
+	e.Use(auth.Middleware(authService, isPublicRoute))
+	e.Use(audit.Middleware())
+	doc, err := openapi.Load()
 	if err != nil {
-		log.Println(err)
+		fatal("Invalid OpenAPI document", "err", err)
 	}
-	if err := m.Force(1); err != nil {
-		log.Println(err)
+	validateRequests, err := openapi.Middleware(doc)
+	if err != nil {
+		fatal("Building OpenAPI router failed", "err", err)
 	}
-	if err := m.Up(); err != nil {
-		log.Println(err)
+	e.Use(validateRequests)
+	if err := openapi.NewController(e, doc); err != nil {
+		fatal("Serving OpenAPI document failed", "err", err)
 	}
-	
+	a := &app{pool: pool, health: health.NewController(e, readinessChecks(cfg, pool)), cache: newCache(cfg)}
+	auth.NewController(e, authService)
+	workspaces.NewController(e, workspaces.NewService(queries, pool))
+	auditService := audit.NewService(queries)
+	mapService := maps.NewService(queries, pool, a.cache, cfg.MaxImageBytes)
+	a.maps = maps.NewController(e, mapService)
+	audit.NewController(e, auditService, mapService)
+	a.broker = events.NewBroker(pool)
+	// changes made through any instance reach the people editing the map live here
+	a.broker.OnChange(a.maps.MapChanged)
+	events.NewController(e, events.NewService(queries, a.broker))
+	webhooks.NewController(e, webhooks.NewService(queries, cfg.WebhookAllowPrivate))
+	dispatcher := webhooks.NewDispatcher(queries, webhooks.NewClient(cfg.WebhookTimeout, cfg.WebhookAllowPrivate))
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	a.stopWorkers = stopWorkers
+	a.startWorker(workerCtx, func(ctx context.Context) {
+		mapService.RunTrashPurger(ctx, cfg.TrashRetention, time.Hour)
+	})
+	a.startWorker(workerCtx, a.broker.Run)
+	a.startWorker(workerCtx, func(ctx context.Context) {
+		dispatcher.Run(ctx, 5*time.Second)
+	})
+	a.startWorker(workerCtx, func(ctx context.Context) {
+		totals.Run(ctx, time.Minute)
+	})
+
 	// Validations
 	v := validator.New()
 	v.RegisterValidation("numberOfPoints", validatedNumberOfPoints)
+	// name fields in errors the way clients send them
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
 	e.Validator = &CustomValidator{validator: v}
-
+	return a
 }
\ No newline at end of file
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/echo-backend/config"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+)
+
+// readiness answers say which dependency failed, never why, the details
+// only go to the log
+func TestReadinessChecks(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "postgres://secret-user@127.0.0.1:1/maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	cfg := config.Default()
+	cfg.MigrationsPath = "db/migration"
+	cfg.ImageStoreURL = "http://127.0.0.1:1/images"
+	checks := readinessChecks(cfg, pool)
+
+	want := map[string]string{
+		"database":    "ping failed",
+		"migrations":  "schema check failed",
+		"image_store": "request failed",
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("checks = %v, want %d", checks, len(want))
+	}
+	for name, message := range want {
+		err := checks[name](context.Background())
+		if err == nil || err.Error() != message {
+			t.Errorf("%s = %v, want %q", name, err, message)
+		}
+	}
+
+	cfg.ImageStoreURL = ""
+	if _, ok := readinessChecks(cfg, pool)["image_store"]; ok {
+		t.Error("image store checked without an image store URL")
+	}
+}
+
+// X-Forwarded-For is only believed from the trusted proxies
+func TestIPExtractor(t *testing.T) {
+	cfg := config.Default()
+	tests := []struct {
+		proxies    []string
+		remoteAddr string
+		want       string
+	}{
+		{nil, "10.0.0.5:1000", "10.0.0.5"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.5:1000", "203.0.113.7"},
+		{[]string{"10.0.0.0/8"}, "198.51.100.1:1000", "198.51.100.1"},
+		// a private address isn't trusted unless it is listed
+		{[]string{"10.0.0.0/8"}, "192.168.0.1:1000", "192.168.0.1"},
+	}
+	for _, test := range tests {
+		cfg.TrustedProxies = test.proxies
+		req := httptest.NewRequest(http.MethodGet, "/maps", nil)
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+		if got := ipExtractor(cfg)(req); got != test.want {
+			t.Errorf("proxies %v, request from %s: client = %s, want %s", test.proxies, test.remoteAddr, got, test.want)
+		}
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	cfg := config.Default()
+	limits := uploadLimits(cfg)
+	for _, route := range []string{"POST /map", "PUT /map/:id", "PATCH /map/:id", "POST /sync"} {
+		if limits[route] != int64(cfg.MaxUploadBytes) {
+			t.Errorf("%s = %d, want the upload limit", route, limits[route])
+		}
+	}
+	if _, ok := limits["POST /webhooks"]; ok {
+		t.Error("webhooks get the upload limit")
+	}
+}
+
+func TestIsProbe(t *testing.T) {
+	e := echo.New()
+	for path, want := range map[string]bool{"/healthz": true, "/readyz": true, "/maps": false, "/shared/:token": false} {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		c.SetPath(path)
+		if isProbe(c) != want {
+			t.Errorf("isProbe(%s) = %v, want %v", path, !want, want)
+		}
+		if want && !isPublicRoute(c) {
+			t.Errorf("probe %s needs credentials", path)
+		}
+	}
+}
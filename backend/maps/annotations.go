@@ -0,0 +1,199 @@
+package maps
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"example.com/echo-backend/audit"
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/events"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	OpAdd    = "add"
+	OpUpdate = "update"
+	OpDelete = "delete"
+
+	EntityZone  = "zone"
+	EntityRoute = "route"
+)
+
+// errVersionMismatch rolls back an operation whose map was deleted or changed
+var errVersionMismatch = errors.New("map version mismatch")
+
+// Operation is a single change to one zone or route of a map
+type Operation struct {
+	Op     string          `json:"op" validate:"oneof=add update delete"`
+	Entity string          `json:"entity" validate:"oneof=zone route"`
+	ID     uuid.UUID       `json:"id"`
+	Zone   *pgtype.Polygon `json:"zone,omitempty"`
+	Route  *pgtype.Path    `json:"route,omitempty"`
+}
+
+// getAnnotations returns every zone and route of a map with their ids, plus
+// the map version they belong to
+func (s *Service) getAnnotations(ctx context.Context, id uuid.UUID) ([]db.MapAnnotationsZone, []db.MapAnnotationsRoute, int32, error) {
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return s.loadAnnotations(ctx, workspaceID, id)
+}
+
+// loadAnnotations is getAnnotations for callers without a principal, such as
+// the live rooms resyncing after a change
+func (s *Service) loadAnnotations(ctx context.Context, workspaceID uuid.UUID, id uuid.UUID) ([]db.MapAnnotationsZone, []db.MapAnnotationsRoute, int32, error) {
+	ctx, span := tracer.Start(ctx, "maps.loadAnnotations")
+	defer span.End()
+	mapInfo, err := s.db.GetMapById(ctx, db.GetMapByIdParams{
+		ID:          id,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return nil, nil, 0, dbError(ctx, "GetMapById", err, NotFoundError())
+	}
+	mapID := pgtype.UUID{Bytes: id, Valid: true}
+	zones, err := s.db.GetZoneAnnotationsByMapId(ctx, mapID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing zone annotations failed", "err", err)
+		return nil, nil, 0, InternalServerError()
+	}
+	routes, err := s.db.GetRouteAnnotationsByMapId(ctx, mapID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing route annotations failed", "err", err)
+		return nil, nil, 0, InternalServerError()
+	}
+	return zones, routes, mapInfo.Version, nil
+}
+
+// applyOperation persists op and bumps the map version in the same
+// transaction, failing with a 412 when expected is set and the map has moved
+// on. The returned operation carries the id of the zone or route it touched.
+func (s *Service) applyOperation(ctx context.Context, id uuid.UUID, op Operation, expected pgtype.Int4) (Operation, int32, error) {
+	ctx, span := tracer.Start(ctx, "maps.applyOperation")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return Operation{}, 0, err
+	}
+	// roles can change while a socket is open, so check on every operation
+	if err := s.Authorize(ctx, id.String(), auth.RoleEditor); err != nil {
+		return Operation{}, 0, err
+	}
+	if (op.Op != OpDelete) && ((op.Entity == EntityZone && op.Zone == nil) || (op.Entity == EntityRoute && op.Route == nil)) {
+		return Operation{}, 0, InvalidOperationError()
+	}
+	// Valid comes from the client, a zone or route sent is never NULL
+	if op.Zone != nil {
+		op.Zone = &pgtype.Polygon{P: op.Zone.P, Valid: true}
+	}
+	if op.Route != nil {
+		op.Route = &pgtype.Path{P: op.Route.P, Closed: op.Route.Closed, Valid: true}
+	}
+
+	mapID := pgtype.UUID{Bytes: id, Valid: true}
+	entry := audit.Entry{
+		MapID:       id,
+		WorkspaceID: workspaceID,
+	}
+	var version int32
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		version, err = q.BumpMapVersion(ctx, db.BumpMapVersionParams{
+			ID:              id,
+			WorkspaceID:     workspaceID,
+			ExpectedVersion: expected,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errVersionMismatch
+		}
+		if err != nil {
+			return err
+		}
+
+		switch op.Entity {
+		case EntityZone:
+			entry.EntityType = audit.EntityZone
+			var zone db.MapAnnotationsZone
+			switch op.Op {
+			case OpAdd:
+				entry.Action = audit.ActionCreate
+				zone, err = q.CreateZone(ctx, db.CreateZoneParams{Zone: *op.Zone, MapID: mapID})
+				entry.After = zone.Zone
+			case OpUpdate:
+				entry.Action = audit.ActionUpdate
+				zone, err = q.UpdateZone(ctx, db.UpdateZoneParams{ID: op.ID, MapID: mapID, Zone: *op.Zone})
+				entry.After = zone.Zone
+			case OpDelete:
+				entry.Action = audit.ActionDelete
+				zone, err = q.DeleteZone(ctx, db.DeleteZoneParams{ID: op.ID, MapID: mapID})
+				entry.Before = zone.Zone
+			}
+			op.ID = zone.ID
+		case EntityRoute:
+			entry.EntityType = audit.EntityRoute
+			var route db.MapAnnotationsRoute
+			switch op.Op {
+			case OpAdd:
+				entry.Action = audit.ActionCreate
+				route, err = q.CreateRoute(ctx, db.CreateRouteParams{Route: *op.Route, MapID: mapID})
+				entry.After = route.Route
+			case OpUpdate:
+				entry.Action = audit.ActionUpdate
+				route, err = q.UpdateRoute(ctx, db.UpdateRouteParams{ID: op.ID, MapID: mapID, Route: *op.Route})
+				entry.After = route.Route
+			case OpDelete:
+				entry.Action = audit.ActionDelete
+				route, err = q.DeleteRoute(ctx, db.DeleteRouteParams{ID: op.ID, MapID: mapID})
+				entry.Before = route.Route
+			}
+			op.ID = route.ID
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return AnnotationNotFoundError()
+		}
+		if err != nil {
+			return err
+		}
+		entry.EntityID = op.ID
+		if err := audit.Record(ctx, q, entry); err != nil {
+			return err
+		}
+
+		action := events.ActionCreated
+		if op.Op == OpUpdate {
+			action = events.ActionUpdated
+		} else if op.Op == OpDelete {
+			action = events.ActionDeleted
+		}
+		if op.Entity == EntityZone {
+			zone := op.Zone
+			if op.Op == OpDelete {
+				zone = nil
+			}
+			return emitZoneEvent(ctx, q, action, workspaceID, id, op.ID, zone)
+		}
+		route := op.Route
+		if op.Op == OpDelete {
+			route = nil
+		}
+		return emitRouteEvent(ctx, q, action, workspaceID, id, op.ID, route)
+	})
+	if errors.Is(err, errVersionMismatch) {
+		return Operation{}, 0, s.versionConflict(ctx, id, workspaceID)
+	}
+	customErr := &CustomError{}
+	if errors.As(err, &customErr) {
+		return Operation{}, 0, customErr
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Applying operation failed", "err", err)
+		return Operation{}, 0, MapUpdateError()
+	}
+
+	return op, version, nil
+}
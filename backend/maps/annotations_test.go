@@ -0,0 +1,88 @@
+package maps
+
+import (
+	"encoding/json"
+	"testing"
+
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/dbtest"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestAnnotationsOf(t *testing.T) {
+	zoneID, routeID := uuid.New(), uuid.New()
+	triangle := []pgtype.Vec2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}
+	zones, routes := annotationsOf(db.GetMapWithAnnotationsRow{
+		Zones:    []pgtype.Polygon{{P: triangle}},
+		ZoneIds:  []uuid.UUID{zoneID},
+		Routes:   []pgtype.Path{{P: triangle[:2], Closed: true}},
+		RouteIds: []uuid.UUID{routeID},
+	})
+	if len(zones) != 1 || *zones[0].ID != zoneID || !zones[0].Valid || len(zones[0].P) != 3 {
+		t.Fatalf("zones = %+v", zones)
+	}
+	if len(routes) != 1 || *routes[0].ID != routeID || !routes[0].Valid || !routes[0].Closed || len(routes[0].P) != 2 {
+		t.Fatalf("routes = %+v", routes)
+	}
+
+	// a map without annotations sends empty lists, not null
+	zones, routes = annotationsOf(db.GetMapWithAnnotationsRow{})
+	body, _ := json.Marshal(MapRes{Zones: zones, Routes: routes})
+	var res map[string]json.RawMessage
+	if err := json.Unmarshal(body, &res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res["zones"]) != "[]" || string(res["routes"]) != "[]" {
+		t.Fatalf("empty map = %s", body)
+	}
+}
+
+// the single query returns the same zones and routes as reading them one
+// table at a time
+func TestGetMapWithAnnotations(t *testing.T) {
+	s := newTestService(t)
+	ctx, _ := dbtest.Workspace(t, s.db, "1")
+	triangle := pgtype.Polygon{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}, Valid: true}
+	square := pgtype.Polygon{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 2}, {X: 0, Y: 2}}, Valid: true}
+	route := pgtype.Path{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 3, Y: 3}}, Valid: true}
+	if err := s.createNewMap(ctx, MapCreationReq{
+		Name:   "annotated",
+		Zones:  []MapZone{{Polygon: triangle}, {Polygon: square}},
+		Routes: []MapRoute{{Path: route}},
+	}); err != nil {
+		t.Fatalf("createNewMap: %v", err)
+	}
+	maps, err := s.getMaps(ctx)
+	if err != nil || len(maps) != 1 {
+		t.Fatalf("getMaps = %v, %v", maps, err)
+	}
+	id := maps[0].ID
+
+	doc, err := s.getMapWithAnnotations(ctx, id.String())
+	if err != nil {
+		t.Fatalf("getMapWithAnnotations: %v", err)
+	}
+	zones, routes, version, err := s.getAnnotations(ctx, id)
+	if err != nil {
+		t.Fatalf("getAnnotations: %v", err)
+	}
+	if doc.ID != id || doc.Name != "annotated" || doc.Version != version {
+		t.Fatalf("map = %+v, want version %d", doc, version)
+	}
+	if len(doc.Zones) != len(zones) || len(doc.Routes) != len(routes) || len(doc.Zones) != 2 || len(doc.Routes) != 1 {
+		t.Fatalf("map has %d zones and %d routes, want 2 and 1", len(doc.Zones), len(doc.Routes))
+	}
+	points := map[uuid.UUID]int{}
+	for _, zone := range zones {
+		points[zone.ID] = len(zone.Zone.P)
+	}
+	for _, zone := range doc.Zones {
+		if zone.ID == nil || points[*zone.ID] != len(zone.P) {
+			t.Errorf("zone %v doesn't match its row", zone.ID)
+		}
+	}
+	if *doc.Routes[0].ID != routes[0].ID || len(doc.Routes[0].P) != 2 {
+		t.Errorf("route = %+v, want %+v", doc.Routes[0], routes[0])
+	}
+}
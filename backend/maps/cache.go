@@ -0,0 +1,164 @@
+package maps
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// cachedMap is a map already encoded the way GET /map/:id sends it, so hits
+// skip both the query and the encoding. The version comes along for ETags.
+type cachedMap struct {
+	version int32
+	body    []byte
+}
+
+// every change bumps the map version, so an entry never goes stale and one
+// written by a slow read after a change is simply never looked up
+func mapCacheKey(workspaceID uuid.UUID, id uuid.UUID, version int32) string {
+	return "map:" + workspaceID.String() + ":" + id.String() + ":" + strconv.Itoa(int(version))
+}
+
+// an SVG only depends on the map version, so its entries never go stale
+func svgCacheKey(id uuid.UUID, version int32) string {
+	return "map.svg:" + id.String() + ":" + strconv.Itoa(int(version))
+}
+
+// entries are the version as 4 big endian bytes followed by the body
+func (m cachedMap) encode() []byte {
+	value := make([]byte, 4, 4+len(m.body))
+	binary.BigEndian.PutUint32(value, uint32(m.version))
+	return append(value, m.body...)
+}
+
+func decodeCachedMap(value []byte) (cachedMap, bool) {
+	if len(value) < 4 {
+		return cachedMap{}, false
+	}
+	return cachedMap{
+		version: int32(binary.BigEndian.Uint32(value)),
+		body:    value[4:],
+	}, true
+}
+
+// loadMap reads a map with its zones and routes through the cache, keyed by
+// the version a quick lookup finds
+func (s *Service) loadMap(ctx context.Context, workspaceID uuid.UUID, id uuid.UUID) (cachedMap, error) {
+	ctx, span := tracer.Start(ctx, "maps.loadMap")
+	defer span.End()
+	version, err := s.db.GetMapVersion(ctx, db.GetMapVersionParams{
+		ID:          id,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return cachedMap{}, dbError(ctx, "GetMapVersion", err, NotFoundError())
+	}
+	if value, ok := s.cache.Get(ctx, mapCacheKey(workspaceID, id, version)); ok {
+		if cached, ok := decodeCachedMap(value); ok {
+			span.SetAttributes(attribute.Bool("cache.hit", true))
+			return cached, nil
+		}
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+
+	// a single query, so zones and routes are a consistent snapshot of one
+	// map version
+	row, err := s.db.GetMapWithAnnotations(ctx, db.GetMapWithAnnotationsParams{
+		ID:          id,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return cachedMap{}, dbError(ctx, "GetMapWithAnnotations", err, NotFoundError())
+	}
+	zones, routes := annotationsOf(row)
+	body, err := json.Marshal(toMapRes(row.Map, zones, routes))
+	if err != nil {
+		slog.ErrorContext(ctx, "Encoding map failed", "err", err)
+		return cachedMap{}, InternalServerError()
+	}
+	// the map may have changed since the lookup, the entry goes under the
+	// version that was read
+	cached := cachedMap{version: row.Map.Version, body: body}
+	s.cache.Set(ctx, mapCacheKey(workspaceID, id, row.Map.Version), cached.encode())
+	return cached, nil
+}
+
+func annotationsOf(row db.GetMapWithAnnotationsRow) ([]MapZone, []MapRoute) {
+	zones := make([]MapZone, 0, len(row.Zones))
+	for i, zone := range row.Zones {
+		zones = append(zones, MapZone{
+			ID:      &row.ZoneIds[i],
+			Polygon: pgtype.Polygon{P: zone.P, Valid: true},
+		})
+	}
+	routes := make([]MapRoute, 0, len(row.Routes))
+	for i, route := range row.Routes {
+		routes = append(routes, MapRoute{
+			ID:   &row.RouteIds[i],
+			Path: pgtype.Path{P: route.P, Closed: route.Closed, Valid: true},
+		})
+	}
+	return zones, routes
+}
+
+// getMapJSON returns the encoded map, see loadMap
+func (s *Service) getMapJSON(ctx context.Context, id string) (cachedMap, error) {
+	ctx, span := tracer.Start(ctx, "maps.getMapJSON")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return cachedMap{}, err
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
+		return cachedMap{}, InvalidUUIDError()
+	}
+	return s.loadMap(ctx, workspaceID, uuid)
+}
+
+// getMapWithAnnotations returns the map with its zones and routes
+func (s *Service) getMapWithAnnotations(ctx context.Context, id string) (MapRes, error) {
+	ctx, span := tracer.Start(ctx, "maps.getMapWithAnnotations")
+	defer span.End()
+	cached, err := s.getMapJSON(ctx, id)
+	if err != nil {
+		return MapRes{}, err
+	}
+	return cached.decode(ctx)
+}
+
+func (m cachedMap) decode(ctx context.Context) (MapRes, error) {
+	res := MapRes{}
+	if err := json.Unmarshal(m.body, &res); err != nil {
+		slog.ErrorContext(ctx, "Decoding cached map failed", "err", err)
+		return MapRes{}, InternalServerError()
+	}
+	return res, nil
+}
+
+// renderSharedSVG renders the shared map as an SVG, cached per map version
+func (s *Service) renderSharedSVG(ctx context.Context, shared sharedMap) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "maps.renderSharedSVG")
+	defer span.End()
+	key := svgCacheKey(shared.mapInfo.ID, shared.doc.version)
+	if svg, ok := s.cache.Get(ctx, key); ok {
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		return svg, nil
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+	doc, err := shared.doc.decode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	svg := []byte(renderSVG(doc.Name, doc.ImageUrl, doc.Zones, doc.Routes))
+	s.cache.Set(ctx, key, svg)
+	return svg, nil
+}
@@ -0,0 +1,166 @@
+package maps
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/echo-backend/auth"
+	"example.com/echo-backend/cache"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/dbtest"
+	"example.com/echo-backend/problem"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMapCacheKey(t *testing.T) {
+	workspaceID, id := uuid.New(), uuid.New()
+	key := mapCacheKey(workspaceID, id, 3)
+	for _, other := range []string{
+		mapCacheKey(workspaceID, id, 4),
+		mapCacheKey(uuid.New(), id, 3),
+		mapCacheKey(workspaceID, uuid.New(), 3),
+		svgCacheKey(id, 3),
+	} {
+		if other == key {
+			t.Errorf("%s is shared", key)
+		}
+	}
+}
+
+func TestCachedMapEncoding(t *testing.T) {
+	for _, m := range []cachedMap{
+		{version: 1, body: []byte(`{"name":"a"}`)},
+		{version: 1 << 30, body: []byte{}},
+	} {
+		got, ok := decodeCachedMap(m.encode())
+		if !ok || got.version != m.version || string(got.body) != string(m.body) {
+			t.Errorf("decode(encode(%v)) = %v, %v", m, got, ok)
+		}
+	}
+	if _, ok := decodeCachedMap([]byte{0, 1}); ok {
+		t.Error("decoded a truncated entry")
+	}
+}
+
+// cacheQuerier serves one map and counts how often its document is read,
+// any other query panics
+type cacheQuerier struct {
+	db.Querier
+	m     db.Map
+	reads int
+}
+
+func (q *cacheQuerier) GetMapVersion(ctx context.Context, arg db.GetMapVersionParams) (int32, error) {
+	if arg.ID != q.m.ID || arg.WorkspaceID != q.m.WorkspaceID {
+		return 0, pgx.ErrNoRows
+	}
+	return q.m.Version, nil
+}
+
+func (q *cacheQuerier) GetMapWithAnnotations(ctx context.Context, arg db.GetMapWithAnnotationsParams) (db.GetMapWithAnnotationsRow, error) {
+	q.reads++
+	return db.GetMapWithAnnotationsRow{Map: q.m}, nil
+}
+
+func TestLoadMap(t *testing.T) {
+	q := &cacheQuerier{m: db.Map{ID: uuid.New(), WorkspaceID: uuid.New(), Name: pgtype.Text{String: "cached", Valid: true}, Version: 1}}
+	s := NewService(q, nil, cache.NewLRU(1<<20, time.Minute), 0)
+	ctx := context.Background()
+
+	load := func(want int32) {
+		t.Helper()
+		got, err := s.loadMap(ctx, q.m.WorkspaceID, q.m.ID)
+		if err != nil {
+			t.Fatalf("loadMap: %v", err)
+		}
+		doc, err := got.decode(ctx)
+		if err != nil || got.version != want || doc.Version != want || doc.Name != q.m.Name.String {
+			t.Fatalf("loadMap = %+v, %v, want version %d", doc, err, want)
+		}
+	}
+	load(1)
+	load(1)
+	if q.reads != 1 {
+		t.Fatalf("read the map %d times, want it cached after the first", q.reads)
+	}
+
+	// a change bumps the version, so the old entry is never looked up again
+	q.m.Version, q.m.Name.String = 2, "renamed"
+	load(2)
+	if q.reads != 2 {
+		t.Fatalf("read the map %d times, want a miss after the change", q.reads)
+	}
+
+	if _, err := s.loadMap(ctx, uuid.New(), q.m.ID); problem.StatusOf(err) != http.StatusNotFound {
+		t.Fatalf("loadMap from another workspace = %v, want 404", err)
+	}
+}
+
+// GET /map/:id answers 304 when the client has the current version
+func TestSendMap(t *testing.T) {
+	doc := cachedMap{version: 3, body: []byte(`{"version":3}`)}
+	tests := []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{"", http.StatusOK},
+		{`"2"`, http.StatusOK},
+		{`"3"`, http.StatusNotModified},
+	}
+	e := echo.New()
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/map/1", nil)
+		if test.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		if err := sendMap(e.NewContext(req, rec), doc); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != test.status || rec.Header().Get("ETag") != `"3"` {
+			t.Errorf("If-None-Match %s: %d with ETag %s, want %d", test.ifNoneMatch, rec.Code, rec.Header().Get("ETag"), test.status)
+		}
+		if test.status == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("304 has a body: %s", rec.Body)
+		}
+	}
+}
+
+// every change made through the service is visible on the next read
+func TestCachedMapAfterChanges(t *testing.T) {
+	pool := dbtest.Pool(t)
+	s := NewService(db.New(pool), pool, cache.NewLRU(1<<20, time.Minute), 1<<20)
+	ctx, _ := dbtest.Workspace(t, s.db, "1")
+	id := createTestMap(t, s, ctx, "before")
+	if _, err := s.getMapJSON(ctx, id.String()); err != nil {
+		t.Fatalf("getMapJSON: %v", err)
+	}
+
+	if _, err := s.updateMap(ctx, MapCreationReq{Name: "after"}, id.String(), pgtype.Int4{}); err != nil {
+		t.Fatalf("updateMap: %v", err)
+	}
+	doc, err := s.getMapWithAnnotations(ctx, id.String())
+	if err != nil || doc.Name != "after" {
+		t.Fatalf("map after the update = %+v, %v", doc, err)
+	}
+
+	triangle := pgtype.Polygon{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}, Valid: true}
+	if _, _, err := s.applyOperation(ctx, id, Operation{Op: OpAdd, Entity: EntityZone, Zone: &triangle}, pgtype.Int4{}); err != nil {
+		t.Fatalf("applyOperation: %v", err)
+	}
+	if doc, err = s.getMapWithAnnotations(ctx, id.String()); err != nil || len(doc.Zones) != 1 {
+		t.Fatalf("map after adding a zone = %+v, %v", doc, err)
+	}
+
+	// a viewer of another workspace doesn't get the cached entry
+	other := dbtest.As(uuid.New(), "1", auth.RoleViewer)
+	if _, err := s.getMapJSON(other, id.String()); problem.StatusOf(err) != http.StatusNotFound {
+		t.Fatalf("getMapJSON from another workspace = %v, want 404", err)
+	}
+}
@@ -1,8 +1,17 @@
 package maps
 
 import (
-	"log"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"time"
+
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/labstack/echo/v4"
 )
@@ -10,40 +19,141 @@ import (
 type Controller struct {
 	e *echo.Echo
 	service *Service
+	hub *Hub
 }
 
 type MapCreationReq struct {
 	Name string `json:"name" validate:"required"`
 	Image_url string `json:"image_url"`
-	Zones []pgtype.Polygon `json:"zones" validate:"numberOfPoints"`
-	Routes []pgtype.Path `json:"routes"`
+	Zones []MapZone `json:"zones" validate:"numberOfPoints"`
+	Routes []MapRoute `json:"routes"`
+}
+
+// MapZone is a zone of a map document. Zones that aren't saved yet have no id.
+type MapZone struct {
+	ID *uuid.UUID `json:"id,omitempty"`
+	pgtype.Polygon
+}
+
+// MapRoute is a route of a map document. Routes that aren't saved yet have no id.
+type MapRoute struct {
+	ID *uuid.UUID `json:"id,omitempty"`
+	pgtype.Path
+}
+
+// LogValue keeps base64 images out of the logs when a request is logged
+func (req MapCreationReq) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", req.Name),
+		slog.String("image_url", imageFingerprint(req.Image_url)),
+		slog.Int("zones", len(req.Zones)),
+		slog.Int("routes", len(req.Routes)),
+	)
+}
+
+// MapRes is a map with its zones and routes
+type MapRes struct {
+	ID uuid.UUID `json:"id"`
+	Name string `json:"name"`
+	ImageUrl string `json:"image_url"`
+	Version int32 `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Zones []MapZone `json:"zones"`
+	Routes []MapRoute `json:"routes"`
+}
+
+// MapSummaryRes is a map in a list, without its zones and routes
+type MapSummaryRes struct {
+	ID uuid.UUID `json:"id"`
+	Name string `json:"name"`
+	ImageUrl string `json:"image_url"`
+	Version int32 `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// only set for maps in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func toMapRes(mapInfo db.Map, zones []MapZone, routes []MapRoute) MapRes {
+	return MapRes{
+		ID: mapInfo.ID,
+		Name: mapInfo.Name.String,
+		ImageUrl: mapInfo.ImageUrl.String,
+		Version: mapInfo.Version,
+		CreatedAt: mapInfo.CreatedAt,
+		Zones: zones,
+		Routes: routes,
+	}
+}
+
+func toMapSummaries(rows []db.Map) []MapSummaryRes {
+	maps := make([]MapSummaryRes, 0, len(rows))
+	for _, row := range rows {
+		summary := MapSummaryRes{
+			ID: row.ID,
+			Name: row.Name.String,
+			ImageUrl: row.ImageUrl.String,
+			Version: row.Version,
+			CreatedAt: row.CreatedAt,
+		}
+		if row.DeletedAt.Valid {
+			summary.DeletedAt = &row.DeletedAt.Time
+		}
+		maps = append(maps, summary)
+	}
+	return maps
 }
 
 
 func NewController(e *echo.Echo, service *Service) *Controller {
-	c:= &Controller{e: e, service: service}
+	c:= &Controller{e: e, service: service, hub: NewHub(service)}
 	e.POST("/map", c.createMap)
 	e.GET("/maps", c.getMaps)
+	e.GET("/maps/trash", c.getTrashedMaps)
 	e.GET("/map/:id", c.getMapById)
 	e.PUT("/map/:id", c.updateMap)
+	e.PATCH("/map/:id", c.patchMap)
 	e.DELETE("/map/:id", c.deleteMap)
+	e.POST("/map/:id/restore", c.restoreMap)
+	e.GET("/map/:id/live", c.live)
+	e.GET("/map/:id/collaborators", c.getCollaborators)
+	e.PUT("/map/:id/collaborators/:subject", c.grantRole)
+	e.DELETE("/map/:id/collaborators/:subject", c.revokeRole)
+	e.POST("/map/:id/share", c.createShareLink)
+	e.GET("/map/:id/shares", c.getShareLinks)
+	e.DELETE("/map/:id/shares/:shareId", c.revokeShareLink)
+	e.GET("/sync", c.getSync)
+	e.POST("/sync", c.applySync)
+	e.GET("/shared/:token", c.getSharedMap)
+	e.GET("/shared/:token/image", c.getSharedMapImage)
+	e.GET("/shared/:token/svg", c.getSharedMapSVG)
 	return c
 }
 
+// Close disconnects the live editing clients, see Hub.Close
+func (con *Controller) Close(ctx context.Context) error {
+	return con.hub.Close(ctx)
+}
+
+// MapChanged resyncs the live editing clients of a map, see Hub.MapChanged
+func (con *Controller) MapChanged(workspaceID uuid.UUID, mapID uuid.UUID) {
+	con.hub.MapChanged(workspaceID, mapID)
+}
+
 func (con *Controller) createMap(c echo.Context) error {
 	ctx := c.Request().Context()
+	if err := con.service.AuthorizeWorkspace(ctx, auth.RoleEditor); err != nil {
+		return err
+	}
 	req := MapCreationReq{}
-	log.Println(req)
 	if err := c.Bind(&req); err != nil {
-    	return c.JSON(http.StatusBadRequest, BadRequestError())
+    	return BadRequestError()
   	}
 	if err := c.Validate(req); err != nil {
-		log.Println(err)
 		return err
 	}
 
 	if err := con.service.createNewMap(ctx, req); err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return err
 	}
 	return c.String(http.StatusOK, "Created new map successfully")
 }
@@ -51,59 +161,292 @@ func (con *Controller) createMap(c echo.Context) error {
 func (con *Controller) getMapById(c echo.Context) error {
 	ctx := c.Request().Context()
 	id := c.Param("id")
-	zones, err := con.service.getZonesByMapId(ctx, id)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+	if err := con.service.Authorize(ctx, id, auth.RoleViewer); err != nil {
+		return err
 	}
-	routes, err := con.service.getRoutesByMapId(ctx, id)
+	doc, err := con.service.getMapJSON(ctx, id)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return err
 	}
-	mapInfo, err := con.service.getMapById(ctx, id)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+	return sendMap(c, doc)
+}
+
+// sendMap answers with the encoded map, or 304 when the client already has
+// this version
+func sendMap(c echo.Context, doc cachedMap) error {
+	c.Response().Header().Set("ETag", formatETag(doc.version))
+	if notModified(c.Request().Header.Get("If-None-Match"), doc.version) {
+		return c.NoContent(http.StatusNotModified)
 	}
-	res := make(map[string]interface{})
-	res["name"] = mapInfo.Name
-	res["image_url"] = mapInfo.ImageUrl
-	res["zones"] = zones
-	res["routes"] = routes
-	return c.JSON(http.StatusOK, res)
+	return c.JSONBlob(http.StatusOK, doc.body)
 }
 
 func (con *Controller) getMaps(c echo.Context) error {
 	ctx := c.Request().Context()
 	maps, err := con.service.getMaps(ctx)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return err
 	}
-	return c.JSON(http.StatusOK, maps)
+	return c.JSON(http.StatusOK, toMapSummaries(maps))
 }
 
 func (con *Controller) updateMap(c echo.Context) error {
 	ctx := c.Request().Context()
 	id := c.Param("id")
+	if err := con.service.Authorize(ctx, id, auth.RoleEditor); err != nil {
+		return err
+	}
+	expected, err := parseIfMatch(c.Request().Header.Get("If-Match"))
+	if err != nil {
+		return err
+	}
 	req := MapCreationReq{}
 	if err := c.Bind(&req); err != nil {
-    	return c.JSON(http.StatusBadRequest, BadRequestError())
+    	return BadRequestError()
   	}
 	if err := c.Validate(req); err != nil {
-		log.Println(err)
 		return err
 	}
 
-	if err := con.service.updateMap(ctx, req, id); err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+	version, err := con.service.updateMap(ctx, req, id, expected)
+	if err != nil {
+		return con.versionError(c, err)
+	}
+	c.Response().Header().Set("ETag", formatETag(version))
+	return c.String(http.StatusOK, "Updated map successfully")
+}
+
+func (con *Controller) patchMap(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if err := con.service.Authorize(ctx, id, auth.RoleEditor); err != nil {
+		return err
+	}
+	expected, err := parseIfMatch(c.Request().Header.Get("If-Match"))
+	if err != nil {
+		return err
+	}
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return BadRequestError()
+	}
+	contentType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+
+	doc, version, err := con.service.getMapDocument(ctx, id)
+	if err != nil {
+		return err
+	}
+	req, err := applyPatch(doc, contentType, patch)
+	if err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+	// with If-Match: * the patch still has to land on the version it was applied to
+	if !expected.Valid {
+		expected = pgtype.Int4{Int32: version, Valid: true}
+	}
+
+	version, err = con.service.replaceMap(ctx, req, id, expected)
+	if err != nil {
+		return con.versionError(c, err)
 	}
+	c.Response().Header().Set("ETag", formatETag(version))
 	return c.String(http.StatusOK, "Updated map successfully")
 }
 
 func (con *Controller) deleteMap(c echo.Context) error {
 	ctx := c.Request().Context()
 	id := c.Param("id")
+	if err := con.service.Authorize(ctx, id, auth.RoleOwner); err != nil {
+		return err
+	}
+
+	expected, err := parseIfMatch(c.Request().Header.Get("If-Match"))
+	if err != nil {
+		return err
+	}
+
+	if err := con.service.deleteMap(ctx, id, expected); err != nil {
+		return con.versionError(c, err)
+	}
+	return c.String(http.StatusOK, "Moved map to trash successfully")
+}
+
+// versionError also hands back the current ETag on a 412 so clients can
+// reload without another round trip
+func (con *Controller) versionError(c echo.Context, err error) error {
+	customErr := &CustomError{}
+	if errors.As(err, &customErr) && customErr.Status == http.StatusPreconditionFailed {
+		c.Response().Header().Set("ETag", formatETag(customErr.CurrentVersion))
+	}
+	return err
+}
+
+func (con *Controller) getTrashedMaps(c echo.Context) error {
+	ctx := c.Request().Context()
+	maps, err := con.service.getTrashedMaps(ctx)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, toMapSummaries(maps))
+}
+
+func (con *Controller) restoreMap(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if err := con.service.AuthorizeTrashed(ctx, id, auth.RoleOwner); err != nil {
+		return err
+	}
 
-	if err := con.service.deleteMap(ctx, id); err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+	if err := con.service.restoreMap(ctx, id); err != nil {
+		return err
+	}
+	return c.String(http.StatusOK, "Restored map successfully")
+}
+
+func (con *Controller) getCollaborators(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if err := con.service.Authorize(ctx, id, auth.RoleViewer); err != nil {
+		return err
+	}
+
+	collaborators, err := con.service.getCollaborators(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, collaborators)
+}
+
+func (con *Controller) grantRole(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if err := con.service.Authorize(ctx, id, auth.RoleOwner); err != nil {
+		return err
+	}
+	req := RoleGrantReq{}
+	if err := c.Bind(&req); err != nil {
+		return BadRequestError()
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	if err := con.service.grantRole(ctx, id, c.Param("subject"), req.Role); err != nil {
+		return err
+	}
+	return c.String(http.StatusOK, "Granted role successfully")
+}
+
+func (con *Controller) revokeRole(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if err := con.service.Authorize(ctx, id, auth.RoleOwner); err != nil {
+		return err
+	}
+
+	if err := con.service.revokeRole(ctx, id, c.Param("subject")); err != nil {
+		return err
+	}
+	return c.String(http.StatusOK, "Revoked role successfully")
+}
+
+func (con *Controller) createShareLink(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if err := con.service.Authorize(ctx, id, auth.RoleOwner); err != nil {
+		return err
+	}
+	req := ShareLinkCreationReq{}
+	if err := c.Bind(&req); err != nil {
+		return BadRequestError()
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	link, err := con.service.createShareLink(ctx, id, req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, link)
+}
+
+func (con *Controller) getShareLinks(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if err := con.service.Authorize(ctx, id, auth.RoleOwner); err != nil {
+		return err
+	}
+
+	links, err := con.service.getShareLinks(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, links)
+}
+
+func (con *Controller) revokeShareLink(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if err := con.service.Authorize(ctx, id, auth.RoleOwner); err != nil {
+		return err
+	}
+
+	if err := con.service.revokeShareLink(ctx, id, c.Param("shareId")); err != nil {
+		return err
+	}
+	return c.String(http.StatusOK, "Revoked share link successfully")
+}
+
+// the /shared endpoints are public, the token in the path is the only credential
+func (con *Controller) getSharedMap(c echo.Context) error {
+	shared, err := con.service.getSharedMap(c.Request().Context(), c.Param("token"))
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Referrer-Policy", "no-referrer")
+	return sendMap(c, shared.doc)
+}
+
+func (con *Controller) getSharedMapImage(c echo.Context) error {
+	shared, err := con.service.getSharedMap(c.Request().Context(), c.Param("token"))
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Referrer-Policy", "no-referrer")
+	// the image is served from the API origin, it must never be run as a page
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	c.Response().Header().Set("Content-Security-Policy", "default-src 'none'")
+	// linked images aren't followed, a redirect would send anyone with the
+	// link wherever an editor pointed image_url
+	contentType, image, err := decodeDataUrl(shared.mapInfo.ImageUrl.String)
+	if err != nil {
+		slog.WarnContext(c.Request().Context(), "Decoding map image failed", "err", err)
+		return ImageNotFoundError()
+	}
+	return c.Blob(http.StatusOK, contentType, image)
+}
+
+func (con *Controller) getSharedMapSVG(c echo.Context) error {
+	shared, err := con.service.getSharedMap(c.Request().Context(), c.Param("token"))
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Referrer-Policy", "no-referrer")
+	// opened on its own the SVG is a document on the API origin, only the
+	// map's image may load and nothing may run
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	c.Response().Header().Set("Content-Security-Policy", "default-src 'none'; img-src data: http: https:")
+	c.Response().Header().Set("ETag", formatETag(shared.doc.version))
+	if notModified(c.Request().Header.Get("If-None-Match"), shared.doc.version) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	svg, err := con.service.renderSharedSVG(c.Request().Context(), shared)
+	if err != nil {
+		return err
 	}
-	return c.String(http.StatusOK, "Deleted map successfully")
+	return c.Blob(http.StatusOK, "image/svg+xml", svg)
 }
\ No newline at end of file
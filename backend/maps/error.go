@@ -1,65 +1,245 @@
 package maps
 
-import "net/http"
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 
-type CustomError struct {
-	Code int
-	Message string
-}
-
-func (e *CustomError) Error() string {
-	return e.Message
-}
+	"example.com/echo-backend/problem"
+	"github.com/jackc/pgx/v5"
+)
 
-func (e *CustomError) ErrCode() int {
-	return e.Code
-}
+type CustomError = problem.Error
 
 func InvalidUUIDError() (*CustomError) {
 	err := CustomError{}
-	err.Code = http.StatusNotAcceptable
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_uuid"
 	err.Message = "Invalid UUID format"
 	return &err
 }
 
 func NotFoundError() (*CustomError) {
 	err := CustomError{}
-	err.Code = http.StatusNotFound
+	err.Status = http.StatusNotFound
+	err.Code = "map_not_found"
 	err.Message = "UUID not found"
 	return &err
 }
 
 func InternalServerError() (*CustomError) {
 	err := CustomError{}
-	err.Code = http.StatusInternalServerError
+	err.Status = http.StatusInternalServerError
+	err.Code = "internal_error"
 	err.Message = "Internal Server Error, try again"
 	return &err
 }
 
 func BadRequestError() (*CustomError) {
 	err := CustomError{}
-	err.Code = http.StatusBadRequest
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_body"
 	err.Message = "Bad Request Body, try again"
 	return &err
 }
 
-func MapCreationError() (*CustomError) {
-	err := CustomError{}
-	err.Code = http.StatusBadRequest
-	err.Message = "Error creating map, try again"
-	return &err
-}
-
 func MapUpdateError() (*CustomError) {
 	err := CustomError{}
-	err.Code = http.StatusInternalServerError
+	err.Status = http.StatusInternalServerError
+	err.Code = "map_update_failed"
 	err.Message = "Error updating map, try again"
 	return &err
 }
 
 func MapDeletionError() (*CustomError) {
 	err := CustomError{}
-	err.Code = http.StatusInternalServerError
+	err.Status = http.StatusInternalServerError
+	err.Code = "map_deletion_failed"
 	err.Message = "Error deleting map, try again"
 	return &err
-}
\ No newline at end of file
+}
+
+func MapRestoreError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusInternalServerError
+	err.Code = "map_restore_failed"
+	err.Message = "Error restoring map, try again"
+	return &err
+}
+
+func NoWorkspaceError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "no_workspace"
+	err.Message = "Select a workspace with the X-Workspace-ID header"
+	return &err
+}
+
+func ForbiddenError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusForbidden
+	err.Code = "forbidden"
+	err.Message = "Not allowed to perform this action on the map"
+	return &err
+}
+
+func RoleUpdateError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusInternalServerError
+	err.Code = "role_update_failed"
+	err.Message = "Error updating collaborators, try again"
+	return &err
+}
+
+func LastOwnerError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusConflict
+	err.Code = "last_map_owner"
+	err.Message = "A map must keep at least one owner"
+	return &err
+}
+
+func InvalidExpiryError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_expiry"
+	err.Message = "Share links must expire in the future and within a year"
+	return &err
+}
+
+func ShareLinkNotFoundError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusNotFound
+	err.Code = "share_link_not_found"
+	err.Message = "Share link not found, expired or revoked"
+	return &err
+}
+
+func ImageNotFoundError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusNotFound
+	err.Code = "image_not_found"
+	err.Message = "Map has no image"
+	return &err
+}
+
+func ImageTooLargeError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusRequestEntityTooLarge
+	err.Code = "image_too_large"
+	err.Message = "Map image is too large, use a smaller image or link to it"
+	return &err
+}
+
+func UnsupportedImageError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusUnsupportedMediaType
+	err.Code = "unsupported_image"
+	err.Message = "Map image must be a base64 PNG, JPEG, GIF or WebP data URL, or a link"
+	return &err
+}
+
+func PreconditionRequiredError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusPreconditionRequired
+	err.Code = "precondition_required"
+	err.Message = "Send the map ETag in the If-Match header"
+	return &err
+}
+
+func InvalidIfMatchError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_if_match"
+	err.Message = "If-Match must be the map ETag or *"
+	return &err
+}
+
+func StaleVersionError(current int32) (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusPreconditionFailed
+	err.Code = "stale_version"
+	err.Message = "Map was changed by someone else, reload it and try again"
+	err.CurrentVersion = current
+	return &err
+}
+
+func InvalidPatchError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusUnprocessableEntity
+	err.Code = "invalid_patch"
+	err.Message = "Patch could not be applied to the map"
+	return &err
+}
+
+func UnsupportedPatchError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusUnsupportedMediaType
+	err.Code = "unsupported_patch_type"
+	err.Message = "Send the patch as application/json-patch+json or application/merge-patch+json"
+	return &err
+}
+
+func InvalidOperationError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_operation"
+	err.Message = "Operation needs an op of add, update or delete, an entity of zone or route and its geometry"
+	return &err
+}
+
+func AnnotationNotFoundError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusNotFound
+	err.Code = "annotation_not_found"
+	err.Message = "Zone or route not found on this map"
+	return &err
+}
+
+func DuplicateAnnotationError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "duplicate_annotation"
+	err.Message = "A zone or route id appears more than once"
+	return &err
+}
+
+func UnknownMessageError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "unknown_message"
+	err.Message = "Unknown message type"
+	return &err
+}
+
+func InvalidCursorError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_cursor"
+	err.Message = "since must be a cursor returned by GET /sync"
+	return &err
+}
+
+func DatabaseUnavailableError() (*CustomError) {
+	err := CustomError{}
+	err.Status = http.StatusServiceUnavailable
+	err.Code = "database_unavailable"
+	err.Message = "Database is unavailable, try again later"
+	return &err
+}
+
+// dbError logs the real cause of a failed query and picks what the client
+// sees: notFound when there was no row, 503 when the database couldn't be
+// reached in time and 500 for anything else
+func dbError(ctx context.Context, query string, err error, notFound *CustomError) error {
+	if notFound != nil && errors.Is(err, pgx.ErrNoRows) {
+		slog.DebugContext(ctx, "Query found nothing", "query", query)
+		return notFound
+	}
+	slog.ErrorContext(ctx, "Query failed", "query", query, "err", err)
+	if problem.Unavailable(err) {
+		return DatabaseUnavailableError()
+	}
+	return InternalServerError()
+}
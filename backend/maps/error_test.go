@@ -0,0 +1,33 @@
+package maps
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"example.com/echo-backend/problem"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestDbError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		notFound *CustomError
+		status   int
+	}{
+		{"no rows", pgx.ErrNoRows, NotFoundError(), http.StatusNotFound},
+		{"no rows where one was expected", pgx.ErrNoRows, nil, http.StatusInternalServerError},
+		{"unreachable", &pgconn.PgError{Code: "08001"}, NotFoundError(), http.StatusServiceUnavailable},
+		{"timed out", context.DeadlineExceeded, NotFoundError(), http.StatusServiceUnavailable},
+		{"query failed", &pgconn.PgError{Code: "23505"}, NotFoundError(), http.StatusInternalServerError},
+		{"other", errors.New("boom"), nil, http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		if got := dbError(context.Background(), "GetMapById", test.err, test.notFound); problem.StatusOf(got) != test.status {
+			t.Errorf("dbError(%s) = %v, want %d", test.name, got, test.status)
+		}
+	}
+}
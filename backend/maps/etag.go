@@ -0,0 +1,71 @@
+package maps
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// formatETag turns a map version into a strong ETag
+func formatETag(version int32) string {
+	return `"` + strconv.Itoa(int(version)) + `"`
+}
+
+// parseIfMatch reads the expected map version from an If-Match header.
+// "*" matches any version and comes back as an invalid (NULL) Int4.
+func parseIfMatch(header string) (pgtype.Int4, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return pgtype.Int4{}, PreconditionRequiredError()
+	}
+	if header == "*" {
+		return pgtype.Int4{}, nil
+	}
+	// only the first tag is used, clients only ever hold one version
+	tag := strings.TrimSpace(strings.Split(header, ",")[0])
+	tag = strings.TrimPrefix(tag, "W/")
+	version, err := strconv.ParseInt(strings.Trim(tag, `"`), 10, 32)
+	if err != nil {
+		return pgtype.Int4{}, InvalidIfMatchError()
+	}
+	return pgtype.Int4{Int32: int32(version), Valid: true}, nil
+}
+
+// notModified reports whether an If-None-Match header already names the
+// version, in which case a GET answers 304 without a body
+func notModified(header string, version int32) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		// GET uses the weak comparison
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == formatETag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionConflict works out why a conditional write touched no rows: either
+// the map is gone or someone else bumped the version first.
+func (s *Service) versionConflict(ctx context.Context, id uuid.UUID, workspaceID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "maps.versionConflict")
+	defer span.End()
+	current, err := s.db.GetMapVersion(ctx, db.GetMapVersionParams{
+		ID: id,
+		WorkspaceID: workspaceID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotFoundError()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Reading map version failed", "err", err)
+		return InternalServerError()
+	}
+	return StaleVersionError(current)
+}
@@ -0,0 +1,99 @@
+package maps
+
+import (
+	"net/http"
+	"testing"
+
+	"example.com/echo-backend/dbtest"
+	"example.com/echo-backend/problem"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestFormatETag(t *testing.T) {
+	if got := formatETag(7); got != `"7"` {
+		t.Fatalf("formatETag(7) = %s, want \"7\"", got)
+	}
+}
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   pgtype.Int4
+		status int
+	}{
+		{header: `"3"`, want: pgtype.Int4{Int32: 3, Valid: true}},
+		{header: ` "3" `, want: pgtype.Int4{Int32: 3, Valid: true}},
+		{header: `W/"3"`, want: pgtype.Int4{Int32: 3, Valid: true}},
+		{header: `"3", "4"`, want: pgtype.Int4{Int32: 3, Valid: true}},
+		{header: `3`, want: pgtype.Int4{Int32: 3, Valid: true}},
+		{header: `*`, want: pgtype.Int4{}},
+		{header: ``, status: http.StatusPreconditionRequired},
+		{header: `  `, status: http.StatusPreconditionRequired},
+		{header: `"abc"`, status: http.StatusBadRequest},
+		{header: `"99999999999"`, status: http.StatusBadRequest},
+		{header: `W/`, status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		got, err := parseIfMatch(test.header)
+		if test.status != 0 {
+			if problem.StatusOf(err) != test.status {
+				t.Errorf("parseIfMatch(%q) = %v, want %d", test.header, err, test.status)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseIfMatch(%q) = %v, %v, want %v", test.header, got, err, test.want)
+		}
+	}
+	if _, err := parseIfMatch(`"abc"`); problem.From(err).Code != "invalid_if_match" {
+		t.Errorf("parseIfMatch of garbage = %v, want invalid_if_match", err)
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"3"`, true},
+		{`W/"3"`, true},
+		{`"1", "3"`, true},
+		{`*`, true},
+		{`"4"`, false},
+		{`3`, false},
+		{``, false},
+	}
+	for _, test := range tests {
+		if got := notModified(test.header, 3); got != test.want {
+			t.Errorf("notModified(%q, 3) = %v, want %v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestStaleVersion(t *testing.T) {
+	s := newTestService(t)
+	ctx, _ := dbtest.Workspace(t, s.db, "1")
+	id := createTestMap(t, s, ctx, "versioned")
+	m, err := s.getMapById(ctx, id.String())
+	if err != nil {
+		t.Fatalf("getMapById: %v", err)
+	}
+
+	version, err := s.updateMap(ctx, MapCreationReq{Name: "first"}, id.String(), pgtype.Int4{Int32: m.Version, Valid: true})
+	if err != nil {
+		t.Fatalf("updateMap: %v", err)
+	}
+	if version != m.Version+1 {
+		t.Fatalf("version after an update = %d, want %d", version, m.Version+1)
+	}
+	_, err = s.updateMap(ctx, MapCreationReq{Name: "second"}, id.String(), pgtype.Int4{Int32: m.Version, Valid: true})
+	if problem.StatusOf(err) != http.StatusPreconditionFailed {
+		t.Fatalf("updateMap with a stale version = %v, want 412", err)
+	}
+	if err := s.deleteMap(ctx, id.String(), pgtype.Int4{Int32: m.Version, Valid: true}); problem.StatusOf(err) != http.StatusPreconditionFailed {
+		t.Fatalf("deleteMap with a stale version = %v, want 412", err)
+	}
+	if _, err := s.updateMap(ctx, MapCreationReq{Name: "any"}, id.String(), pgtype.Int4{}); err != nil {
+		t.Fatalf("updateMap with If-Match *: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package maps
+
+import (
+	"context"
+
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/events"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// mapEventData leaves out the image, it can be megabytes of base64
+type mapEventData struct {
+	ID      uuid.UUID `json:"id"`
+	Name    string    `json:"name"`
+	Version int32     `json:"version"`
+}
+
+type zoneEventData struct {
+	ID    uuid.UUID       `json:"id"`
+	MapID uuid.UUID       `json:"map_id"`
+	Zone  *pgtype.Polygon `json:"zone,omitempty"`
+}
+
+type routeEventData struct {
+	ID    uuid.UUID    `json:"id"`
+	MapID uuid.UUID    `json:"map_id"`
+	Route *pgtype.Path `json:"route,omitempty"`
+}
+
+func emitMapEvent(ctx context.Context, q db.Querier, action string, mapInfo db.Map) error {
+	return events.Append(ctx, q, events.Event{
+		Type:        events.TypeOf(events.EntityMap, action),
+		MapID:       mapInfo.ID,
+		EntityID:    mapInfo.ID,
+		WorkspaceID: mapInfo.WorkspaceID,
+		Data: mapEventData{
+			ID:      mapInfo.ID,
+			Name:    mapInfo.Name.String,
+			Version: mapInfo.Version,
+		},
+	})
+}
+
+// emitZoneEvent leaves the zone out of deletions
+func emitZoneEvent(ctx context.Context, q db.Querier, action string, workspaceID uuid.UUID, mapID uuid.UUID, id uuid.UUID, zone *pgtype.Polygon) error {
+	return events.Append(ctx, q, events.Event{
+		Type:        events.TypeOf(events.EntityZone, action),
+		MapID:       mapID,
+		EntityID:    id,
+		WorkspaceID: workspaceID,
+		Data:        zoneEventData{ID: id, MapID: mapID, Zone: zone},
+	})
+}
+
+// emitRouteEvent leaves the route out of deletions
+func emitRouteEvent(ctx context.Context, q db.Querier, action string, workspaceID uuid.UUID, mapID uuid.UUID, id uuid.UUID, route *pgtype.Path) error {
+	return events.Append(ctx, q, events.Event{
+		Type:        events.TypeOf(events.EntityRoute, action),
+		MapID:       mapID,
+		EntityID:    id,
+		WorkspaceID: workspaceID,
+		Data:        routeEventData{ID: id, MapID: mapID, Route: route},
+	})
+}
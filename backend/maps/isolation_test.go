@@ -0,0 +1,64 @@
+package maps
+
+import (
+	"net/http"
+	"testing"
+
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/dbtest"
+	"example.com/echo-backend/problem"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// an owner of one workspace must not see or touch the maps of another
+func TestWorkspaceIsolation(t *testing.T) {
+	s := newTestService(t)
+	ctxA, _ := dbtest.Workspace(t, s.db, "1")
+	ctxB, workspaceB := dbtest.Workspace(t, s.db, "2")
+	id := createTestMap(t, s, ctxA, "isolated")
+
+	notFound := map[string]error{}
+	_, notFound["getMapById"] = s.getMapById(ctxB, id.String())
+	_, notFound["getMapJSON"] = s.getMapJSON(ctxB, id.String())
+	_, notFound["getMapWithAnnotations"] = s.getMapWithAnnotations(ctxB, id.String())
+	_, _, notFound["getMapDocument"] = s.getMapDocument(ctxB, id.String())
+	notFound["Authorize"] = s.Authorize(ctxB, id.String(), auth.RoleViewer)
+	notFound["AuthorizeTrashed"] = s.AuthorizeTrashed(ctxB, id.String(), auth.RoleViewer)
+	_, notFound["replaceMap"] = s.replaceMap(ctxB, MapCreationReq{Name: "taken"}, id.String(), pgtype.Int4{})
+	notFound["deleteMap"] = s.deleteMap(ctxB, id.String(), pgtype.Int4{})
+	for name, err := range notFound {
+		if problem.StatusOf(err) != http.StatusNotFound {
+			t.Errorf("%s from another workspace = %v, want 404", name, err)
+		}
+	}
+
+	if maps, err := s.getMaps(ctxB); err != nil || containsMap(maps, id) {
+		t.Errorf("getMaps of another workspace = %v, %v, want the map left out", maps, err)
+	}
+	entries, err := s.db.GetAuditEntries(ctxB, db.GetAuditEntriesParams{
+		WorkspaceID: workspaceB,
+		MapID:       pgtype.UUID{Bytes: id, Valid: true},
+		Limit:       10,
+	})
+	if err != nil || len(entries) != 0 {
+		t.Errorf("audit entries of the map in another workspace = %d, %v, want none", len(entries), err)
+	}
+
+	// a trashed map stays out of reach too
+	if err := s.deleteMap(ctxA, id.String(), pgtype.Int4{}); err != nil {
+		t.Fatalf("deleteMap: %v", err)
+	}
+	if err := s.restoreMap(ctxB, id.String()); problem.StatusOf(err) != http.StatusNotFound {
+		t.Errorf("restoreMap from another workspace = %v, want 404", err)
+	}
+	if trashed, err := s.getTrashedMaps(ctxB); err != nil || containsMap(trashed, id) {
+		t.Errorf("getTrashedMaps of another workspace = %v, %v, want the map left out", trashed, err)
+	}
+	if err := s.restoreMap(ctxA, id.String()); err != nil {
+		t.Fatalf("restoreMap in its own workspace: %v", err)
+	}
+	if m, err := s.getMapById(ctxA, id.String()); err != nil || m.Name.String != "isolated" {
+		t.Fatalf("the map was changed from another workspace: %+v, %v", m, err)
+	}
+}
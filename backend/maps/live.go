@@ -0,0 +1,498 @@
+package maps
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	MessageSnapshot = "snapshot"
+	MessageOp       = "op"
+	MessageSelect   = "select"
+	MessagePresence = "presence"
+	MessageError    = "error"
+
+	liveWriteWait  = 10 * time.Second
+	livePongWait   = 60 * time.Second
+	livePingPeriod = livePongWait * 9 / 10
+	liveMaxMessage = 1 << 20
+	liveSendBuffer = 64
+)
+
+var upgrader = websocket.Upgrader{
+	// auth never comes from cookies, so a cross-origin page can't open a
+	// socket on someone else's behalf
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// liveMessage is every frame sent over the map socket in either direction
+type liveMessage struct {
+	Type       string                   `json:"type"`
+	ClientOpID string                   `json:"client_op_id,omitempty"`
+	Operation  *Operation               `json:"operation,omitempty"`
+	Version    int32                    `json:"version,omitempty"`
+	Actor      string                   `json:"actor,omitempty"`
+	Selection  json.RawMessage          `json:"selection,omitempty"`
+	ClientID   string                   `json:"client_id,omitempty"`
+	Clients    []presence               `json:"clients,omitempty"`
+	Zones      []db.MapAnnotationsZone  `json:"zones,omitempty"`
+	Routes     []db.MapAnnotationsRoute `json:"routes,omitempty"`
+	Error      *CustomError             `json:"error,omitempty"`
+}
+
+type presence struct {
+	ClientID  string          `json:"client_id"`
+	Subject   string          `json:"subject"`
+	Name      string          `json:"name"`
+	Selection json.RawMessage `json:"selection,omitempty"`
+}
+
+// zoneCheck runs a single zone through the same validation as PUT
+type zoneCheck struct {
+	Zones []pgtype.Polygon `validate:"numberOfPoints"`
+}
+
+type liveClient struct {
+	id        string
+	principal auth.Principal
+	conn      *websocket.Conn
+	send      chan []byte
+	// ready is false until the client's snapshot is queued, broadcasts
+	// before that are already part of the snapshot
+	ready     bool
+	selection json.RawMessage
+}
+
+// room holds everyone connected to one map
+type room struct {
+	mapID uuid.UUID
+	// opMu serialises operations so every client sees them in the same order
+	opMu sync.Mutex
+	// the latest map version sent to the room, guarded by opMu
+	version int32
+	mu      sync.Mutex
+	clients map[*liveClient]struct{}
+	// a resync is waiting to run, guarded by mu
+	resyncing bool
+	// operations made outside a socket passing through the room, guarded by
+	// the hub's mu. The room stays open until they are done.
+	pending int
+}
+
+// Hub tracks the open rooms, one per map with at least one connection
+type Hub struct {
+	service *Service
+	mu      sync.Mutex
+	rooms   map[uuid.UUID]*room
+	// set by Close, no one may join after that
+	closing bool
+	// one per connected client, done when it has left
+	clients sync.WaitGroup
+}
+
+func NewHub(service *Service) *Hub {
+	return &Hub{
+		service: service,
+		rooms:   make(map[uuid.UUID]*room),
+	}
+}
+
+// join returns nil once the hub is closing
+func (h *Hub) join(mapID uuid.UUID, client *liveClient) *room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return nil
+	}
+	h.clients.Add(1)
+	r := h.room(mapID)
+	r.mu.Lock()
+	r.clients[client] = struct{}{}
+	r.mu.Unlock()
+	return r
+}
+
+// room returns the map's room, opening it when needed. h.mu must be held.
+func (h *Hub) room(mapID uuid.UUID) *room {
+	r, ok := h.rooms[mapID]
+	if !ok {
+		r = &room{mapID: mapID, clients: make(map[*liveClient]struct{})}
+		h.rooms[mapID] = r
+	}
+	return r
+}
+
+// closeIfEmpty drops the room once nobody is connected and no operation is
+// passing through. h.mu and r.mu must be held.
+func (h *Hub) closeIfEmpty(r *room) {
+	if len(r.clients) == 0 && r.pending == 0 {
+		delete(h.rooms, r.mapID)
+	}
+}
+
+func (h *Hub) leave(r *room, client *liveClient) {
+	h.mu.Lock()
+	r.mu.Lock()
+	delete(r.clients, client)
+	close(client.send)
+	h.closeIfEmpty(r)
+	r.mu.Unlock()
+	h.mu.Unlock()
+	r.broadcastPresence()
+	h.clients.Done()
+}
+
+// Close asks every client to go away and waits for them to leave, clients
+// still connected when ctx is done are cut off. Clients reconnect to another
+// instance and get a fresh snapshot.
+func (h *Hub) Close(ctx context.Context) error {
+	h.mu.Lock()
+	h.closing = true
+	conns := make([]*websocket.Conn, 0)
+	for _, r := range h.rooms {
+		r.mu.Lock()
+		for client := range r.clients {
+			conns = append(conns, client.conn)
+		}
+		r.mu.Unlock()
+	}
+	h.mu.Unlock()
+
+	goingAway := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, conn := range conns {
+		// safe next to the write pump, gorilla allows concurrent control frames
+		conn.WriteControl(websocket.CloseMessage, goingAway, time.Now().Add(liveWriteWait))
+	}
+	left := make(chan struct{})
+	go func() {
+		h.clients.Wait()
+		close(left)
+	}()
+	select {
+	case <-left:
+		return nil
+	case <-ctx.Done():
+		for _, conn := range conns {
+			conn.Close()
+		}
+		return ctx.Err()
+	}
+}
+
+// snapshot queues the current zones and routes for a newly joined client.
+// Holding opMu means no operation lands between the read and the client
+// being marked ready.
+func (r *room) snapshot(ctx context.Context, service *Service, client *liveClient) error {
+	r.opMu.Lock()
+	defer r.opMu.Unlock()
+	zones, routes, version, err := service.getAnnotations(ctx, r.mapID)
+	if err != nil {
+		return err
+	}
+	client.queue(liveMessage{
+		Type:     MessageSnapshot,
+		ClientID: client.id,
+		Version:  version,
+		Zones:    zones,
+		Routes:   routes,
+	})
+	r.version = max(r.version, version)
+	r.mu.Lock()
+	client.ready = true
+	r.mu.Unlock()
+	return nil
+}
+
+// validateOperation runs an operation through the same rules as PUT
+func validateOperation(op Operation, validate func(i interface{}) error) error {
+	if err := validate(op); err != nil {
+		return InvalidOperationError()
+	}
+	if op.Zone != nil {
+		if err := validate(zoneCheck{Zones: []pgtype.Polygon{*op.Zone}}); err != nil {
+			return BadRequestError()
+		}
+	}
+	return nil
+}
+
+func (r *room) apply(ctx context.Context, service *Service, client *liveClient, msg liveMessage, validate func(i interface{}) error) {
+	if msg.Operation == nil {
+		client.queue(liveMessage{Type: MessageError, ClientOpID: msg.ClientOpID, Error: InvalidOperationError()})
+		return
+	}
+	if err := validateOperation(*msg.Operation, validate); err != nil {
+		client.queue(liveMessage{Type: MessageError, ClientOpID: msg.ClientOpID, Error: err.(*CustomError)})
+		return
+	}
+	_, _, err := r.applyOperation(ctx, service, *msg.Operation, pgtype.Int4{}, client.principal.String(), msg.ClientOpID)
+	if err != nil {
+		customErr := InternalServerError()
+		if e, ok := err.(*CustomError); ok {
+			customErr = e
+		}
+		client.queue(liveMessage{Type: MessageError, ClientOpID: msg.ClientOpID, Error: customErr})
+	}
+}
+
+// applyOperation saves op and sends it to everyone in the room
+func (r *room) applyOperation(ctx context.Context, service *Service, op Operation, expected pgtype.Int4, actor string, clientOpID string) (Operation, int32, error) {
+	r.opMu.Lock()
+	defer r.opMu.Unlock()
+	result, version, err := service.applyOperation(ctx, r.mapID, op, expected)
+	if err != nil {
+		return Operation{}, 0, err
+	}
+	r.version = version
+	r.broadcast(liveMessage{
+		Type:       MessageOp,
+		ClientOpID: clientOpID,
+		Operation:  &result,
+		Version:    version,
+		Actor:      actor,
+	})
+	return result, version, nil
+}
+
+// applyOperation saves an operation made outside a socket, passing it through
+// the map's room so people editing it live see it in order. Maps nobody is
+// editing get a room for the length of the operation, so someone joining
+// meanwhile waits for it before their snapshot without holding up other maps.
+func (h *Hub) applyOperation(ctx context.Context, mapID uuid.UUID, op Operation, expected pgtype.Int4, actor string, clientOpID string) (Operation, int32, error) {
+	h.mu.Lock()
+	r := h.room(mapID)
+	r.pending++
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		r.mu.Lock()
+		r.pending--
+		h.closeIfEmpty(r)
+		r.mu.Unlock()
+		h.mu.Unlock()
+	}()
+	return r.applyOperation(ctx, h.service, op, expected, actor, clientOpID)
+}
+
+// MapChanged is called for every change committed to a map by any instance of
+// the server, see events.Broker.OnChange. Rooms catch up on the ones that
+// didn't pass through them, such as a PUT or an edit made on another instance.
+func (h *Hub) MapChanged(workspaceID uuid.UUID, mapID uuid.UUID) {
+	h.mu.Lock()
+	r, ok := h.rooms[mapID]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// changes arriving while one is pending are picked up by it, and rooms
+	// only open for an operation have nobody to tell
+	if r.resyncing || len(r.clients) == 0 {
+		return
+	}
+	r.resyncing = true
+	// the broker's goroutine must not wait on the database
+	go r.resync(h.service, workspaceID)
+}
+
+// resync sends everyone a fresh snapshot when the map has moved past the last
+// version the room saw, and the error when the map is gone
+func (r *room) resync(service *Service, workspaceID uuid.UUID) {
+	r.opMu.Lock()
+	defer r.opMu.Unlock()
+	r.mu.Lock()
+	r.resyncing = false
+	r.mu.Unlock()
+
+	ctx := context.Background()
+	// most changes are the room's own operations, which it has already sent
+	current, err := service.db.GetMapVersion(ctx, db.GetMapVersionParams{ID: r.mapID, WorkspaceID: workspaceID})
+	if err == nil && current <= r.version {
+		return
+	}
+	zones, routes, version, err := service.loadAnnotations(ctx, workspaceID, r.mapID)
+	if err != nil {
+		customErr := InternalServerError()
+		if e, ok := err.(*CustomError); ok {
+			customErr = e
+		}
+		r.broadcast(liveMessage{Type: MessageError, Error: customErr})
+		// a map restored from the trash comes back with a fresh snapshot
+		r.version = 0
+		return
+	}
+	if version <= r.version {
+		return
+	}
+	r.version = version
+	r.broadcast(liveMessage{
+		Type:    MessageSnapshot,
+		Version: version,
+		Zones:   zones,
+		Routes:  routes,
+	})
+}
+
+func (r *room) broadcastPresence() {
+	r.mu.Lock()
+	clients := make([]presence, 0, len(r.clients))
+	for client := range r.clients {
+		clients = append(clients, presence{
+			ClientID:  client.id,
+			Subject:   client.principal.String(),
+			Name:      client.principal.Name,
+			Selection: client.selection,
+		})
+	}
+	r.mu.Unlock()
+	r.broadcast(liveMessage{Type: MessagePresence, Clients: clients})
+}
+
+func (r *room) broadcast(msg liveMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("Encoding live message failed", "err", err, "map_id", r.mapID)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for client := range r.clients {
+		if client.ready {
+			client.push(data)
+		}
+	}
+}
+
+func (r *room) setSelection(client *liveClient, selection json.RawMessage) {
+	r.mu.Lock()
+	client.selection = selection
+	r.mu.Unlock()
+	r.broadcastPresence()
+}
+
+func (client *liveClient) queue(msg liveMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("Encoding live message failed", "err", err)
+		return
+	}
+	client.push(data)
+}
+
+// push never blocks, a client that can't keep up is disconnected and has to
+// reconnect for a fresh snapshot
+func (client *liveClient) push(data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		client.conn.Close()
+	}
+}
+
+func (client *liveClient) writePump() {
+	ticker := time.NewTicker(livePingPeriod)
+	defer func() {
+		ticker.Stop()
+		client.conn.Close()
+	}()
+	for {
+		select {
+		case data, ok := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if !ok {
+				client.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := client.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (client *liveClient) readPump(ctx context.Context, r *room, service *Service, validate func(i interface{}) error) {
+	client.conn.SetReadLimit(liveMaxMessage)
+	client.conn.SetReadDeadline(time.Now().Add(livePongWait))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+	for {
+		msg := liveMessage{}
+		if err := client.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.WarnContext(ctx, "Live connection closed unexpectedly", "err", err, "client_id", client.id)
+			}
+			return
+		}
+		switch msg.Type {
+		case MessageOp:
+			r.apply(ctx, service, client, msg, validate)
+		case MessageSelect:
+			r.setSelection(client, msg.Selection)
+		default:
+			client.queue(liveMessage{Type: MessageError, ClientOpID: msg.ClientOpID, Error: UnknownMessageError()})
+		}
+	}
+}
+
+func (con *Controller) live(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	if err := con.service.Authorize(ctx, id, auth.RoleViewer); err != nil {
+		return err
+	}
+	principal, err := principalOf(ctx)
+	if err != nil {
+		return err
+	}
+	mapID, err := uuid.Parse(id)
+	if err != nil {
+		return InvalidUUIDError()
+	}
+
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// the upgrader has already answered the request
+		slog.WarnContext(ctx, "Upgrading live connection failed", "err", err)
+		return nil
+	}
+	client := &liveClient{
+		id:        uuid.NewString(),
+		principal: principal,
+		conn:      conn,
+		send:      make(chan []byte, liveSendBuffer),
+	}
+	r := con.hub.join(mapID, client)
+	if r == nil {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(liveWriteWait))
+		conn.Close()
+		return nil
+	}
+	defer con.hub.leave(r, client)
+	go client.writePump()
+
+	if err := r.snapshot(ctx, con.service, client); err != nil {
+		client.queue(liveMessage{Type: MessageError, Error: InternalServerError()})
+		return nil
+	}
+	r.broadcastPresence()
+	client.readPump(ctx, r, con.service, c.Validate)
+	return nil
+}
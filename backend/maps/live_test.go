@@ -0,0 +1,133 @@
+package maps
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"example.com/echo-backend/auth"
+	"example.com/echo-backend/cache"
+	"example.com/echo-backend/problem"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// testValidate mirrors the validator main registers, numberOfPoints only
+// checks the point count here
+func testValidate(t *testing.T) func(i interface{}) error {
+	v := validator.New()
+	err := v.RegisterValidation("numberOfPoints", func(fl validator.FieldLevel) bool {
+		for _, zone := range fl.Field().Interface().([]pgtype.Polygon) {
+			if len(zone.P) < 3 {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.Struct
+}
+
+func TestValidateOperation(t *testing.T) {
+	triangle := &pgtype.Polygon{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}}
+	line := &pgtype.Polygon{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 1, Y: 0}}}
+	tests := []struct {
+		name string
+		op   Operation
+		code string
+	}{
+		{name: "add a zone", op: Operation{Op: OpAdd, Entity: EntityZone, Zone: triangle}},
+		{name: "delete a route", op: Operation{Op: OpDelete, Entity: EntityRoute, ID: uuid.New()}},
+		{name: "zone with two points", op: Operation{Op: OpUpdate, Entity: EntityZone, Zone: line}, code: "invalid_body"},
+		{name: "unknown op", op: Operation{Op: "move", Entity: EntityZone, Zone: triangle}, code: "invalid_operation"},
+		{name: "unknown entity", op: Operation{Op: OpAdd, Entity: "pin"}, code: "invalid_operation"},
+	}
+	validate := testValidate(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateOperation(test.op, validate)
+			if test.code == "" && err != nil {
+				t.Fatalf("validateOperation = %v, want nil", err)
+			}
+			if test.code != "" && (err == nil || problem.From(err).Code != test.code) {
+				t.Fatalf("validateOperation = %v, want %s", err, test.code)
+			}
+		})
+	}
+}
+
+func newTestClient(subject string) *liveClient {
+	return &liveClient{
+		id:        uuid.NewString(),
+		principal: auth.Principal{Kind: auth.KindUser, Subject: subject},
+		send:      make(chan []byte, liveSendBuffer),
+		ready:     true,
+	}
+}
+
+func TestHubRooms(t *testing.T) {
+	h := NewHub(NewService(&fakeQuerier{}, nil, cache.None{}, 0))
+	mapID := uuid.New()
+	first, second := newTestClient("1"), newTestClient("2")
+
+	r := h.join(mapID, first)
+	if h.join(mapID, second) != r {
+		t.Fatal("clients of the same map got different rooms")
+	}
+	h.leave(r, first)
+	if _, ok := h.rooms[mapID]; !ok {
+		t.Fatal("room closed while a client is still in it")
+	}
+	if _, open := <-first.send; open {
+		t.Fatal("the send channel of a client that left is still open")
+	}
+	var msg liveMessage
+	if err := json.Unmarshal(<-second.send, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != MessagePresence || len(msg.Clients) != 1 || msg.Clients[0].Subject != "user:2" {
+		t.Fatalf("presence after a client left = %+v", msg)
+	}
+	h.leave(r, second)
+	if len(h.rooms) != 0 {
+		t.Fatal("room left open after everyone left")
+	}
+}
+
+// an operation from outside a socket opens a room only for as long as it runs
+func TestHubApplyOperation(t *testing.T) {
+	h := NewHub(NewService(&fakeQuerier{}, nil, cache.None{}, 0))
+	mapID := uuid.New()
+	op := Operation{Op: OpDelete, Entity: EntityZone, ID: uuid.New()}
+
+	if _, _, err := h.applyOperation(context.Background(), mapID, op, pgtype.Int4{}, "user:1", ""); err == nil {
+		t.Fatal("applyOperation without a principal succeeded")
+	}
+	if len(h.rooms) != 0 {
+		t.Fatal("room left open after a failed operation")
+	}
+
+	client := newTestClient("1")
+	r := h.join(mapID, client)
+	h.applyOperation(context.Background(), mapID, op, pgtype.Int4{}, "user:1", "")
+	if h.rooms[mapID] != r || r.pending != 0 {
+		t.Fatal("operation closed the room of a connected client")
+	}
+	h.leave(r, client)
+	if len(h.rooms) != 0 {
+		t.Fatal("room left open after everyone left")
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub(NewService(&fakeQuerier{}, nil, cache.None{}, 0))
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if h.join(uuid.New(), newTestClient("1")) != nil {
+		t.Fatal("joined a closing hub")
+	}
+}
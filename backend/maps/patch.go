@@ -0,0 +1,298 @@
+package maps
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"example.com/echo-backend/audit"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/events"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	MIMEJSONPatch  = "application/json-patch+json"
+	MIMEMergePatch = "application/merge-patch+json"
+)
+
+// getMapDocument returns the map in the same shape PUT accepts, which is what
+// patches are applied against, along with its current version
+func (s *Service) getMapDocument(ctx context.Context, id string) (MapCreationReq, int32, error) {
+	ctx, span := tracer.Start(ctx, "maps.getMapDocument")
+	defer span.End()
+	doc, err := s.getMapWithAnnotations(ctx, id)
+	if err != nil {
+		return MapCreationReq{}, 0, err
+	}
+	return MapCreationReq{
+		Name:      doc.Name,
+		Image_url: doc.ImageUrl,
+		Zones:     doc.Zones,
+		Routes:    doc.Routes,
+	}, doc.Version, nil
+}
+
+// applyPatch applies an RFC 6902 JSON Patch or an RFC 7396 merge patch,
+// picked by content type, to the map document
+func applyPatch(doc MapCreationReq, contentType string, patch []byte) (MapCreationReq, error) {
+	original, err := json.Marshal(doc)
+	if err != nil {
+		slog.Error("Encoding map for patching failed", "err", err)
+		return MapCreationReq{}, InternalServerError()
+	}
+
+	var patched []byte
+	switch contentType {
+	case MIMEJSONPatch:
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return MapCreationReq{}, InvalidPatchError()
+		}
+		patched, err = ops.Apply(original)
+		if err != nil {
+			return MapCreationReq{}, InvalidPatchError()
+		}
+	case MIMEMergePatch:
+		patched, err = jsonpatch.MergePatch(original, patch)
+		if err != nil {
+			return MapCreationReq{}, InvalidPatchError()
+		}
+	default:
+		return MapCreationReq{}, UnsupportedPatchError()
+	}
+
+	req := MapCreationReq{}
+	if err := json.Unmarshal(patched, &req); err != nil {
+		return MapCreationReq{}, InvalidPatchError()
+	}
+	return req, nil
+}
+
+// updateMap is PUT /map/:id, which has always left zones alone when the body
+// sends none. Routes are treated the same way.
+func (s *Service) updateMap(ctx context.Context, req MapCreationReq, id string, expected pgtype.Int4) (int32, error) {
+	if len(req.Zones) == 0 {
+		req.Zones = nil
+	}
+	if len(req.Routes) == 0 {
+		req.Routes = nil
+	}
+	return s.replaceMap(ctx, req, id, expected)
+}
+
+// replaceMap writes the whole map document in one transaction, so a failed
+// PUT or patch never leaves a half-updated map. Zones and routes are matched
+// by id and only the ones added, changed or left out are written. Nil zones or
+// routes are kept as they are.
+func (s *Service) replaceMap(ctx context.Context, req MapCreationReq, id string, expected pgtype.Int4) (int32, error) {
+	ctx, span := tracer.Start(ctx, "maps.replaceMap")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return 0, err
+	}
+	mapID, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
+		return 0, InvalidUUIDError()
+	}
+	if len(req.Image_url) > s.maxImageBytes {
+		return 0, ImageTooLargeError()
+	}
+	if err := checkImage(req.Image_url); err != nil {
+		return 0, err
+	}
+
+	var version int32
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		before, err := lockSnapshot(ctx, q, workspaceID, mapID, expected)
+		if err != nil {
+			return err
+		}
+		after := newSnapshot(req.Name, req.Image_url, before.Zones, before.Routes)
+		version, err = q.UpdateMapById(ctx, db.UpdateMapByIdParams{
+			Name:            pgtype.Text{String: req.Name, Valid: true},
+			ImageUrl:        pgtype.Text{String: req.Image_url, Valid: true},
+			ID:              mapID,
+			WorkspaceID:     workspaceID,
+			ExpectedVersion: expected,
+		})
+		if err != nil {
+			return err
+		}
+		if err := emitMapEvent(ctx, q, events.ActionUpdated, db.Map{
+			ID:          mapID,
+			Name:        pgtype.Text{String: req.Name, Valid: true},
+			Version:     version,
+			WorkspaceID: workspaceID,
+		}); err != nil {
+			return err
+		}
+
+		// the map row is locked by lockSnapshot, so the zones and routes read
+		// below can't change before the transaction ends
+		if req.Zones != nil {
+			if after.Zones, err = replaceZones(ctx, q, workspaceID, mapID, req.Zones); err != nil {
+				return err
+			}
+		}
+		if req.Routes != nil {
+			if after.Routes, err = replaceRoutes(ctx, q, workspaceID, mapID, req.Routes); err != nil {
+				return err
+			}
+		}
+		return audit.Record(ctx, q, audit.Entry{
+			Action:      audit.ActionUpdate,
+			EntityType:  audit.EntityMap,
+			EntityID:    mapID,
+			MapID:       mapID,
+			WorkspaceID: workspaceID,
+			Before:      before,
+			After:       after,
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, s.versionConflict(ctx, mapID, workspaceID)
+	}
+	customErr := &CustomError{}
+	if errors.As(err, &customErr) {
+		return 0, customErr
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Replacing map failed", "err", err)
+		return 0, MapUpdateError()
+	}
+
+	return version, nil
+}
+
+// replaceZones makes zones the zones of the map: the ones without an id are
+// created, the ones whose points changed are updated and the ones left out
+// are deleted. It returns zones with the ids they ended up with.
+func replaceZones(ctx context.Context, q *db.Queries, workspaceID uuid.UUID, mapID uuid.UUID, zones []MapZone) ([]MapZone, error) {
+	annotationMapID := pgtype.UUID{Bytes: mapID, Valid: true}
+	rows, err := q.GetZoneAnnotationsByMapId(ctx, annotationMapID)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[uuid.UUID]pgtype.Polygon, len(rows))
+	for _, row := range rows {
+		current[row.ID] = row.Zone
+	}
+
+	kept := make(map[uuid.UUID]bool, len(zones))
+	saved := make([]MapZone, 0, len(zones))
+	for _, zone := range zones {
+		polygon := pgtype.Polygon{P: zone.P, Valid: true}
+		if zone.ID == nil {
+			created, err := q.CreateZone(ctx, db.CreateZoneParams{Zone: polygon, MapID: annotationMapID})
+			if err != nil {
+				return nil, err
+			}
+			if err := emitZoneEvent(ctx, q, events.ActionCreated, workspaceID, mapID, created.ID, &created.Zone); err != nil {
+				return nil, err
+			}
+			saved = append(saved, MapZone{ID: &created.ID, Polygon: created.Zone})
+			continue
+		}
+
+		old, ok := current[*zone.ID]
+		if !ok {
+			return nil, AnnotationNotFoundError()
+		}
+		if kept[*zone.ID] {
+			return nil, DuplicateAnnotationError()
+		}
+		kept[*zone.ID] = true
+		if !slices.Equal(old.P, polygon.P) {
+			if _, err := q.UpdateZone(ctx, db.UpdateZoneParams{ID: *zone.ID, MapID: annotationMapID, Zone: polygon}); err != nil {
+				return nil, err
+			}
+			if err := emitZoneEvent(ctx, q, events.ActionUpdated, workspaceID, mapID, *zone.ID, &polygon); err != nil {
+				return nil, err
+			}
+		}
+		saved = append(saved, MapZone{ID: zone.ID, Polygon: polygon})
+	}
+
+	for _, row := range rows {
+		if kept[row.ID] {
+			continue
+		}
+		if _, err := q.DeleteZone(ctx, db.DeleteZoneParams{ID: row.ID, MapID: annotationMapID}); err != nil {
+			return nil, err
+		}
+		if err := emitZoneEvent(ctx, q, events.ActionDeleted, workspaceID, mapID, row.ID, nil); err != nil {
+			return nil, err
+		}
+	}
+	return saved, nil
+}
+
+// replaceRoutes is replaceZones for routes, which also change when they are
+// opened or closed
+func replaceRoutes(ctx context.Context, q *db.Queries, workspaceID uuid.UUID, mapID uuid.UUID, routes []MapRoute) ([]MapRoute, error) {
+	annotationMapID := pgtype.UUID{Bytes: mapID, Valid: true}
+	rows, err := q.GetRouteAnnotationsByMapId(ctx, annotationMapID)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[uuid.UUID]pgtype.Path, len(rows))
+	for _, row := range rows {
+		current[row.ID] = row.Route
+	}
+
+	kept := make(map[uuid.UUID]bool, len(routes))
+	saved := make([]MapRoute, 0, len(routes))
+	for _, route := range routes {
+		path := pgtype.Path{P: route.P, Closed: route.Closed, Valid: true}
+		if route.ID == nil {
+			created, err := q.CreateRoute(ctx, db.CreateRouteParams{Route: path, MapID: annotationMapID})
+			if err != nil {
+				return nil, err
+			}
+			if err := emitRouteEvent(ctx, q, events.ActionCreated, workspaceID, mapID, created.ID, &created.Route); err != nil {
+				return nil, err
+			}
+			saved = append(saved, MapRoute{ID: &created.ID, Path: created.Route})
+			continue
+		}
+
+		old, ok := current[*route.ID]
+		if !ok {
+			return nil, AnnotationNotFoundError()
+		}
+		if kept[*route.ID] {
+			return nil, DuplicateAnnotationError()
+		}
+		kept[*route.ID] = true
+		if !slices.Equal(old.P, path.P) || old.Closed != path.Closed {
+			if _, err := q.UpdateRoute(ctx, db.UpdateRouteParams{ID: *route.ID, MapID: annotationMapID, Route: path}); err != nil {
+				return nil, err
+			}
+			if err := emitRouteEvent(ctx, q, events.ActionUpdated, workspaceID, mapID, *route.ID, &path); err != nil {
+				return nil, err
+			}
+		}
+		saved = append(saved, MapRoute{ID: route.ID, Path: path})
+	}
+
+	for _, row := range rows {
+		if kept[row.ID] {
+			continue
+		}
+		if _, err := q.DeleteRoute(ctx, db.DeleteRouteParams{ID: row.ID, MapID: annotationMapID}); err != nil {
+			return nil, err
+		}
+		if err := emitRouteEvent(ctx, q, events.ActionDeleted, workspaceID, mapID, row.ID, nil); err != nil {
+			return nil, err
+		}
+	}
+	return saved, nil
+}
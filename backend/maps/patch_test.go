@@ -0,0 +1,163 @@
+package maps
+
+import (
+	"net/http"
+	"testing"
+
+	"example.com/echo-backend/dbtest"
+	"example.com/echo-backend/problem"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestApplyPatch(t *testing.T) {
+	doc := MapCreationReq{
+		Name:      "map",
+		Image_url: "https://example.com/map.png",
+		Zones: []MapZone{
+			{Polygon: pgtype.Polygon{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}, Valid: true}},
+			{Polygon: pgtype.Polygon{P: []pgtype.Vec2{{X: 5, Y: 5}, {X: 6, Y: 5}, {X: 6, Y: 6}}, Valid: true}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		status      int
+		check       func(MapCreationReq) bool
+	}{
+		{
+			name:        "JSON Patch replace",
+			contentType: MIMEJSONPatch,
+			patch:       `[{"op": "replace", "path": "/name", "value": "renamed"}]`,
+			check:       func(got MapCreationReq) bool { return got.Name == "renamed" && len(got.Zones) == 2 },
+		},
+		{
+			name:        "JSON Patch removing a zone",
+			contentType: MIMEJSONPatch,
+			patch:       `[{"op": "remove", "path": "/zones/0"}]`,
+			check:       func(got MapCreationReq) bool { return len(got.Zones) == 1 && got.Zones[0].P[0].X == 5 },
+		},
+		{
+			name:        "JSON Patch test that fails",
+			contentType: MIMEJSONPatch,
+			patch:       `[{"op": "test", "path": "/name", "value": "other"}]`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "JSON Patch on a missing path",
+			contentType: MIMEJSONPatch,
+			patch:       `[{"op": "replace", "path": "/zones/9", "value": {}}]`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "JSON Patch that isn't a list",
+			contentType: MIMEJSONPatch,
+			patch:       `{"name": "renamed"}`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "merge patch",
+			contentType: MIMEMergePatch,
+			patch:       `{"image_url": null, "name": "merged"}`,
+			check: func(got MapCreationReq) bool {
+				return got.Name == "merged" && got.Image_url == "" && len(got.Zones) == 2
+			},
+		},
+		{
+			name:        "merge patch replacing zones",
+			contentType: MIMEMergePatch,
+			patch:       `{"zones": []}`,
+			check:       func(got MapCreationReq) bool { return got.Name == "map" && got.Zones != nil && len(got.Zones) == 0 },
+		},
+		{
+			name:        "merge patch with the wrong type",
+			contentType: MIMEMergePatch,
+			patch:       `{"name": 5}`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "invalid JSON",
+			contentType: MIMEMergePatch,
+			patch:       `{`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "unsupported type",
+			contentType: "application/json",
+			patch:       `{"name": "renamed"}`,
+			status:      http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyPatch(doc, test.contentType, []byte(test.patch))
+			if test.status != 0 {
+				if problem.StatusOf(err) != test.status {
+					t.Fatalf("applyPatch = %v, want %d", err, test.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPatch: %v", err)
+			}
+			if !test.check(got) {
+				t.Fatalf("applyPatch = %+v", got)
+			}
+		})
+	}
+}
+
+// PUT and PATCH rewrite the document, not when the map was created
+func TestReplaceMapKeepsCreatedAt(t *testing.T) {
+	s := newTestService(t)
+	ctx, _ := dbtest.Workspace(t, s.db, "1")
+	id := createTestMap(t, s, ctx, "created")
+	before, err := s.getMapById(ctx, id.String())
+	if err != nil {
+		t.Fatalf("getMapById: %v", err)
+	}
+	if _, err := s.replaceMap(ctx, MapCreationReq{Name: "replaced"}, id.String(), pgtype.Int4{}); err != nil {
+		t.Fatalf("replaceMap: %v", err)
+	}
+	after, err := s.getMapById(ctx, id.String())
+	if err != nil {
+		t.Fatalf("getMapById: %v", err)
+	}
+	if !after.CreatedAt.Equal(before.CreatedAt) || after.Name.String != "replaced" {
+		t.Fatalf("created_at %v became %v", before.CreatedAt, after.CreatedAt)
+	}
+}
+
+// PUT has always left zones and routes alone when the body sends none
+func TestUpdateMapKeepsAnnotations(t *testing.T) {
+	s := newTestService(t)
+	ctx, _ := dbtest.Workspace(t, s.db, "1")
+	triangle := pgtype.Polygon{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}, Valid: true}
+	if err := s.createNewMap(ctx, MapCreationReq{Name: "annotated", Zones: []MapZone{{Polygon: triangle}}}); err != nil {
+		t.Fatalf("createNewMap: %v", err)
+	}
+	maps, err := s.getMaps(ctx)
+	if err != nil {
+		t.Fatalf("getMaps: %v", err)
+	}
+	id := maps[0].ID.String()
+
+	if _, err := s.updateMap(ctx, MapCreationReq{Name: "renamed", Zones: []MapZone{}}, id, pgtype.Int4{}); err != nil {
+		t.Fatalf("updateMap: %v", err)
+	}
+	doc, _, err := s.getMapDocument(ctx, id)
+	if err != nil {
+		t.Fatalf("getMapDocument: %v", err)
+	}
+	if doc.Name != "renamed" || len(doc.Zones) != 1 {
+		t.Fatalf("map after a PUT without zones = %+v, want its zone kept", doc)
+	}
+
+	if _, err := s.replaceMap(ctx, MapCreationReq{Name: "renamed", Zones: []MapZone{}}, id, pgtype.Int4{}); err != nil {
+		t.Fatalf("replaceMap: %v", err)
+	}
+	if doc, _, _ = s.getMapDocument(ctx, id); len(doc.Zones) != 0 {
+		t.Fatalf("map after a patch removing every zone = %+v, want no zones", doc)
+	}
+}
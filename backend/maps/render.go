@@ -0,0 +1,98 @@
+package maps
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var errNoImage = errors.New("map has no image")
+
+// rasterImageTypes are the only types a data URL image may have. Images are
+// served from the API origin, so HTML or SVG there would run script on it.
+var rasterImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// decodeDataUrl splits a base64 data URL such as data:image/png;base64,... into
+// its content type and bytes, failing for anything but a raster image
+func decodeDataUrl(imageUrl string) (string, []byte, error) {
+	meta, data, found := strings.Cut(strings.TrimPrefix(imageUrl, "data:"), ",")
+	if !found || !strings.HasSuffix(meta, ";base64") {
+		return "", nil, errNoImage
+	}
+	contentType, _, _ := strings.Cut(strings.TrimSuffix(meta, ";base64"), ";")
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if !rasterImageTypes[contentType] {
+		return "", nil, fmt.Errorf("%w: unsupported type %q", errNoImage, contentType)
+	}
+	bytes, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return contentType, bytes, nil
+}
+
+// checkImage rejects data URL images that decodeDataUrl wouldn't serve,
+// links are left to the client
+func checkImage(imageUrl string) error {
+	if !strings.HasPrefix(imageUrl, "data:") {
+		return nil
+	}
+	if _, _, err := decodeDataUrl(imageUrl); err != nil {
+		return UnsupportedImageError()
+	}
+	return nil
+}
+
+// renderSVG draws the zones and routes of a map over its image. The canvas
+// spans from the origin to the furthest point, since coordinates are never
+// negative.
+func renderSVG(name string, imageUrl string, zones []MapZone, routes []MapRoute) string {
+	width, height := 1.0, 1.0
+	for _, zone := range zones {
+		for _, point := range zone.P {
+			width, height = math.Max(width, point.X), math.Max(height, point.Y)
+		}
+	}
+	for _, route := range routes {
+		for _, point := range route.P {
+			width, height = math.Max(width, point.X), math.Max(height, point.Y)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %g %g" width="%g" height="%g">`, width, height, width, height)
+	fmt.Fprintf(&b, `<title>%s</title>`, html.EscapeString(name))
+	if imageUrl != "" {
+		fmt.Fprintf(&b, `<image href="%s" x="0" y="0" width="%g" height="%g" preserveAspectRatio="xMinYMin meet"/>`, html.EscapeString(imageUrl), width, height)
+	}
+	for _, zone := range zones {
+		fmt.Fprintf(&b, `<polygon points="%s" fill="rgba(33,150,243,0.3)" stroke="#2196f3" stroke-width="1"/>`, svgPoints(zone.P))
+	}
+	for _, route := range routes {
+		element := "polyline"
+		if route.Closed {
+			element = "polygon"
+		}
+		fmt.Fprintf(&b, `<%s points="%s" fill="none" stroke="#f44336" stroke-width="2"/>`, element, svgPoints(route.P))
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+func svgPoints(points []pgtype.Vec2) string {
+	coordinates := make([]string, 0, len(points))
+	for _, point := range points {
+		coordinates = append(coordinates, fmt.Sprintf("%g,%g", point.X, point.Y))
+	}
+	return strings.Join(coordinates, " ")
+}
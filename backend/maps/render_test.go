@@ -0,0 +1,103 @@
+package maps
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"example.com/echo-backend/problem"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestDecodeDataUrl(t *testing.T) {
+	tests := []struct {
+		name        string
+		imageUrl    string
+		contentType string
+		ok          bool
+	}{
+		{name: "png", imageUrl: "data:image/png;base64,aGk=", contentType: "image/png", ok: true},
+		{name: "type in upper case", imageUrl: "data:IMAGE/JPEG;base64,aGk=", contentType: "image/jpeg", ok: true},
+		{name: "with parameters", imageUrl: "data:image/webp;name=map.webp;base64,aGk=", contentType: "image/webp", ok: true},
+		{name: "svg", imageUrl: "data:image/svg+xml;base64,PHN2Zy8+"},
+		{name: "html", imageUrl: "data:text/html;base64,PGgxPg=="},
+		{name: "no type", imageUrl: "data:;base64,aGk="},
+		{name: "not base64", imageUrl: "data:image/png,hi"},
+		{name: "invalid base64", imageUrl: "data:image/png;base64,!!"},
+		{name: "link", imageUrl: "https://example.com/map.png"},
+		{name: "empty", imageUrl: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contentType, image, err := decodeDataUrl(test.imageUrl)
+			if !test.ok {
+				if err == nil {
+					t.Fatalf("decodeDataUrl = %q, want an error", contentType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeDataUrl: %v", err)
+			}
+			if contentType != test.contentType || string(image) != "hi" {
+				t.Fatalf("decodeDataUrl = %q, %q, want %q, \"hi\"", contentType, image, test.contentType)
+			}
+		})
+	}
+	if _, _, err := decodeDataUrl("data:image/svg+xml;base64,PHN2Zy8+"); !errors.Is(err, errNoImage) {
+		t.Errorf("decodeDataUrl of an svg = %v, want errNoImage", err)
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	tests := []struct {
+		imageUrl string
+		status   int
+	}{
+		{"", 0},
+		{"https://example.com/map.png", 0},
+		{"data:image/gif;base64,aGk=", 0},
+		{"data:image/svg+xml;base64,PHN2Zy8+", http.StatusUnsupportedMediaType},
+		{"data:text/html;base64,PGgxPg==", http.StatusUnsupportedMediaType},
+	}
+	for _, test := range tests {
+		err := checkImage(test.imageUrl)
+		if test.status == 0 && err != nil {
+			t.Errorf("checkImage(%q) = %v, want nil", test.imageUrl, err)
+		}
+		if test.status != 0 && problem.StatusOf(err) != test.status {
+			t.Errorf("checkImage(%q) = %v, want %d", test.imageUrl, err, test.status)
+		}
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+	zones := []MapZone{{Polygon: pgtype.Polygon{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 5}}, Valid: true}}}
+	routes := []MapRoute{
+		{Path: pgtype.Path{P: []pgtype.Vec2{{X: 1, Y: 1}, {X: 20, Y: 2}}, Valid: true}},
+		{Path: pgtype.Path{P: []pgtype.Vec2{{X: 2, Y: 2}, {X: 3, Y: 8}}, Closed: true, Valid: true}},
+	}
+	svg := renderSVG(`<script>alert("hi")</script>`, `data:image/png;base64,aGk="><script>`, zones, routes)
+
+	for _, want := range []string{
+		`viewBox="0 0 20 8"`,
+		`<title>&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt;</title>`,
+		`href="data:image/png;base64,aGk=&#34;&gt;&lt;script&gt;"`,
+		`<polygon points="0,0 10,0 10,5"`,
+		`<polyline points="1,1 20,2"`,
+		`<polygon points="2,2 3,8"`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("svg doesn't contain %s: %s", want, svg)
+		}
+	}
+	if strings.Contains(svg, "<script>") {
+		t.Errorf("svg contains an unescaped script: %s", svg)
+	}
+
+	empty := renderSVG("empty", "", nil, nil)
+	if !strings.Contains(empty, `viewBox="0 0 1 1"`) || strings.Contains(empty, "<image") {
+		t.Errorf("svg of an empty map = %s", empty)
+	}
+}
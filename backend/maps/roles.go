@@ -0,0 +1,269 @@
+package maps
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"example.com/echo-backend/audit"
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type RoleGrantReq struct {
+	Role string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+type CollaboratorRes struct {
+	Subject   string    `json:"subject"`
+	Role      string    `json:"role"`
+	GrantedBy string    `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// principalOf returns the principal of ctx, every map belongs to a workspace
+// so requests that did not select one cannot reach any
+func principalOf(ctx context.Context) (auth.Principal, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return auth.Principal{}, ForbiddenError()
+	}
+	if !principal.HasWorkspace() {
+		return auth.Principal{}, NoWorkspaceError()
+	}
+	return principal, nil
+}
+
+func workspaceOf(ctx context.Context) (uuid.UUID, error) {
+	principal, err := principalOf(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return principal.WorkspaceID, nil
+}
+
+// AuthorizeWorkspace checks that the principal of ctx holds at least role in
+// the selected workspace, e.g. to create maps in it
+func (s *Service) AuthorizeWorkspace(ctx context.Context, role string) error {
+	ctx, span := tracer.Start(ctx, "maps.AuthorizeWorkspace")
+	defer span.End()
+	principal, err := principalOf(ctx)
+	if err != nil {
+		return err
+	}
+	if !auth.RoleAtLeast(principal.WorkspaceRole, role) {
+		return ForbiddenError()
+	}
+	return nil
+}
+
+// Authorize checks that the map belongs to the selected workspace, isn't in
+// the trash and that the principal of ctx holds at least role on it, either
+// through their workspace role or a role on the map itself.
+func (s *Service) Authorize(ctx context.Context, id string, role string) error {
+	ctx, span := tracer.Start(ctx, "maps.Authorize")
+	defer span.End()
+	return s.authorize(ctx, id, role, false)
+}
+
+// AuthorizeTrashed is Authorize for routes that also work on maps in the
+// trash, like restoring them or reading their audit log
+func (s *Service) AuthorizeTrashed(ctx context.Context, id string, role string) error {
+	ctx, span := tracer.Start(ctx, "maps.AuthorizeTrashed")
+	defer span.End()
+	return s.authorize(ctx, id, role, true)
+}
+
+func (s *Service) authorize(ctx context.Context, id string, role string, includeTrashed bool) error {
+	principal, err := principalOf(ctx)
+	if err != nil {
+		return err
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
+		return InvalidUUIDError()
+	}
+	exists, err := s.db.MapExistsInWorkspace(ctx, db.MapExistsInWorkspaceParams{
+		ID:             uuid,
+		WorkspaceID:    principal.WorkspaceID,
+		IncludeTrashed: includeTrashed,
+	})
+	if err != nil {
+		return dbError(ctx, "MapExistsInWorkspace", err, nil)
+	}
+	if !exists {
+		return NotFoundError()
+	}
+	granted := principal.WorkspaceRole
+	if !auth.RoleAtLeast(granted, role) {
+		mapRole, err := s.db.GetMapRole(ctx, db.GetMapRoleParams{
+			MapID:   uuid,
+			Subject: principal.String(),
+		})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return dbError(ctx, "GetMapRole", err, nil)
+		}
+		granted = auth.HigherRole(granted, mapRole)
+	}
+	if granted == "" {
+		return NotFoundError()
+	}
+	if !auth.RoleAtLeast(granted, role) {
+		return ForbiddenError()
+	}
+	return nil
+}
+
+func (s *Service) getCollaborators(ctx context.Context, id string) ([]CollaboratorRes, error) {
+	ctx, span := tracer.Start(ctx, "maps.getCollaborators")
+	defer span.End()
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
+		return []CollaboratorRes{}, InvalidUUIDError()
+	}
+	rows, err := s.db.GetMapRolesByMapId(ctx, uuid)
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing collaborators failed", "err", err)
+		return []CollaboratorRes{}, InternalServerError()
+	}
+	collaborators := make([]CollaboratorRes, 0, len(rows))
+	for _, row := range rows {
+		collaborators = append(collaborators, CollaboratorRes{
+			Subject:   row.Subject,
+			Role:      row.Role,
+			GrantedBy: row.GrantedBy,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+	return collaborators, nil
+}
+
+func (s *Service) grantRole(ctx context.Context, id string, subject string, role string) error {
+	ctx, span := tracer.Start(ctx, "maps.grantRole")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return err
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
+		return InvalidUUIDError()
+	}
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		previous, err := q.GetMapRole(ctx, db.GetMapRoleParams{MapID: uuid, Subject: subject})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if previous == auth.RoleOwner && role != auth.RoleOwner {
+			if err := ensureAnotherOwner(ctx, q, uuid); err != nil {
+				return err
+			}
+		}
+		if _, err := q.GrantMapRole(ctx, db.GrantMapRoleParams{
+			MapID:     uuid,
+			Subject:   subject,
+			Role:      role,
+			GrantedBy: actorOf(ctx),
+		}); err != nil {
+			return err
+		}
+		entry := audit.Entry{
+			Action:      audit.ActionCreate,
+			EntityType:  audit.EntityRole,
+			EntityID:    uuid,
+			MapID:       uuid,
+			WorkspaceID: workspaceID,
+			After:       CollaboratorRes{Subject: subject, Role: role},
+		}
+		if previous != "" {
+			entry.Action = audit.ActionUpdate
+			entry.Before = CollaboratorRes{Subject: subject, Role: previous}
+		}
+		return audit.Record(ctx, q, entry)
+	})
+	if err != nil {
+		customErr := &CustomError{}
+		if errors.As(err, &customErr) {
+			return customErr
+		}
+		slog.ErrorContext(ctx, "Granting map role failed", "err", err)
+		return RoleUpdateError()
+	}
+	return nil
+}
+
+func (s *Service) revokeRole(ctx context.Context, id string, subject string) error {
+	ctx, span := tracer.Start(ctx, "maps.revokeRole")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return err
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
+		return InvalidUUIDError()
+	}
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		previous, err := q.GetMapRole(ctx, db.GetMapRoleParams{MapID: uuid, Subject: subject})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return NotFoundError()
+		}
+		if err != nil {
+			return err
+		}
+		if previous == auth.RoleOwner {
+			if err := ensureAnotherOwner(ctx, q, uuid); err != nil {
+				return err
+			}
+		}
+		if _, err := q.RevokeMapRole(ctx, db.RevokeMapRoleParams{MapID: uuid, Subject: subject}); err != nil {
+			return err
+		}
+		return audit.Record(ctx, q, audit.Entry{
+			Action:      audit.ActionDelete,
+			EntityType:  audit.EntityRole,
+			EntityID:    uuid,
+			MapID:       uuid,
+			WorkspaceID: workspaceID,
+			Before:      CollaboratorRes{Subject: subject, Role: previous},
+		})
+	})
+	if err != nil {
+		customErr := &CustomError{}
+		if errors.As(err, &customErr) {
+			return customErr
+		}
+		slog.ErrorContext(ctx, "Revoking map role failed", "err", err)
+		return RoleUpdateError()
+	}
+	return nil
+}
+
+// a map must always keep at least one owner who can share or delete it. The
+// owner rows stay locked until the transaction ends, so a concurrent change
+// waits and then sees this one.
+func ensureAnotherOwner(ctx context.Context, q db.Querier, id uuid.UUID) error {
+	owners, err := q.LockMapOwners(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(owners) <= 1 {
+		return LastOwnerError()
+	}
+	return nil
+}
+
+func actorOf(ctx context.Context) string {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return "system"
+	}
+	return principal.String()
+}
@@ -0,0 +1,202 @@
+package maps
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"example.com/echo-backend/auth"
+	"example.com/echo-backend/cache"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/dbtest"
+	"example.com/echo-backend/problem"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type fakeMap struct {
+	workspaceID uuid.UUID
+	trashed     bool
+}
+
+// fakeQuerier answers the queries of authorize, any other query panics
+type fakeQuerier struct {
+	db.Querier
+	maps map[uuid.UUID]fakeMap
+	// role of each subject by map
+	roles map[uuid.UUID]map[string]string
+	err   error
+}
+
+func (q *fakeQuerier) MapExistsInWorkspace(ctx context.Context, arg db.MapExistsInWorkspaceParams) (bool, error) {
+	if q.err != nil {
+		return false, q.err
+	}
+	m, ok := q.maps[arg.ID]
+	return ok && m.workspaceID == arg.WorkspaceID && (!m.trashed || arg.IncludeTrashed), nil
+}
+
+func (q *fakeQuerier) GetMapRole(ctx context.Context, arg db.GetMapRoleParams) (string, error) {
+	role, ok := q.roles[arg.MapID][arg.Subject]
+	if !ok {
+		return "", pgx.ErrNoRows
+	}
+	return role, nil
+}
+
+func TestAuthorize(t *testing.T) {
+	workspaceID := uuid.New()
+	mapID := uuid.New()
+	trashedID := uuid.New()
+	otherID := uuid.New()
+	q := &fakeQuerier{
+		maps: map[uuid.UUID]fakeMap{
+			mapID:     {workspaceID: workspaceID},
+			trashedID: {workspaceID: workspaceID, trashed: true},
+			otherID:   {workspaceID: uuid.New()},
+		},
+		roles: map[uuid.UUID]map[string]string{
+			mapID: {"user:viewer": auth.RoleEditor, "user:collaborator": auth.RoleEditor, "user:reader": auth.RoleViewer},
+		},
+	}
+	as := func(subject string, role string) context.Context {
+		return dbtest.As(workspaceID, subject, role)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		id      string
+		role    string
+		trashed bool
+		status  int
+	}{
+		{name: "no principal", ctx: context.Background(), id: mapID.String(), role: auth.RoleViewer, status: http.StatusForbidden},
+		{name: "no workspace", ctx: dbtest.As(uuid.Nil, "owner", auth.RoleOwner), id: mapID.String(), role: auth.RoleViewer, status: http.StatusBadRequest},
+		{name: "invalid id", ctx: as("owner", auth.RoleOwner), id: "nope", role: auth.RoleViewer, status: http.StatusBadRequest},
+		{name: "map of another workspace", ctx: as("owner", auth.RoleOwner), id: otherID.String(), role: auth.RoleViewer, status: http.StatusNotFound},
+		{name: "unknown map", ctx: as("owner", auth.RoleOwner), id: uuid.NewString(), role: auth.RoleViewer, status: http.StatusNotFound},
+		{name: "workspace owner", ctx: as("owner", auth.RoleOwner), id: mapID.String(), role: auth.RoleOwner},
+		{name: "workspace editor editing", ctx: as("editor", auth.RoleEditor), id: mapID.String(), role: auth.RoleEditor},
+		{name: "workspace editor sharing", ctx: as("editor", auth.RoleEditor), id: mapID.String(), role: auth.RoleOwner, status: http.StatusForbidden},
+		{name: "workspace viewer editing", ctx: as("reader2", auth.RoleViewer), id: mapID.String(), role: auth.RoleEditor, status: http.StatusForbidden},
+		{name: "workspace viewer who edits the map", ctx: as("viewer", auth.RoleViewer), id: mapID.String(), role: auth.RoleEditor},
+		{name: "collaborator editing", ctx: as("collaborator", ""), id: mapID.String(), role: auth.RoleEditor},
+		{name: "collaborator sharing", ctx: as("collaborator", ""), id: mapID.String(), role: auth.RoleOwner, status: http.StatusForbidden},
+		{name: "collaborator who only reads", ctx: as("reader", ""), id: mapID.String(), role: auth.RoleEditor, status: http.StatusForbidden},
+		{name: "stranger", ctx: as("stranger", ""), id: mapID.String(), role: auth.RoleViewer, status: http.StatusNotFound},
+		{name: "trashed map", ctx: as("owner", auth.RoleOwner), id: trashedID.String(), role: auth.RoleOwner, status: http.StatusNotFound},
+		{name: "trashed map when allowed", ctx: as("owner", auth.RoleOwner), id: trashedID.String(), role: auth.RoleOwner, trashed: true},
+	}
+	s := NewService(q, nil, cache.None{}, 0)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authorize := s.Authorize
+			if test.trashed {
+				authorize = s.AuthorizeTrashed
+			}
+			err := authorize(test.ctx, test.id, test.role)
+			if test.status == 0 && err != nil {
+				t.Fatalf("authorize = %v, want nil", err)
+			}
+			if test.status != 0 && problem.StatusOf(err) != test.status {
+				t.Fatalf("authorize = %v, want %d", err, test.status)
+			}
+		})
+	}
+}
+
+func TestAuthorizeDatabaseFailure(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{&pgconn.PgError{Code: "57P01"}, http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		s := NewService(&fakeQuerier{err: test.err}, nil, cache.None{}, 0)
+		ctx := dbtest.As(uuid.New(), "owner", auth.RoleOwner)
+		if err := s.Authorize(ctx, uuid.NewString(), auth.RoleViewer); problem.StatusOf(err) != test.status {
+			t.Errorf("Authorize with %v = %v, want %d", test.err, err, test.status)
+		}
+	}
+}
+
+func TestLastMapOwner(t *testing.T) {
+	s := newTestService(t)
+	ctx, workspaceID := dbtest.Workspace(t, s.db, "1")
+	id := createTestMap(t, s, ctx, "owned")
+
+	if err := s.revokeRole(ctx, id.String(), "user:1"); problem.StatusOf(err) != http.StatusConflict {
+		t.Fatalf("revoking the last owner = %v, want 409", err)
+	}
+	if err := s.grantRole(ctx, id.String(), "user:1", auth.RoleEditor); problem.StatusOf(err) != http.StatusConflict {
+		t.Fatalf("downgrading the last owner = %v, want 409", err)
+	}
+	if err := s.revokeRole(ctx, id.String(), "user:9"); problem.StatusOf(err) != http.StatusNotFound {
+		t.Fatalf("revoking a role nobody has = %v, want 404", err)
+	}
+	if err := s.grantRole(ctx, id.String(), "user:2", auth.RoleOwner); err != nil {
+		t.Fatalf("grantRole: %v", err)
+	}
+	if err := s.grantRole(ctx, id.String(), "user:1", auth.RoleEditor); err != nil {
+		t.Fatalf("downgrading one of two owners: %v", err)
+	}
+
+	entries, err := s.db.GetAuditEntriesByMapId(ctx, db.GetAuditEntriesByMapIdParams{
+		MapID:       pgtype.UUID{Bytes: id, Valid: true},
+		WorkspaceID: workspaceID,
+		Limit:       2,
+	})
+	if err != nil {
+		t.Fatalf("GetAuditEntriesByMapId: %v", err)
+	}
+	if len(entries) != 2 || entries[0].EntityType != "role" || entries[0].Action != "update" || entries[1].Action != "create" {
+		t.Fatalf("audit log doesn't end with the grant and the downgrade: %+v", entries)
+	}
+}
+
+// two owners revoking each other at once must not leave the map without one
+func TestLastMapOwnerConcurrently(t *testing.T) {
+	s := newTestService(t)
+	ctx, _ := dbtest.Workspace(t, s.db, "1")
+	for i := 0; i < 10; i++ {
+		id := createTestMap(t, s, ctx, "race "+uuid.NewString()[:8])
+		if err := s.grantRole(ctx, id.String(), "user:2", auth.RoleOwner); err != nil {
+			t.Fatalf("grantRole: %v", err)
+		}
+
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for i, subject := range []string{"user:1", "user:2"} {
+			wg.Add(1)
+			go func(i int, subject string) {
+				defer wg.Done()
+				errs[i] = s.revokeRole(ctx, id.String(), subject)
+			}(i, subject)
+		}
+		wg.Wait()
+
+		conflicts := 0
+		for _, err := range errs {
+			if problem.StatusOf(err) == http.StatusConflict {
+				conflicts++
+			} else if err != nil {
+				t.Fatalf("revokeRole: %v", err)
+			}
+		}
+		owners, err := s.db.GetMapRolesByMapId(ctx, id)
+		if err != nil {
+			t.Fatalf("GetMapRolesByMapId: %v", err)
+		}
+		if conflicts != 1 || len(owners) != 1 {
+			t.Fatalf("%d revokes were refused and %d owners are left, want 1 and 1", conflicts, len(owners))
+		}
+	}
+}
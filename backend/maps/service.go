@@ -2,34 +2,64 @@ package maps
 
 import (
 	"context"
-	"log"
-	"net/http"
+	"errors"
+	"log/slog"
 	"time"
 
+	"example.com/echo-backend/audit"
+	"example.com/echo-backend/auth"
+	"example.com/echo-backend/cache"
 	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/events"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("example.com/echo-backend/maps")
+
 
 
 type Service struct {
 	db db.Querier
+	pool TxBeginner
+	// maps and rendered SVGs, see loadMap
+	cache cache.Cache
+	// longest image_url a map may have
+	maxImageBytes int
 }
 
-func NewService(db db.Querier) *Service {
+func NewService(db db.Querier, pool TxBeginner, cache cache.Cache, maxImageBytes int) *Service {
 	service := Service{
 		db: db,
+		pool: pool,
+		cache: cache,
+		maxImageBytes: maxImageBytes,
 	}
 	return &service
 }
 
 func (s *Service) getMaps(ctx context.Context) ([]db.Map, error) {
+	ctx, span := tracer.Start(ctx, "maps.getMaps")
+	defer span.End()
 	maps := make([]db.Map, 0)
-	rows, err := s.db.GetMaps(ctx)
+	principal, err := principalOf(ctx)
+	if err != nil {
+		return []db.Map{}, err
+	}
+	var rows []db.Map
+	// members see the whole workspace, others only the maps shared with them
+	if principal.WorkspaceRole != "" {
+		rows, err = s.db.GetMaps(ctx, principal.WorkspaceID)
+	} else {
+		rows, err = s.db.GetMapsBySubject(ctx, db.GetMapsBySubjectParams{
+			Subject: principal.String(),
+			WorkspaceID: principal.WorkspaceID,
+		})
+	}
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "Listing maps failed", "err", err)
 		return []db.Map{}, InternalServerError()
 	}
 
@@ -38,160 +68,331 @@ func (s *Service) getMaps(ctx context.Context) ([]db.Map, error) {
 			ID: row.ID,
 			Name: row.Name,
 			ImageUrl: row.ImageUrl,
+			Version: row.Version,
 			CreatedAt: row.CreatedAt,
 		})
 	}
 	return maps, nil
 }
 
-func (s *Service) getZonesByMapId(ctx context.Context, id string) ([]pgtype.Polygon, error) {
-	zones := make([]pgtype.Polygon, 0)
-	uuid := pgtype.UUID{}
-	if err := uuid.Scan(id); err != nil {
-		log.Println(err)
-		return []pgtype.Polygon{}, InvalidUUIDError()
-	}
-	rows, err := s.db.GetZonesByMapId(ctx, uuid)
+func (s *Service) getTrashedMaps(ctx context.Context) ([]db.Map, error) {
+	ctx, span := tracer.Start(ctx, "maps.getTrashedMaps")
+	defer span.End()
+	maps := make([]db.Map, 0)
+	principal, err := principalOf(ctx)
 	if err != nil {
-		log.Println(err)
-		return []pgtype.Polygon{}, NotFoundError()
+		return []db.Map{}, err
 	}
-
-	for _, row := range rows {
-		zones = append(zones, pgtype.Polygon{
-			P: row.P,
+	var rows []db.Map
+	if principal.WorkspaceRole == auth.RoleOwner {
+		rows, err = s.db.GetTrashedMaps(ctx, principal.WorkspaceID)
+	} else {
+		rows, err = s.db.GetTrashedMapsByOwner(ctx, db.GetTrashedMapsByOwnerParams{
+			Subject: principal.String(),
+			WorkspaceID: principal.WorkspaceID,
 		})
 	}
-	return zones, nil
-}
-
-func (s *Service) getRoutesByMapId(ctx context.Context, id string) ([]pgtype.Path, error) {
-	routes := make([]pgtype.Path, 0)
-	uuid := pgtype.UUID{}
-	if err := uuid.Scan(id); err != nil {
-		log.Println(err)
-		return []pgtype.Path{}, InvalidUUIDError()
-	}
-
-	rows, err := s.db.GetRoutesByMapId(ctx, uuid)
 	if err != nil {
-		log.Println(err)
-		return []pgtype.Path{}, NotFoundError()
+		slog.ErrorContext(ctx, "Listing trashed maps failed", "err", err)
+		return []db.Map{}, InternalServerError()
 	}
 
 	for _, row := range rows {
-		routes = append(routes, pgtype.Path{
-			P: row.P,
+		maps = append(maps, db.Map{
+			ID: row.ID,
+			Name: row.Name,
+			ImageUrl: row.ImageUrl,
+			Version: row.Version,
+			CreatedAt: row.CreatedAt,
+			DeletedAt: row.DeletedAt,
 		})
 	}
-	return routes, nil
+	return maps, nil
 }
 
 func (s *Service) getMapById(ctx context.Context, id string) (db.Map, error) {
+	ctx, span := tracer.Start(ctx, "maps.getMapById")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return db.Map{}, err
+	}
 	uuid, err := uuid.Parse(id) 
 	if err != nil {
-		log.Println(err)
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
 		return db.Map{}, InvalidUUIDError()
 	}
-	res, err := s.db.GetMapById(ctx, uuid)
+	res, err := s.db.GetMapById(ctx, db.GetMapByIdParams{
+		ID: uuid,
+		WorkspaceID: workspaceID,
+	})
 	if err != nil {
-		log.Println(err)
-		return db.Map{}, NotFoundError()
+		return db.Map{}, dbError(ctx, "GetMapById", err, NotFoundError())
 	}
 	return res, nil
 }
 
-func (s *Service) createNewZone(ctx context.Context, zone pgtype.Polygon, id uuid.UUID) (error) {
-	uuid := pgtype.UUID{}
-	uuid.Scan(id.String())
-	newZone, err := s.db.CreateZone(ctx, db.CreateZoneParams{
-		Zone: zone,
-		MapID: uuid,
-	})
-	log.Println(newZone)
+func (s *Service) createNewMap(ctx context.Context, req MapCreationReq) (error) {
+	ctx, span := tracer.Start(ctx, "maps.createNewMap")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
 	if err != nil {
-		log.Println(err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error, please try again")
+		return err
+	}
+	if len(req.Image_url) > s.maxImageBytes {
+		return ImageTooLargeError()
+	}
+	if err := checkImage(req.Image_url); err != nil {
+		return err
 	}
-
-	return nil
-}
-
-func (s *Service) createNewMap(ctx context.Context, req MapCreationReq) (error) {
 	date := time.Now().Local()
 	nameString := pgtype.Text{String: req.Name, Valid: true}
 	urlString := pgtype.Text{String: req.Image_url, Valid: true}
-	createdMap, err := s.db.CreateMap(ctx, db.CreateMapParams{
-		Name: nameString,
-		ImageUrl: urlString,
-		CreatedAt: date,
-	}) 
-	if err != nil {
-		log.Println(err)
-    	return MapCreationError()
-  	}
-	
-	if (len(req.Zones) != 0) {
+	var createdMap db.Map
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		createdMap, err = q.CreateMap(ctx, db.CreateMapParams{
+			Name: nameString,
+			ImageUrl: urlString,
+			CreatedAt: date,
+			WorkspaceID: workspaceID,
+		})
+		if err != nil {
+			return err
+		}
+		// whoever creates a map owns it
+		if _, err := q.GrantMapRole(ctx, db.GrantMapRoleParams{
+			MapID: createdMap.ID,
+			Subject: actorOf(ctx),
+			Role: auth.RoleOwner,
+			GrantedBy: actorOf(ctx),
+		}); err != nil {
+			return err
+		}
+		if err := emitMapEvent(ctx, q, events.ActionCreated, createdMap); err != nil {
+			return err
+		}
+
+		mapID := pgtype.UUID{Bytes: createdMap.ID, Valid: true}
+		zones := make([]MapZone, 0, len(req.Zones))
 		for _, zone := range req.Zones {
-			s.createNewZone(ctx, zone, createdMap.ID)
+			newZone, err := q.CreateZone(ctx, db.CreateZoneParams{
+				Zone: pgtype.Polygon{P: zone.P, Valid: true},
+				MapID: mapID,
+			})
+			if err != nil {
+				return err
+			}
+			if err := emitZoneEvent(ctx, q, events.ActionCreated, workspaceID, createdMap.ID, newZone.ID, &newZone.Zone); err != nil {
+				return err
+			}
+			if err := audit.Record(ctx, q, audit.Entry{
+				Action: audit.ActionCreate,
+				EntityType: audit.EntityZone,
+				EntityID: newZone.ID,
+				MapID: createdMap.ID,
+				WorkspaceID: workspaceID,
+				After: newZone.Zone,
+			}); err != nil {
+				return err
+			}
+			zones = append(zones, MapZone{ID: &newZone.ID, Polygon: newZone.Zone})
+		}
+		routes := make([]MapRoute, 0, len(req.Routes))
+		for _, route := range req.Routes {
+			newRoute, err := q.CreateRoute(ctx, db.CreateRouteParams{
+				Route: pgtype.Path{P: route.P, Closed: route.Closed, Valid: true},
+				MapID: mapID,
+			})
+			if err != nil {
+				return err
+			}
+			if err := emitRouteEvent(ctx, q, events.ActionCreated, workspaceID, createdMap.ID, newRoute.ID, &newRoute.Route); err != nil {
+				return err
+			}
+			if err := audit.Record(ctx, q, audit.Entry{
+				Action: audit.ActionCreate,
+				EntityType: audit.EntityRoute,
+				EntityID: newRoute.ID,
+				MapID: createdMap.ID,
+				WorkspaceID: workspaceID,
+				After: newRoute.Route,
+			}); err != nil {
+				return err
+			}
+			routes = append(routes, MapRoute{ID: &newRoute.ID, Path: newRoute.Route})
 		}
+		return audit.Record(ctx, q, audit.Entry{
+			Action: audit.ActionCreate,
+			EntityType: audit.EntityMap,
+			EntityID: createdMap.ID,
+			MapID: createdMap.ID,
+			WorkspaceID: workspaceID,
+			After: newSnapshot(req.Name, req.Image_url, zones, routes),
+		})
+	})
+	if err != nil {
+		return dbError(ctx, "createNewMap", err, nil)
 	}
 	return nil
 }
 
-func (s *Service) updateMap(ctx context.Context, req MapCreationReq, id string) (error) {
-	name := pgtype.Text{String: req.Name, Valid: true}
-	imgUrl := pgtype.Text{String: req.Image_url, Valid: true}
-	date := time.Now().Local()
+func (s *Service) deleteMap(ctx context.Context, id string, expected pgtype.Int4) (error) {
+	ctx, span := tracer.Start(ctx, "maps.deleteMap")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return err
+	}
 	uuid, err := uuid.Parse(id)
 	if err != nil {
-		log.Println(err)
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
 		return InvalidUUIDError()
 	}
-	if err := s.db.UpdateMapById(ctx, db.UpdateMapByIdParams{
-		Name: name,
-		ImageUrl: imgUrl,
-		CreatedAt: date,
-		ID: uuid,
-	}); err != nil {
-		log.Println(err)
-    	return MapUpdateError()
-  	}
-	
-	if (len(req.Zones) != 0) {
-		for _, zone := range req.Zones {
-			s.updateZone(ctx, zone, id)
+	// maps are only moved to the trash here, the purger removes them for good
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		before, err := lockSnapshot(ctx, q, workspaceID, uuid, expected)
+		if err != nil {
+			return err
 		}
+		count, err := q.SoftDeleteMapById(ctx, db.SoftDeleteMapByIdParams{
+			ID: uuid,
+			WorkspaceID: workspaceID,
+			ExpectedVersion: expected,
+		})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return pgx.ErrNoRows
+		}
+		if err := emitMapEvent(ctx, q, events.ActionDeleted, db.Map{
+			ID: uuid,
+			Name: pgtype.Text{String: before.Name, Valid: true},
+			WorkspaceID: workspaceID,
+		}); err != nil {
+			return err
+		}
+		return audit.Record(ctx, q, audit.Entry{
+			Action: audit.ActionDelete,
+			EntityType: audit.EntityMap,
+			EntityID: uuid,
+			MapID: uuid,
+			WorkspaceID: workspaceID,
+			Before: before,
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s.versionConflict(ctx, uuid, workspaceID)
+	}
+	customErr := &CustomError{}
+	if errors.As(err, &customErr) {
+		return customErr
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Deleting map failed", "err", err)
+		return MapDeletionError()
 	}
 
 	return nil
 }
 
-func (s *Service) updateZone(ctx context.Context, zone pgtype.Polygon, id string) (error) {
-	uuid := pgtype.UUID{}
-	uuid.Scan(id)
-	err := s.db.UpdateZoneById(ctx, db.UpdateZoneByIdParams{
-		Zone: zone,
-		MapID: uuid,
-	})
+func (s *Service) restoreMap(ctx context.Context, id string) (error) {
+	ctx, span := tracer.Start(ctx, "maps.restoreMap")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
 	if err != nil {
-		log.Println(err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error, please try again")
+		return err
 	}
-
-	return nil
-}
-func (s *Service) deleteMap(ctx context.Context, id string) (error) {
-	// s.deleteZone(ctx, id)
 	uuid, err := uuid.Parse(id)
 	if err != nil {
-		log.Println(err)
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
 		return InvalidUUIDError()
 	}
-	if err := s.db.DeleteMapById(ctx, uuid); err != nil {
-		log.Println(err)
-		return MapDeletionError()
+	// to anyone following the map a restored map is a new one
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		count, err := q.RestoreMapById(ctx, db.RestoreMapByIdParams{
+			ID: uuid,
+			WorkspaceID: workspaceID,
+		})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return pgx.ErrNoRows
+		}
+		restored, err := q.GetMapById(ctx, db.GetMapByIdParams{
+			ID: uuid,
+			WorkspaceID: workspaceID,
+		})
+		if err != nil {
+			return err
+		}
+		if err := emitMapEvent(ctx, q, events.ActionCreated, restored); err != nil {
+			return err
+		}
+		return audit.Record(ctx, q, audit.Entry{
+			Action: audit.ActionRestore,
+			EntityType: audit.EntityMap,
+			EntityID: uuid,
+			MapID: uuid,
+			WorkspaceID: workspaceID,
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotFoundError()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Restoring map failed", "err", err)
+		return MapRestoreError()
 	}
 
 	return nil
+}
+
+func (s *Service) purgeDeletedMaps(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, span := tracer.Start(ctx, "maps.purgeDeletedMaps")
+	defer span.End()
+	cutoff := pgtype.Timestamptz{Time: time.Now().Add(-retention), Valid: true}
+	var purged []db.PurgeDeletedMapsRow
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		var err error
+		purged, err = q.PurgeDeletedMaps(ctx, cutoff)
+		if err != nil {
+			return err
+		}
+		for _, row := range purged {
+			if err := audit.Record(ctx, q, audit.Entry{
+				Action: audit.ActionPurge,
+				EntityType: audit.EntityMap,
+				EntityID: row.ID,
+				MapID: row.ID,
+				WorkspaceID: row.WorkspaceID,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Purging trash failed", "err", err)
+		return 0, InternalServerError()
+	}
+	return int64(len(purged)), nil
+}
+
+// RunTrashPurger permanently removes maps that have been in the trash for
+// longer than retention, checking every interval until ctx is cancelled.
+func (s *Service) RunTrashPurger(ctx context.Context, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if count, err := s.purgeDeletedMaps(ctx, retention); err == nil && count > 0 {
+			slog.InfoContext(ctx, "Purged maps from the trash", "count", count)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
\ No newline at end of file
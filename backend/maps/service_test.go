@@ -0,0 +1,141 @@
+package maps
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"example.com/echo-backend/auth"
+	"example.com/echo-backend/cache"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/dbtest"
+	"example.com/echo-backend/problem"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	pool := dbtest.Pool(t)
+	return NewService(db.New(pool), pool, cache.None{}, 1<<20)
+}
+
+// createTestMap creates a map named name in the workspace of ctx and returns
+// its id
+func createTestMap(t *testing.T, s *Service, ctx context.Context, name string) uuid.UUID {
+	t.Helper()
+	if err := s.createNewMap(ctx, MapCreationReq{Name: name}); err != nil {
+		t.Fatalf("createNewMap: %v", err)
+	}
+	maps, err := s.getMaps(ctx)
+	if err != nil {
+		t.Fatalf("getMaps: %v", err)
+	}
+	for _, m := range maps {
+		if m.Name.String == name {
+			return m.ID
+		}
+	}
+	t.Fatalf("map %q was not created", name)
+	return uuid.Nil
+}
+
+func containsMap(maps []db.Map, id uuid.UUID) bool {
+	for _, m := range maps {
+		if m.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTrash(t *testing.T) {
+	s := newTestService(t)
+	ctx, _ := dbtest.Workspace(t, s.db, "1")
+	id := createTestMap(t, s, ctx, "trash")
+
+	if err := s.deleteMap(ctx, id.String(), pgtype.Int4{}); err != nil {
+		t.Fatalf("deleteMap: %v", err)
+	}
+	if _, err := s.getMapById(ctx, id.String()); problem.StatusOf(err) != http.StatusNotFound {
+		t.Fatalf("getMapById of a trashed map = %v, want 404", err)
+	}
+	if maps, _ := s.getMaps(ctx); containsMap(maps, id) {
+		t.Fatal("getMaps lists a trashed map")
+	}
+	if trashed, _ := s.getTrashedMaps(ctx); !containsMap(trashed, id) {
+		t.Fatal("getTrashedMaps doesn't list the trashed map")
+	}
+	if err := s.deleteMap(ctx, id.String(), pgtype.Int4{}); problem.StatusOf(err) != http.StatusNotFound {
+		t.Fatalf("deleting a trashed map = %v, want 404", err)
+	}
+
+	if err := s.restoreMap(ctx, id.String()); err != nil {
+		t.Fatalf("restoreMap: %v", err)
+	}
+	if _, err := s.getMapById(ctx, id.String()); err != nil {
+		t.Fatalf("getMapById of a restored map: %v", err)
+	}
+	if trashed, _ := s.getTrashedMaps(ctx); containsMap(trashed, id) {
+		t.Fatal("getTrashedMaps lists a restored map")
+	}
+	if err := s.restoreMap(ctx, id.String()); problem.StatusOf(err) != http.StatusNotFound {
+		t.Fatalf("restoring a map that isn't trashed = %v, want 404", err)
+	}
+}
+
+// members who don't own the workspace only see the maps they own in the trash
+func TestTrashOfMembers(t *testing.T) {
+	s := newTestService(t)
+	ownerCtx, workspaceID := dbtest.Workspace(t, s.db, "1")
+	editorCtx := dbtest.As(workspaceID, "2", auth.RoleEditor)
+	ownersMap := createTestMap(t, s, ownerCtx, "owner's")
+	editorsMap := createTestMap(t, s, editorCtx, "editor's")
+	for _, id := range []uuid.UUID{ownersMap, editorsMap} {
+		if err := s.deleteMap(ownerCtx, id.String(), pgtype.Int4{}); err != nil {
+			t.Fatalf("deleteMap: %v", err)
+		}
+	}
+
+	trashed, err := s.getTrashedMaps(editorCtx)
+	if err != nil {
+		t.Fatalf("getTrashedMaps: %v", err)
+	}
+	if !containsMap(trashed, editorsMap) || containsMap(trashed, ownersMap) {
+		t.Fatalf("editor sees %v in the trash, want only their own map", trashed)
+	}
+	if trashed, _ := s.getTrashedMaps(ownerCtx); len(trashed) != 2 {
+		t.Fatalf("owner sees %d maps in the trash, want 2", len(trashed))
+	}
+}
+
+func TestPurgeDeletedMaps(t *testing.T) {
+	s := newTestService(t)
+	ctx, _ := dbtest.Workspace(t, s.db, "1")
+	id := createTestMap(t, s, ctx, "purged")
+	if err := s.deleteMap(ctx, id.String(), pgtype.Int4{}); err != nil {
+		t.Fatalf("deleteMap: %v", err)
+	}
+
+	if _, err := s.purgeDeletedMaps(context.Background(), time.Hour); err != nil {
+		t.Fatalf("purgeDeletedMaps: %v", err)
+	}
+	if trashed, _ := s.getTrashedMaps(ctx); !containsMap(trashed, id) {
+		t.Fatal("a map trashed just now was purged before the retention passed")
+	}
+
+	count, err := s.purgeDeletedMaps(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("purgeDeletedMaps: %v", err)
+	}
+	if count < 1 {
+		t.Fatalf("purgeDeletedMaps purged %d maps, want at least 1", count)
+	}
+	if trashed, _ := s.getTrashedMaps(ctx); containsMap(trashed, id) {
+		t.Fatal("a purged map is still in the trash")
+	}
+	if err := s.restoreMap(ctx, id.String()); problem.StatusOf(err) != http.StatusNotFound {
+		t.Fatalf("restoring a purged map = %v, want 404", err)
+	}
+}
@@ -0,0 +1,211 @@
+package maps
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"example.com/echo-backend/audit"
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// share links can't be made to last longer than this, leave expires_at out
+// for a link that stays valid until revoked
+const maxShareLinkLifetime = 365 * 24 * time.Hour
+
+type ShareLinkCreationReq struct {
+	// optional, links without an expiry stay valid until revoked
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type ShareLinkRes struct {
+	ID        uuid.UUID  `json:"id"`
+	MapID     uuid.UUID  `json:"map_id"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	// Token is only ever returned once, when the link is created
+	Token string `json:"token,omitempty"`
+}
+
+// sharedMap is everything needed to show a map to someone without an account
+type sharedMap struct {
+	mapInfo db.Map
+	doc     cachedMap
+}
+
+func (s *Service) createShareLink(ctx context.Context, id string, req ShareLinkCreationReq) (ShareLinkRes, error) {
+	ctx, span := tracer.Start(ctx, "maps.createShareLink")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return ShareLinkRes{}, err
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
+		return ShareLinkRes{}, InvalidUUIDError()
+	}
+	expiresAt := pgtype.Timestamptz{}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) || req.ExpiresAt.After(time.Now().Add(maxShareLinkLifetime)) {
+			return ShareLinkRes{}, InvalidExpiryError()
+		}
+		expiresAt = pgtype.Timestamptz{Time: *req.ExpiresAt, Valid: true}
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		slog.ErrorContext(ctx, "Generating share token failed", "err", err)
+		return ShareLinkRes{}, InternalServerError()
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	var res ShareLinkRes
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		link, err := q.CreateShareLink(ctx, db.CreateShareLinkParams{
+			MapID:       uuid,
+			WorkspaceID: workspaceID,
+			TokenHash:   hashShareToken(token),
+			CreatedBy:   actorOf(ctx),
+			ExpiresAt:   expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		res = toShareLinkRes(link)
+		return audit.Record(ctx, q, audit.Entry{
+			Action:      audit.ActionCreate,
+			EntityType:  audit.EntityShareLink,
+			EntityID:    link.ID,
+			MapID:       uuid,
+			WorkspaceID: workspaceID,
+			After:       res,
+		})
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Creating share link failed", "err", err)
+		return ShareLinkRes{}, InternalServerError()
+	}
+	res.Token = token
+	return res, nil
+}
+
+func (s *Service) getShareLinks(ctx context.Context, id string) ([]ShareLinkRes, error) {
+	ctx, span := tracer.Start(ctx, "maps.getShareLinks")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return []ShareLinkRes{}, err
+	}
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
+		return []ShareLinkRes{}, InvalidUUIDError()
+	}
+	rows, err := s.db.GetShareLinksByMapId(ctx, db.GetShareLinksByMapIdParams{
+		MapID:       uuid,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing share links failed", "err", err)
+		return []ShareLinkRes{}, InternalServerError()
+	}
+	links := make([]ShareLinkRes, 0, len(rows))
+	for _, row := range rows {
+		links = append(links, toShareLinkRes(row))
+	}
+	return links, nil
+}
+
+func (s *Service) revokeShareLink(ctx context.Context, id string, shareId string) error {
+	ctx, span := tracer.Start(ctx, "maps.revokeShareLink")
+	defer span.End()
+	workspaceID, err := workspaceOf(ctx)
+	if err != nil {
+		return err
+	}
+	mapId, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid map id", "err", err)
+		return InvalidUUIDError()
+	}
+	linkId, err := uuid.Parse(shareId)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid share link id", "err", err)
+		return InvalidUUIDError()
+	}
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		count, err := q.RevokeShareLink(ctx, db.RevokeShareLinkParams{
+			ID:          linkId,
+			MapID:       mapId,
+			WorkspaceID: workspaceID,
+		})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return pgx.ErrNoRows
+		}
+		return audit.Record(ctx, q, audit.Entry{
+			Action:      audit.ActionDelete,
+			EntityType:  audit.EntityShareLink,
+			EntityID:    linkId,
+			MapID:       mapId,
+			WorkspaceID: workspaceID,
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotFoundError()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Revoking share link failed", "err", err)
+		return InternalServerError()
+	}
+	return nil
+}
+
+// getSharedMap resolves a share token without any principal, expired or
+// revoked links and trashed maps are reported as not found
+func (s *Service) getSharedMap(ctx context.Context, token string) (sharedMap, error) {
+	ctx, span := tracer.Start(ctx, "maps.getSharedMap")
+	defer span.End()
+	mapInfo, err := s.db.GetSharedMapByTokenHash(ctx, hashShareToken(token))
+	if err != nil {
+		return sharedMap{}, dbError(ctx, "GetSharedMapByTokenHash", err, ShareLinkNotFoundError())
+	}
+	doc, err := s.loadMap(ctx, mapInfo.WorkspaceID, mapInfo.ID)
+	if err != nil {
+		return sharedMap{}, err
+	}
+	return sharedMap{mapInfo: mapInfo, doc: doc}, nil
+}
+
+// only a hash of each token is stored, like API keys
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func toShareLinkRes(link db.MapShareLink) ShareLinkRes {
+	res := ShareLinkRes{
+		ID:        link.ID,
+		MapID:     link.MapID,
+		CreatedBy: link.CreatedBy,
+		CreatedAt: link.CreatedAt,
+	}
+	if link.ExpiresAt.Valid {
+		res.ExpiresAt = &link.ExpiresAt.Time
+	}
+	if link.RevokedAt.Valid {
+		res.RevokedAt = &link.RevokedAt.Time
+	}
+	return res
+}
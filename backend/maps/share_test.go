@@ -0,0 +1,104 @@
+package maps
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/echo-backend/auth"
+	"example.com/echo-backend/cache"
+	"example.com/echo-backend/dbtest"
+	"example.com/echo-backend/problem"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestHashShareToken(t *testing.T) {
+	hash := hashShareToken("token")
+	if len(hash) != 64 || hash == "token" {
+		t.Fatalf("hashShareToken = %q, want a hex sha256", hash)
+	}
+	if hashShareToken("token") != hash || hashShareToken("other") == hash {
+		t.Fatal("hashShareToken isn't a function of the token")
+	}
+}
+
+// expiries are checked before anything is written
+func TestCreateShareLinkExpiry(t *testing.T) {
+	s := NewService(&fakeQuerier{}, nil, cache.None{}, 0)
+	ctx := dbtest.As(uuid.New(), "owner", auth.RoleOwner)
+	past := time.Now().Add(-time.Minute)
+	tooLate := time.Now().Add(maxShareLinkLifetime + time.Hour)
+	for _, expiresAt := range []*time.Time{&past, &tooLate} {
+		_, err := s.createShareLink(ctx, uuid.NewString(), ShareLinkCreationReq{ExpiresAt: expiresAt})
+		if problem.StatusOf(err) != http.StatusBadRequest {
+			t.Errorf("createShareLink expiring at %v = %v, want 400", expiresAt, err)
+		}
+	}
+	if _, err := s.createShareLink(ctx, "nope", ShareLinkCreationReq{}); problem.StatusOf(err) != http.StatusBadRequest {
+		t.Errorf("createShareLink with an invalid id = %v, want 400", err)
+	}
+}
+
+func TestSharedMap(t *testing.T) {
+	s := newTestService(t)
+	ctx, _ := dbtest.Workspace(t, s.db, "1")
+	req := MapCreationReq{Name: "shared", Image_url: "data:image/png;base64,aGk="}
+	if err := s.createNewMap(ctx, req); err != nil {
+		t.Fatalf("createNewMap: %v", err)
+	}
+	maps, err := s.getMaps(ctx)
+	if err != nil {
+		t.Fatalf("getMaps: %v", err)
+	}
+	id := maps[0].ID
+	link, err := s.createShareLink(ctx, id.String(), ShareLinkCreationReq{})
+	if err != nil {
+		t.Fatalf("createShareLink: %v", err)
+	}
+	links, err := s.getShareLinks(ctx, id.String())
+	if err != nil || len(links) != 1 || links[0].Token != "" {
+		t.Fatalf("getShareLinks = %+v, %v, want the link without its token", links, err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	NewController(e, s)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/shared/" + link.Token); rec.Code != http.StatusOK || rec.Header().Get("Referrer-Policy") != "no-referrer" {
+		t.Errorf("GET /shared = %d with Referrer-Policy %q", rec.Code, rec.Header().Get("Referrer-Policy"))
+	}
+	rec := get("/shared/" + link.Token + "/image")
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "image/png" || rec.Body.String() != "hi" {
+		t.Errorf("GET /shared/image = %d %s: %q", rec.Code, rec.Header().Get(echo.HeaderContentType), rec.Body)
+	}
+	if rec.Header().Get("X-Content-Type-Options") != "nosniff" || rec.Header().Get("Content-Security-Policy") != "default-src 'none'" {
+		t.Errorf("shared image headers = %v", rec.Header())
+	}
+	rec = get("/shared/" + link.Token + "/svg")
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "image/svg+xml" {
+		t.Errorf("GET /shared/svg = %d %s", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+	if rec.Header().Get("X-Content-Type-Options") != "nosniff" || rec.Header().Get("Content-Security-Policy") == "" || rec.Header().Get("ETag") == "" {
+		t.Errorf("shared svg headers = %v", rec.Header())
+	}
+	if rec := get("/shared/guess"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /shared with an unknown token = %d, want 404", rec.Code)
+	}
+
+	if err := s.revokeShareLink(ctx, id.String(), link.ID.String()); err != nil {
+		t.Fatalf("revokeShareLink: %v", err)
+	}
+	if rec := get("/shared/" + link.Token); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /shared with a revoked token = %d, want 404", rec.Code)
+	}
+	if err := s.revokeShareLink(ctx, id.String(), uuid.NewString()); problem.StatusOf(err) != http.StatusNotFound {
+		t.Errorf("revoking an unknown link = %v, want 404", err)
+	}
+}
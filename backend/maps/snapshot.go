@@ -0,0 +1,62 @@
+package maps
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// mapSnapshot is the state of a map as stored in the audit log
+type mapSnapshot struct {
+	Name     string     `json:"name"`
+	ImageUrl string     `json:"image_url"`
+	Zones    []MapZone  `json:"zones"`
+	Routes   []MapRoute `json:"routes"`
+}
+
+func newSnapshot(name string, imageUrl string, zones []MapZone, routes []MapRoute) mapSnapshot {
+	return mapSnapshot{
+		Name:     name,
+		ImageUrl: imageFingerprint(imageUrl),
+		Zones:    zones,
+		Routes:   routes,
+	}
+}
+
+// lockSnapshot locks the map for the rest of the transaction, checks it is
+// still at the expected version and reads what it looks like before the change
+func lockSnapshot(ctx context.Context, q db.Querier, workspaceID uuid.UUID, id uuid.UUID, expected pgtype.Int4) (mapSnapshot, error) {
+	version, err := q.LockMapVersion(ctx, db.LockMapVersionParams{
+		ID:          id,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return mapSnapshot{}, err
+	}
+	if expected.Valid && version != expected.Int32 {
+		return mapSnapshot{}, StaleVersionError(version)
+	}
+	row, err := q.GetMapWithAnnotations(ctx, db.GetMapWithAnnotationsParams{
+		ID:          id,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return mapSnapshot{}, err
+	}
+	zones, routes := annotationsOf(row)
+	return newSnapshot(row.Map.Name.String, row.Map.ImageUrl.String, zones, routes), nil
+}
+
+// base64 data URLs can be megabytes long, so only a digest of them is kept
+func imageFingerprint(imageUrl string) string {
+	if !strings.HasPrefix(imageUrl, "data:") {
+		return imageUrl
+	}
+	sum := sha256.Sum256([]byte(imageUrl))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
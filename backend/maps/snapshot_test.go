@@ -0,0 +1,86 @@
+package maps
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/dbtest"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestImageFingerprint(t *testing.T) {
+	dataUrl := "data:image/png;base64," + strings.Repeat("A", 1000)
+	tests := []struct {
+		imageUrl string
+		want     string
+	}{
+		{"", ""},
+		{"https://example.com/map.png", "https://example.com/map.png"},
+	}
+	for _, test := range tests {
+		if got := imageFingerprint(test.imageUrl); got != test.want {
+			t.Errorf("imageFingerprint(%.30q) = %q, want %q", test.imageUrl, got, test.want)
+		}
+	}
+	got := imageFingerprint(dataUrl)
+	if !strings.HasPrefix(got, "sha256:") || len(got) != len("sha256:")+64 {
+		t.Errorf("imageFingerprint of a data URL = %q, want a sha256 digest", got)
+	}
+	if got == imageFingerprint(dataUrl+"A") {
+		t.Error("different images have the same fingerprint")
+	}
+}
+
+// logging a map request shows the image's fingerprint, never the image
+func TestLogValue(t *testing.T) {
+	dataUrl := "data:image/png;base64," + strings.Repeat("QUFB", 500)
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	logger.Info("creating map", "req", MapCreationReq{Name: "plan", Image_url: dataUrl, Zones: make([]MapZone, 2)})
+	logger.Info("syncing map", "map", SyncMap{Name: "plan", ImageUrl: dataUrl})
+
+	logged := buf.String()
+	if strings.Contains(logged, "QUFB") {
+		t.Fatalf("the image was logged: %.200s", logged)
+	}
+	if strings.Count(logged, imageFingerprint(dataUrl)) != 2 || !strings.Contains(logged, `"zones":2`) {
+		t.Fatalf("logged %s", logged)
+	}
+}
+
+// the audit entry of a change has the map as it was before and after it
+func TestReplaceMapIsAudited(t *testing.T) {
+	s := newTestService(t)
+	ctx, workspaceID := dbtest.Workspace(t, s.db, "1")
+	id := createTestMap(t, s, ctx, "before")
+
+	if _, err := s.replaceMap(ctx, MapCreationReq{Name: "after"}, id.String(), pgtype.Int4{}); err != nil {
+		t.Fatalf("replaceMap: %v", err)
+	}
+
+	entries, err := s.db.GetAuditEntriesByMapId(ctx, db.GetAuditEntriesByMapIdParams{
+		MapID:       pgtype.UUID{Bytes: id, Valid: true},
+		WorkspaceID: workspaceID,
+		Limit:       10,
+	})
+	if err != nil {
+		t.Fatalf("GetAuditEntriesByMapId: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != "update" || entries[1].Action != "create" {
+		t.Fatalf("audit log has %d entries, want the create and then the update", len(entries))
+	}
+	var before, after mapSnapshot
+	if err := json.Unmarshal(entries[0].Before, &before); err != nil {
+		t.Fatalf("decoding before: %v", err)
+	}
+	if err := json.Unmarshal(entries[0].After, &after); err != nil {
+		t.Fatalf("decoding after: %v", err)
+	}
+	if before.Name != "before" || after.Name != "after" {
+		t.Errorf("name went from %q to %q, want before to after", before.Name, after.Name)
+	}
+}
@@ -0,0 +1,371 @@
+package maps
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/events"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	syncPageSize = 1000
+
+	SyncApplied  = "applied"
+	SyncConflict = "conflict"
+	SyncRejected = "rejected"
+)
+
+type SyncMap struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	ImageUrl  string    `json:"image_url"`
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LogValue keeps base64 images out of the logs
+func (m SyncMap) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", m.ID.String()),
+		slog.String("name", m.Name),
+		slog.String("image_url", imageFingerprint(m.ImageUrl)),
+		slog.Int("version", int(m.Version)),
+	)
+}
+
+type SyncDeleted struct {
+	Maps   []uuid.UUID `json:"maps"`
+	Zones  []uuid.UUID `json:"zones"`
+	Routes []uuid.UUID `json:"routes"`
+}
+
+// SyncRes holds the current state of everything that changed since the
+// cursor, and the ids of everything that is gone
+type SyncRes struct {
+	Cursor  string                   `json:"cursor"`
+	HasMore bool                     `json:"has_more"`
+	Maps    []SyncMap                `json:"maps"`
+	Zones   []db.MapAnnotationsZone  `json:"zones"`
+	Routes  []db.MapAnnotationsRoute `json:"routes"`
+	Deleted SyncDeleted              `json:"deleted"`
+}
+
+type SyncChange struct {
+	ClientChangeID string    `json:"client_change_id"`
+	MapID          uuid.UUID `json:"map_id"`
+	// the map version the client last synced, the change is a conflict if
+	// anyone else changed the map since
+	BaseVersion int32     `json:"base_version"`
+	Operation   Operation `json:"operation"`
+}
+
+type SyncReq struct {
+	Changes []SyncChange `json:"changes" validate:"required,max=500"`
+}
+
+type SyncApplyRes struct {
+	Results []SyncResult `json:"results"`
+}
+
+type SyncResult struct {
+	ClientChangeID string       `json:"client_change_id"`
+	Status         string       `json:"status"`
+	Version        int32        `json:"version,omitempty"`
+	Operation      *Operation   `json:"operation,omitempty"`
+	Error          *CustomError `json:"error,omitempty"`
+}
+
+func newSyncRes(cursor int64) SyncRes {
+	return SyncRes{
+		Cursor: strconv.FormatInt(cursor, 10),
+		Maps:   []SyncMap{},
+		Zones:  []db.MapAnnotationsZone{},
+		Routes: []db.MapAnnotationsRoute{},
+		Deleted: SyncDeleted{
+			Maps:   []uuid.UUID{},
+			Zones:  []uuid.UUID{},
+			Routes: []uuid.UUID{},
+		},
+	}
+}
+
+func toSyncMap(row db.Map) SyncMap {
+	return SyncMap{
+		ID:        row.ID,
+		Name:      row.Name.String,
+		ImageUrl:  row.ImageUrl.String,
+		Version:   row.Version,
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+// syncMember makes sure the principal can see every map of the workspace,
+// the sync covers all of them
+func syncMember(ctx context.Context) (auth.Principal, error) {
+	principal, err := principalOf(ctx)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if !auth.RoleAtLeast(principal.WorkspaceRole, auth.RoleViewer) {
+		return auth.Principal{}, ForbiddenError()
+	}
+	return principal, nil
+}
+
+// getFullSync returns every map, zone and route of the workspace. The cursor
+// is read first and leaves out transactions still running, so changes made
+// while reading, or committed late, come again on the next sync.
+func (s *Service) getFullSync(ctx context.Context, workspaceID uuid.UUID) (SyncRes, error) {
+	ctx, span := tracer.Start(ctx, "maps.getFullSync")
+	defer span.End()
+	cursor, err := s.db.GetLatestMapEventId(ctx, workspaceID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Reading latest map event failed", "err", err)
+		return SyncRes{}, InternalServerError()
+	}
+	res := newSyncRes(cursor)
+	maps, err := s.db.GetMaps(ctx, workspaceID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing maps failed", "err", err)
+		return SyncRes{}, InternalServerError()
+	}
+	for _, row := range maps {
+		res.Maps = append(res.Maps, toSyncMap(row))
+	}
+	if res.Zones, err = s.db.GetZonesByWorkspace(ctx, workspaceID); err != nil {
+		slog.ErrorContext(ctx, "Listing zones failed", "err", err)
+		return SyncRes{}, InternalServerError()
+	}
+	if res.Routes, err = s.db.GetRoutesByWorkspace(ctx, workspaceID); err != nil {
+		slog.ErrorContext(ctx, "Listing routes failed", "err", err)
+		return SyncRes{}, InternalServerError()
+	}
+	return res, nil
+}
+
+// getSync replays the change feed after since, in the same order as /events.
+// Whatever an event touched is looked up as it is now, so several changes to
+// one zone come back once and anything no longer there is a tombstone.
+func (s *Service) getSync(ctx context.Context, since string) (SyncRes, error) {
+	ctx, span := tracer.Start(ctx, "maps.getSync")
+	defer span.End()
+	principal, err := syncMember(ctx)
+	if err != nil {
+		return SyncRes{}, err
+	}
+	if since == "" {
+		return s.getFullSync(ctx, principal.WorkspaceID)
+	}
+	cursor, err := strconv.ParseInt(since, 10, 64)
+	if err != nil || cursor < 0 {
+		return SyncRes{}, InvalidCursorError()
+	}
+	// the feed is read from the cursor's transaction, so it has to be one of
+	// this workspace's events
+	if cursor > 0 {
+		exists, err := s.db.MapEventExistsInWorkspace(ctx, db.MapEventExistsInWorkspaceParams{
+			ID:          cursor,
+			WorkspaceID: principal.WorkspaceID,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Reading sync cursor failed", "err", err)
+			return SyncRes{}, InternalServerError()
+		}
+		if !exists {
+			return SyncRes{}, InvalidCursorError()
+		}
+	}
+
+	rows, err := s.db.GetMapEventsSince(ctx, db.GetMapEventsSinceParams{
+		WorkspaceID: principal.WorkspaceID,
+		ID:          cursor,
+		Limit:       syncPageSize,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing map events failed", "err", err)
+		return SyncRes{}, InternalServerError()
+	}
+	if len(rows) > 0 {
+		cursor = rows[len(rows)-1].ID
+	}
+	res := newSyncRes(cursor)
+	res.HasMore = len(rows) == syncPageSize
+
+	mapIDs, zoneIDs, routeIDs := []uuid.UUID{}, []uuid.UUID{}, []uuid.UUID{}
+	// maps that (re)appeared bring all their zones and routes with them
+	createdMaps := []uuid.UUID{}
+	for _, row := range rows {
+		entity, action, _ := strings.Cut(row.Type, ".")
+		switch entity {
+		case events.EntityMap:
+			mapIDs = append(mapIDs, row.EntityID)
+			if action == events.ActionCreated {
+				createdMaps = append(createdMaps, row.EntityID)
+			}
+		case events.EntityZone:
+			zoneIDs = append(zoneIDs, row.EntityID)
+		case events.EntityRoute:
+			routeIDs = append(routeIDs, row.EntityID)
+		}
+	}
+	for _, id := range createdMaps {
+		mapID := pgtype.UUID{Bytes: id, Valid: true}
+		zones, err := s.db.GetZoneAnnotationsByMapId(ctx, mapID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Listing zone annotations failed", "err", err, "map_id", id)
+			return SyncRes{}, InternalServerError()
+		}
+		for _, zone := range zones {
+			zoneIDs = append(zoneIDs, zone.ID)
+		}
+		routes, err := s.db.GetRouteAnnotationsByMapId(ctx, mapID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Listing route annotations failed", "err", err, "map_id", id)
+			return SyncRes{}, InternalServerError()
+		}
+		for _, route := range routes {
+			routeIDs = append(routeIDs, route.ID)
+		}
+	}
+	mapIDs, zoneIDs, routeIDs = unique(mapIDs), unique(zoneIDs), unique(routeIDs)
+
+	maps, err := s.db.GetMapsByIds(ctx, db.GetMapsByIdsParams{WorkspaceID: principal.WorkspaceID, Ids: mapIDs})
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing changed maps failed", "err", err)
+		return SyncRes{}, InternalServerError()
+	}
+	found := map[uuid.UUID]bool{}
+	for _, row := range maps {
+		res.Maps = append(res.Maps, toSyncMap(row))
+		found[row.ID] = true
+	}
+	res.Deleted.Maps = missing(mapIDs, found)
+
+	zones, err := s.db.GetZonesByIds(ctx, db.GetZonesByIdsParams{WorkspaceID: principal.WorkspaceID, Ids: zoneIDs})
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing changed zones failed", "err", err)
+		return SyncRes{}, InternalServerError()
+	}
+	found = map[uuid.UUID]bool{}
+	for _, row := range zones {
+		res.Zones = append(res.Zones, row)
+		found[row.ID] = true
+	}
+	res.Deleted.Zones = missing(zoneIDs, found)
+
+	routes, err := s.db.GetRoutesByIds(ctx, db.GetRoutesByIdsParams{WorkspaceID: principal.WorkspaceID, Ids: routeIDs})
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing changed routes failed", "err", err)
+		return SyncRes{}, InternalServerError()
+	}
+	found = map[uuid.UUID]bool{}
+	for _, row := range routes {
+		res.Routes = append(res.Routes, row)
+		found[row.ID] = true
+	}
+	res.Deleted.Routes = missing(routeIDs, found)
+
+	return res, nil
+}
+
+func unique(ids []uuid.UUID) []uuid.UUID {
+	seen := map[uuid.UUID]bool{}
+	res := []uuid.UUID{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+func missing(ids []uuid.UUID, found map[uuid.UUID]bool) []uuid.UUID {
+	res := []uuid.UUID{}
+	for _, id := range ids {
+		if !found[id] {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+func (con *Controller) getSync(c echo.Context) error {
+	ctx := c.Request().Context()
+	res, err := con.service.getSync(ctx, c.QueryParam("since"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// applySync applies a batch of offline changes in order. Each change is
+// checked against the map version the client based it on, later changes to
+// the same map from the same base take the version of the change before.
+// One failed change doesn't stop the rest.
+func (con *Controller) applySync(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, err := syncMember(ctx)
+	if err != nil {
+		return err
+	}
+	req := SyncReq{}
+	if err := c.Bind(&req); err != nil {
+		return BadRequestError()
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	type progress struct {
+		base    int32
+		current int32
+	}
+	applied := map[uuid.UUID]progress{}
+	results := make([]SyncResult, 0, len(req.Changes))
+	for _, change := range req.Changes {
+		result := SyncResult{ClientChangeID: change.ClientChangeID}
+		if err := validateOperation(change.Operation, c.Validate); err != nil {
+			result.Status = SyncRejected
+			result.Error = err.(*CustomError)
+			results = append(results, result)
+			continue
+		}
+		expected := change.BaseVersion
+		if p, ok := applied[change.MapID]; ok && p.base == change.BaseVersion {
+			expected = p.current
+		}
+
+		op, version, err := con.hub.applyOperation(ctx, change.MapID, change.Operation,
+			pgtype.Int4{Int32: expected, Valid: true}, principal.String(), change.ClientChangeID)
+		customErr := InternalServerError()
+		if e, ok := err.(*CustomError); ok {
+			customErr = e
+		}
+		switch {
+		case err == nil:
+			applied[change.MapID] = progress{base: change.BaseVersion, current: version}
+			result.Status = SyncApplied
+			result.Version = version
+			result.Operation = &op
+		case customErr.Status == http.StatusPreconditionFailed:
+			result.Status = SyncConflict
+			result.Version = customErr.CurrentVersion
+			result.Error = customErr
+		default:
+			result.Status = SyncRejected
+			result.Error = customErr
+		}
+		results = append(results, result)
+	}
+	return c.JSON(http.StatusOK, SyncApplyRes{Results: results})
+}
@@ -0,0 +1,108 @@
+package maps
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"example.com/echo-backend/auth"
+	"example.com/echo-backend/cache"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/dbtest"
+	"example.com/echo-backend/problem"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestUniqueAndMissing(t *testing.T) {
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	got := unique([]uuid.UUID{a, b, a, c, b})
+	if len(got) != 3 || got[0] != a || got[1] != b || got[2] != c {
+		t.Fatalf("unique = %v, want %v in order", got, []uuid.UUID{a, b, c})
+	}
+	if got := unique(nil); got == nil || len(got) != 0 {
+		t.Fatalf("unique(nil) = %#v, want an empty slice", got)
+	}
+	if got := missing([]uuid.UUID{a, b, c}, map[uuid.UUID]bool{b: true}); len(got) != 2 || got[0] != a || got[1] != c {
+		t.Fatalf("missing = %v, want %v", got, []uuid.UUID{a, c})
+	}
+}
+
+// syncQuerier knows which workspace each event belongs to, any other query
+// panics
+type syncQuerier struct {
+	db.Querier
+	events map[int64]uuid.UUID
+}
+
+func (q *syncQuerier) MapEventExistsInWorkspace(ctx context.Context, arg db.MapEventExistsInWorkspaceParams) (bool, error) {
+	return q.events[arg.ID] == arg.WorkspaceID, nil
+}
+
+// cursors are checked before the feed is read
+func TestGetSyncCursor(t *testing.T) {
+	workspaceID := uuid.New()
+	s := NewService(&syncQuerier{events: map[int64]uuid.UUID{7: uuid.New()}}, nil, cache.None{}, 0)
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		since  string
+		status int
+	}{
+		{name: "not a number", ctx: dbtest.As(workspaceID, "1", auth.RoleViewer), since: "abc", status: http.StatusBadRequest},
+		{name: "negative", ctx: dbtest.As(workspaceID, "1", auth.RoleViewer), since: "-1", status: http.StatusBadRequest},
+		{name: "event of another workspace", ctx: dbtest.As(workspaceID, "1", auth.RoleViewer), since: "7", status: http.StatusBadRequest},
+		{name: "unknown event", ctx: dbtest.As(workspaceID, "1", auth.RoleViewer), since: "8", status: http.StatusBadRequest},
+		{name: "not a member", ctx: dbtest.As(workspaceID, "1", ""), since: "7", status: http.StatusForbidden},
+		{name: "no principal", ctx: context.Background(), since: "7", status: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := s.getSync(test.ctx, test.since); problem.StatusOf(err) != test.status {
+				t.Fatalf("getSync = %v, want %d", err, test.status)
+			}
+		})
+	}
+}
+
+func TestSync(t *testing.T) {
+	s := newTestService(t)
+	ctx, _ := dbtest.Workspace(t, s.db, "1")
+	full, err := s.getSync(ctx, "")
+	if err != nil {
+		t.Fatalf("full sync: %v", err)
+	}
+	if len(full.Maps) != 0 {
+		t.Fatalf("full sync of a new workspace = %+v, want no maps", full)
+	}
+
+	triangle := pgtype.Polygon{P: []pgtype.Vec2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}}, Valid: true}
+	if err := s.createNewMap(ctx, MapCreationReq{Name: "synced", Zones: []MapZone{{Polygon: triangle}}}); err != nil {
+		t.Fatalf("createNewMap: %v", err)
+	}
+	changed, err := s.getSync(ctx, full.Cursor)
+	if err != nil {
+		t.Fatalf("getSync: %v", err)
+	}
+	if len(changed.Maps) != 1 || len(changed.Zones) != 1 || changed.Cursor == full.Cursor || changed.HasMore {
+		t.Fatalf("sync after creating a map = %+v, want the map and its zone", changed)
+	}
+	id := changed.Maps[0].ID
+
+	if err := s.deleteMap(ctx, id.String(), pgtype.Int4{}); err != nil {
+		t.Fatalf("deleteMap: %v", err)
+	}
+	deleted, err := s.getSync(ctx, changed.Cursor)
+	if err != nil {
+		t.Fatalf("getSync: %v", err)
+	}
+	if len(deleted.Maps) != 0 || len(deleted.Deleted.Maps) != 1 || deleted.Deleted.Maps[0] != id {
+		t.Fatalf("sync after trashing the map = %+v, want a tombstone", deleted)
+	}
+
+	// a cursor only means something in its own workspace
+	other, _ := dbtest.Workspace(t, s.db, "1")
+	if _, err := s.getSync(other, changed.Cursor); problem.StatusOf(err) != http.StatusBadRequest {
+		t.Fatalf("getSync with another workspace's cursor = %v, want 400", err)
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/echo-backend/problem"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	e.Use(m.Middleware())
+	e.GET("/map/:id", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	e.DELETE("/map/:id", func(c echo.Context) error { return &problem.Error{Status: http.StatusConflict, Code: "conflict"} })
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/map/1", nil),
+		httptest.NewRequest(http.MethodGet, "/map/2", nil),
+		httptest.NewRequest(http.MethodDelete, "/map/1", nil),
+		httptest.NewRequest(http.MethodGet, "/nowhere", nil),
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+	}
+
+	tests := []struct {
+		method, route, status string
+		want                  float64
+	}{
+		// map IDs share the route's series
+		{http.MethodGet, "/map/:id", "204", 2},
+		// the status is the one the error was rendered with
+		{http.MethodDelete, "/map/:id", "409", 1},
+		{http.MethodGet, "unmatched", "404", 1},
+	}
+	for _, test := range tests {
+		if got := testutil.ToFloat64(m.requests.WithLabelValues(test.method, test.route, test.status)); got != test.want {
+			t.Errorf("requests %s %s %s = %v, want %v", test.method, test.route, test.status, got, test.want)
+		}
+	}
+	if got := testutil.CollectAndCount(m.duration); got != 3 {
+		t.Errorf("duration has %d series, want 3", got)
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	m := New()
+	m.requests.WithLabelValues(http.MethodGet, "/maps", "200").Inc()
+	server := httptest.NewServer(NewServer(":0", m).Handler)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `http_requests_total{method="GET",route="/maps",status="200"} 1`) {
+		t.Fatalf("/metrics = %d %s", res.StatusCode, body)
+	}
+
+	res, err = http.Get(server.URL + "/maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("/maps on the metrics server = %d, want 404", res.StatusCode)
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolAcquired = prometheus.NewDesc("db_pool_acquired_connections", "Connections currently in use.", nil, nil)
+	poolIdle     = prometheus.NewDesc("db_pool_idle_connections", "Connections open and waiting to be used.", nil, nil)
+	poolTotal    = prometheus.NewDesc("db_pool_total_connections", "Connections open, in use, idle or being opened.", nil, nil)
+	poolMax      = prometheus.NewDesc("db_pool_max_connections", "Most connections the pool may open.", nil, nil)
+	poolAcquires = prometheus.NewDesc("db_pool_acquires_total", "Connections acquired from the pool.", nil, nil)
+	// when this grows the pool is too small
+	poolWaits    = prometheus.NewDesc("db_pool_empty_acquires_total", "Acquires that had to wait because no connection was idle.", nil, nil)
+	poolWaitTime = prometheus.NewDesc("db_pool_acquire_wait_seconds_total", "Time spent acquiring connections.", nil, nil)
+)
+
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+// Pool reports the pool's stats on every scrape
+func Pool(pool *pgxpool.Pool) prometheus.Collector {
+	return poolCollector{pool: pool}
+}
+
+func (p poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquired
+	ch <- poolIdle
+	ch <- poolTotal
+	ch <- poolMax
+	ch <- poolAcquires
+	ch <- poolWaits
+	ch <- poolWaitTime
+}
+
+func (p poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := p.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotal, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMax, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolWaits, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolWaitTime, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
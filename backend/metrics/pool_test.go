@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPool(t *testing.T) {
+	config, err := pgxpool.ParseConfig("postgres://127.0.0.1:1/maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MaxConns = 7
+	// the pool only connects on first use
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	collector := Pool(pool)
+	if got := testutil.CollectAndCount(collector); got != 7 {
+		t.Fatalf("collected %d metrics, want 7", got)
+	}
+	if err := testutil.CollectAndCompare(collector, strings.NewReader("# HELP db_pool_max_connections Most connections the pool may open.\n# TYPE db_pool_max_connections gauge\ndb_pool_max_connections 7\n"), "db_pool_max_connections"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"example.com/echo-backend/tracing"
+	"github.com/jackc/pgx/v5"
+)
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	name string
+	at   time.Time
+}
+
+// QueryTracer times every query made through the pool, transactions
+// included. Set it as the pool's ConnConfig.Tracer.
+func (m *Metrics) QueryTracer() pgx.QueryTracer {
+	return queryTracer{m: m}
+}
+
+type queryTracer struct {
+	m *Metrics
+}
+
+func (t queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{name: queryName(data.SQL), at: time.Now()})
+}
+
+func (t queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	outcome := "ok"
+	if data.Err != nil {
+		outcome = "error"
+	}
+	t.m.queries.WithLabelValues(start.name, outcome).Observe(time.Since(start.at).Seconds())
+}
+
+// queryName labels queries by their sqlc name, e.g. GetMapById
+func queryName(sql string) string {
+	if name := tracing.QueryName(sql); name != "" {
+		return name
+	}
+	return "other"
+}
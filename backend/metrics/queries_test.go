@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"-- name: GetMapById :one\nSELECT * FROM maps", "GetMapById"},
+		{"SELECT 1", "other"},
+		{"", "other"},
+	}
+	for _, test := range tests {
+		if got := queryName(test.sql); got != test.want {
+			t.Errorf("queryName(%q) = %q, want %q", test.sql, got, test.want)
+		}
+	}
+}
+
+func TestQueryTracer(t *testing.T) {
+	m := New()
+	tracer := m.QueryTracer()
+	run := func(sql string, err error) {
+		ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: err})
+	}
+	run("-- name: GetMapById :one\nSELECT", nil)
+	run("-- name: GetMapById :one\nSELECT", nil)
+	run("-- name: DeleteMap :exec\nUPDATE", errors.New("boom"))
+	run("BEGIN", nil)
+	// an end without a start is ignored
+	tracer.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{})
+
+	families, err := m.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() != "db_query_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			got[labels["query"]+" "+labels["outcome"]] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	want := map[string]uint64{"other ok": 1, "GetMapById ok": 2, "DeleteMap error": 1}
+	if len(got) != len(want) {
+		t.Fatalf("queries = %v, want %v", got, want)
+	}
+	for series, count := range want {
+		if got[series] != count {
+			t.Errorf("queries %s = %d, want %d", series, got[series], count)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	db "example.com/echo-backend/db/gen"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const totalsTimeout = 5 * time.Second
+
+var (
+	mapsTotal   = prometheus.NewDesc("maps", "Maps across all workspaces, not counting the trash.", nil, nil)
+	zonesTotal  = prometheus.NewDesc("map_zones", "Zones on maps that are not in the trash.", nil, nil)
+	routesTotal = prometheus.NewDesc("map_routes", "Routes on maps that are not in the trash.", nil, nil)
+)
+
+// Totals reports the number of maps, zones and routes last counted by Run,
+// scrapes never reach the database. The gauges are left out until the
+// first count succeeds.
+type Totals struct {
+	db db.Querier
+
+	mu      sync.Mutex
+	totals  db.CountTotalsRow
+	counted bool
+}
+
+func NewTotals(db db.Querier) *Totals {
+	return &Totals{db: db}
+}
+
+// Run counts the totals every interval until ctx is cancelled, keeping the
+// last count when the database can't be reached
+func (t *Totals) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		t.count(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Totals) count(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, totalsTimeout)
+	defer cancel()
+	totals, err := t.db.CountTotals(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Metrics: counting totals failed", "err", err)
+		return
+	}
+	t.mu.Lock()
+	t.totals = totals
+	t.counted = true
+	t.mu.Unlock()
+}
+
+func (t *Totals) Describe(ch chan<- *prometheus.Desc) {
+	ch <- mapsTotal
+	ch <- zonesTotal
+	ch <- routesTotal
+}
+
+func (t *Totals) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	totals, counted := t.totals, t.counted
+	t.mu.Unlock()
+	if !counted {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(mapsTotal, prometheus.GaugeValue, float64(totals.Maps))
+	ch <- prometheus.MustNewConstMetric(zonesTotal, prometheus.GaugeValue, float64(totals.Zones))
+	ch <- prometheus.MustNewConstMetric(routesTotal, prometheus.GaugeValue, float64(totals.Routes))
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	db "example.com/echo-backend/db/gen"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeQuerier answers CountTotals, any other query panics
+type fakeQuerier struct {
+	db.Querier
+	totals db.CountTotalsRow
+	err    error
+}
+
+func (q *fakeQuerier) CountTotals(ctx context.Context) (db.CountTotalsRow, error) {
+	return q.totals, q.err
+}
+
+func TestTotals(t *testing.T) {
+	q := &fakeQuerier{err: errors.New("down")}
+	totals := NewTotals(q)
+	totals.count(context.Background())
+	if got := testutil.CollectAndCount(totals); got != 0 {
+		t.Fatalf("collected %d gauges before the first count, want none", got)
+	}
+
+	q.totals, q.err = db.CountTotalsRow{Maps: 2, Zones: 5, Routes: 1}, nil
+	totals.count(context.Background())
+	want := `
+# HELP maps Maps across all workspaces, not counting the trash.
+# TYPE maps gauge
+maps 2
+# HELP map_routes Routes on maps that are not in the trash.
+# TYPE map_routes gauge
+map_routes 1
+# HELP map_zones Zones on maps that are not in the trash.
+# TYPE map_zones gauge
+map_zones 5
+`
+	if err := testutil.CollectAndCompare(totals, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed count keeps the last one
+	q.err = errors.New("down")
+	totals.count(context.Background())
+	if err := testutil.CollectAndCompare(totals, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTotalsRun(t *testing.T) {
+	totals := NewTotals(&fakeQuerier{totals: db.CountTotalsRow{Maps: 1}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		totals.Run(ctx, time.Hour)
+		close(done)
+	}()
+	// the first count doesn't wait for the interval
+	deadline := time.Now().Add(time.Second)
+	for testutil.CollectAndCount(totals) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if got := testutil.CollectAndCount(totals); got != 3 {
+		t.Fatalf("collected %d gauges, want 3", got)
+	}
+}
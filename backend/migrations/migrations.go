@@ -0,0 +1,231 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5"
+)
+
+const usage = `usage: backend migrate [flags] <command>
+
+commands:
+  up [N]     apply all pending migrations, or the next N
+  down [N]   revert the last N migrations, 1 by default
+  to N       migrate up or down to version N
+  status     print the current and the latest version
+  force N    mark the schema as version N without running anything,
+             only to recover from a failed migration
+  owner USER make USER, e.g. user:42, an owner of the Default workspace
+             that maps and API keys from before workspaces were moved to`
+
+// DefaultWorkspace holds everything created before workspaces existed, see
+// migration 000007. It starts without members.
+const DefaultWorkspace = "00000000-0000-0000-0000-000000000001"
+
+// Latest is the version of the newest migration in dir
+func Latest(dir string) (uint, error) {
+	src, err := source.Open("file://" + dir)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// Verify checks that the database schema is at the version of the newest
+// migration, it never changes the schema
+func Verify(dir string, databaseURL string) error {
+	latest, err := Latest(dir)
+	if err != nil {
+		return err
+	}
+	m, err := migrate.New("file://"+dir, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return fmt.Errorf("database has no schema, run `backend migrate up` to create version %d", latest)
+	}
+	if err != nil {
+		return err
+	}
+	return compare(version, dirty, latest)
+}
+
+// Row is what CheckVersion needs from a pool or connection
+type Row interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// CheckVersion is Verify for readiness probes, it reads the version through
+// an existing pool instead of opening a connection
+func CheckVersion(ctx context.Context, conn Row, latest uint) error {
+	var version int64
+	var dirty bool
+	err := conn.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("database has no schema, run `backend migrate up` to create version %d", latest)
+	}
+	if err != nil {
+		return err
+	}
+	return compare(uint(version), dirty, latest)
+}
+
+func compare(version uint, dirty bool, latest uint) error {
+	if dirty {
+		return fmt.Errorf("migration %d failed halfway, fix the schema by hand and run `backend migrate force %d`", version, version)
+	}
+	if version < latest {
+		return fmt.Errorf("database schema is at version %d but this build needs %d, run `backend migrate up`", version, latest)
+	}
+	if version > latest {
+		return fmt.Errorf("database schema is at version %d, newer than this build's %d, deploy a newer build or run `backend migrate to %d`", version, latest, latest)
+	}
+	return nil
+}
+
+// Run runs the migrate subcommand with its arguments, e.g. up or to 3
+func Run(args []string, dir string, databaseURL string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	m, err := migrate.New("file://"+dir, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "owner":
+		if len(args) != 1 {
+			return errors.New(usage)
+		}
+		if err := grantDefaultOwner(context.Background(), databaseURL, args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s owns the Default workspace\n", args[0])
+	case "up":
+		n, err := optionalNumber(args, 0)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			err = m.Up()
+		} else {
+			err = m.Steps(n)
+		}
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+	case "down":
+		n, err := optionalNumber(args, 1)
+		if err != nil {
+			return err
+		}
+		if err := m.Steps(-n); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+	case "to":
+		n, err := requiredNumber(args)
+		if err != nil {
+			return err
+		}
+		if err := m.Migrate(uint(n)); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+	case "force":
+		n, err := requiredNumber(args)
+		if err != nil {
+			return err
+		}
+		if err := m.Force(n); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return fmt.Errorf("unknown command %q\n%s", command, usage)
+	}
+	return printStatus(m, dir, out)
+}
+
+// grantDefaultOwner gives subject back access to the maps created before
+// workspaces, which no user can reach until someone owns their workspace
+func grantDefaultOwner(ctx context.Context, databaseURL string, subject string) error {
+	if id, ok := strings.CutPrefix(subject, "user:"); !ok || id == "" {
+		return fmt.Errorf("%q is not a user like user:42", subject)
+	}
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	_, err = conn.Exec(ctx, `INSERT INTO workspace_members (workspace_id, subject, role, granted_by)
+		VALUES ($1, $2, 'owner', 'migrate')
+		ON CONFLICT (workspace_id, subject) DO UPDATE SET role = 'owner'`, DefaultWorkspace, subject)
+	return err
+}
+
+func printStatus(m *migrate.Migrate, dir string, out io.Writer) error {
+	latest, err := Latest(dir)
+	if err != nil {
+		return err
+	}
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		fmt.Fprintf(out, "version: none\nlatest: %d\n", latest)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "version: %d\nlatest: %d\n", version, latest)
+	if dirty {
+		fmt.Fprintln(out, "dirty: the last migration failed, fix the schema and run force")
+	}
+	return nil
+}
+
+func optionalNumber(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+	return requiredNumber(args)
+}
+
+func requiredNumber(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New(usage)
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a migration number\n%s", args[0], usage)
+	}
+	return n, nil
+}
@@ -0,0 +1,157 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const dir = "../db/migration"
+
+func TestLatest(t *testing.T) {
+	latest, err := Latest(dir)
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	if latest != 16 {
+		t.Fatalf("Latest = %d, want 16", latest)
+	}
+	if _, err := Latest(t.TempDir()); err == nil {
+		t.Fatal("Latest of an empty directory succeeded")
+	}
+}
+
+// every migration can be reverted, and versions leave no gaps
+func TestMigrationFiles(t *testing.T) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+	ups := 0
+	for name := range names {
+		base, ok := strings.CutSuffix(name, ".up.sql")
+		if !ok {
+			if !strings.HasSuffix(name, ".down.sql") {
+				t.Errorf("%s is neither an up nor a down migration", name)
+			}
+			continue
+		}
+		ups++
+		if !names[base+".down.sql"] {
+			t.Errorf("%s has no down migration", name)
+		}
+		if content, err := os.ReadFile(filepath.Join(dir, name)); err != nil || len(strings.TrimSpace(string(content))) == 0 {
+			t.Errorf("%s is empty", name)
+		}
+	}
+	if ups*2 != len(names) {
+		t.Errorf("%d up migrations for %d files", ups, len(names))
+	}
+	if latest, _ := Latest(dir); uint(ups) != latest {
+		t.Errorf("%d up migrations but the latest is %d, a version is missing", ups, latest)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		version uint
+		dirty   bool
+		want    string
+	}{
+		{16, false, ""},
+		{16, true, "migrate force 16"},
+		{15, false, "run `backend migrate up`"},
+		{17, false, "migrate to 16"},
+	}
+	for _, test := range tests {
+		err := compare(test.version, test.dirty, 16)
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("compare(%d, %v) = %v, want nil", test.version, test.dirty, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("compare(%d, %v) = %v, want it to mention %s", test.version, test.dirty, err, test.want)
+		}
+	}
+}
+
+type fakeRow struct {
+	version int64
+	dirty   bool
+	err     error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*int64) = r.version
+	*dest[1].(*bool) = r.dirty
+	return nil
+}
+
+type fakeConn struct{ row fakeRow }
+
+func (c fakeConn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return c.row
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		row fakeRow
+		ok  bool
+	}{
+		{fakeRow{version: 16}, true},
+		{fakeRow{version: 16, dirty: true}, false},
+		{fakeRow{version: 14}, false},
+		{fakeRow{err: pgx.ErrNoRows}, false},
+		{fakeRow{err: errors.New("boom")}, false},
+	}
+	for _, test := range tests {
+		err := CheckVersion(context.Background(), fakeConn{test.row}, 16)
+		if (err == nil) != test.ok {
+			t.Errorf("CheckVersion with %+v = %v", test.row, err)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	if n, err := optionalNumber(nil, 1); n != 1 || err != nil {
+		t.Errorf("optionalNumber without args = %d, %v, want the fallback", n, err)
+	}
+	if n, err := optionalNumber([]string{"3"}, 1); n != 3 || err != nil {
+		t.Errorf("optionalNumber(3) = %d, %v", n, err)
+	}
+	for _, args := range [][]string{nil, {"-1"}, {"two"}, {"1", "2"}} {
+		if _, err := requiredNumber(args); err == nil {
+			t.Errorf("requiredNumber(%v) succeeded", args)
+		}
+	}
+}
+
+// the subject is checked before connecting
+func TestGrantDefaultOwnerSubject(t *testing.T) {
+	for _, subject := range []string{"42", "user:", "apikey:1", ""} {
+		err := grantDefaultOwner(context.Background(), "postgres://nowhere.invalid/db", subject)
+		if err == nil || !strings.Contains(err.Error(), "is not a user") {
+			t.Errorf("grantDefaultOwner(%q) = %v, want it refused", subject, err)
+		}
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	if err := Run(nil, dir, "postgres://nowhere.invalid/db", nil); err == nil || !strings.Contains(err.Error(), "usage:") {
+		t.Fatalf("Run without a command = %v, want the usage", err)
+	}
+}
@@ -0,0 +1,20 @@
+package migrations_test
+
+import (
+	"context"
+	"testing"
+
+	"example.com/echo-backend/dbtest"
+	"example.com/echo-backend/migrations"
+)
+
+func TestCheckVersionOfTestDatabase(t *testing.T) {
+	pool := dbtest.Pool(t)
+	latest, err := migrations.Latest("../db/migration")
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	if err := migrations.CheckVersion(context.Background(), pool, latest); err != nil {
+		t.Fatalf("CheckVersion after migrating up: %v", err)
+	}
+}
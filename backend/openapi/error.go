@@ -0,0 +1,18 @@
+package openapi
+
+import (
+	"net/http"
+
+	"example.com/echo-backend/problem"
+)
+
+type CustomError = problem.Error
+
+func InvalidRequestError(fields []problem.FieldError) *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "schema_mismatch"
+	err.Message = "Request does not match the API schema"
+	err.Fields = fields
+	return &err
+}
@@ -0,0 +1,135 @@
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/echo-backend/problem"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+func init() {
+	// validate ids the same way the handlers parse them
+	openapi3.DefineStringFormatCallback("uuid", func(value string) error {
+		_, err := uuid.Parse(value)
+		return err
+	})
+	// keep the whole schema out of validation messages
+	openapi3.SchemaErrorDetailsDisabled = true
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", openapi3filter.RegisteredBodyDecoder(echo.MIMEApplicationJSON))
+}
+
+// Load parses and validates the embedded OpenAPI document
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+type Controller struct {
+	document []byte
+}
+
+func NewController(e *echo.Echo, doc *openapi3.T) error {
+	document, err := doc.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	c := &Controller{document: document}
+	e.GET("/openapi.json", c.getDocument)
+	return nil
+}
+
+func (con *Controller) getDocument(c echo.Context) error {
+	return c.JSONBlob(http.StatusOK, con.document)
+}
+
+// Middleware rejects requests whose parameters or body don't match the
+// document, routes it doesn't describe are left to echo
+func Middleware(doc *openapi3.T) (echo.MiddlewareFunc, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	options := &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			route, pathParams, err := router.FindRoute(c.Request())
+			if errors.Is(err, routers.ErrPathNotFound) || errors.Is(err, routers.ErrMethodNotAllowed) {
+				return next(c)
+			}
+			if err != nil {
+				return err
+			}
+			err = openapi3filter.ValidateRequest(c.Request().Context(), &openapi3filter.RequestValidationInput{
+				Request:    c.Request(),
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			})
+			if err != nil {
+				return InvalidRequestError(fieldErrors(err))
+			}
+			return next(c)
+		}
+	}, nil
+}
+
+// fieldErrors points at the parameter or body field kin-openapi rejected
+func fieldErrors(err error) []problem.FieldError {
+	field := problem.FieldError{Field: "body", Message: err.Error()}
+	var requestErr *openapi3filter.RequestError
+	if errors.As(err, &requestErr) {
+		if requestErr.Parameter != nil {
+			field.Field = requestErr.Parameter.Name
+		}
+		field.Message = requestErr.Reason
+	}
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		if field.Field == "body" {
+			if path := fieldPath(schemaErr.JSONPointer()); path != "" {
+				field.Field = path
+			}
+		}
+		field.Rule = schemaErr.SchemaField
+		field.Message = schemaErr.Reason
+	} else if requestErr != nil && requestErr.Err != nil {
+		field.Message = requestErr.Err.Error()
+	}
+	return []problem.FieldError{field}
+}
+
+// fieldPath writes a JSON pointer the way validator names fields, so
+// zones/0/P becomes zones[0].P
+func fieldPath(pointer []string) string {
+	var path strings.Builder
+	for _, part := range pointer {
+		if _, err := strconv.Atoi(part); err == nil {
+			path.WriteString("[" + part + "]")
+			continue
+		}
+		if path.Len() > 0 {
+			path.WriteString(".")
+		}
+		path.WriteString(part)
+	}
+	return path.String()
+}
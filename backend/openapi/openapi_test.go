@@ -0,0 +1,111 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/echo-backend/problem"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func TestLoad(t *testing.T) {
+	doc, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for _, path := range []string{"/map/{id}", "/sync", "/workspaces", "/webhooks"} {
+		if doc.Paths.Find(path) == nil {
+			t.Errorf("document doesn't describe %s", path)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	doc, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	middleware, err := Middleware(doc)
+	if err != nil {
+		t.Fatalf("Middleware: %v", err)
+	}
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	e.Use(middleware)
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	e.PUT("/map/:id", ok)
+	e.PATCH("/map/:id", ok)
+	e.GET("/undocumented", ok)
+
+	id := uuid.NewString()
+	triangle := `{"P": [{"X": 0, "Y": 0}, {"X": 1, "Y": 0}, {"X": 1, "Y": 1}]}`
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		field       string
+	}{
+		{name: "valid map", method: http.MethodPut, target: "/map/" + id, body: `{"name": "map", "zones": [` + triangle + `]}`, status: http.StatusNoContent},
+		{name: "missing name", method: http.MethodPut, target: "/map/" + id, body: `{"image_url": ""}`, status: http.StatusBadRequest, field: "name"},
+		{name: "zone with two points", method: http.MethodPut, target: "/map/" + id, body: `{"name": "map", "zones": [{"P": [{"X": 0, "Y": 0}, {"X": 1, "Y": 0}]}]}`, status: http.StatusBadRequest, field: "zones[0].P"},
+		{name: "point that isn't a number", method: http.MethodPut, target: "/map/" + id, body: `{"name": "map", "zones": [{"P": [{"X": "a", "Y": 0}, {"X": 1, "Y": 0}, {"X": 1, "Y": 1}]}]}`, status: http.StatusBadRequest, field: "zones[0].P[0].X"},
+		{name: "invalid id", method: http.MethodPut, target: "/map/nope", body: `{"name": "map"}`, status: http.StatusBadRequest, field: "id"},
+		{name: "merge patch", method: http.MethodPatch, target: "/map/" + id, contentType: "application/merge-patch+json", body: `{"name": "renamed"}`, status: http.StatusNoContent},
+		{name: "JSON Patch", method: http.MethodPatch, target: "/map/" + id, contentType: "application/json-patch+json", body: `[{"op": "replace", "path": "/name", "value": "renamed"}]`, status: http.StatusNoContent},
+		{name: "undocumented route", method: http.MethodGet, target: "/undocumented", status: http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			contentType := test.contentType
+			if contentType == "" && test.body != "" {
+				contentType = echo.MIMEApplicationJSON
+			}
+			if contentType != "" {
+				req.Header.Set(echo.HeaderContentType, contentType)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, test.status, rec.Body)
+			}
+			if test.field == "" {
+				return
+			}
+			var res struct {
+				Code   string               `json:"code"`
+				Errors []problem.FieldError `json:"errors"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Code != "schema_mismatch" || len(res.Errors) != 1 || res.Errors[0].Field != test.field {
+				t.Fatalf("problem = %s, want schema_mismatch on %s", rec.Body, test.field)
+			}
+		})
+	}
+}
+
+func TestFieldPath(t *testing.T) {
+	tests := []struct {
+		pointer []string
+		want    string
+	}{
+		{nil, ""},
+		{[]string{"name"}, "name"},
+		{[]string{"zones", "0", "P"}, "zones[0].P"},
+		{[]string{"zones", "0", "P", "2", "X"}, "zones[0].P[2].X"},
+	}
+	for _, test := range tests {
+		if got := fieldPath(test.pointer); got != test.want {
+			t.Errorf("fieldPath(%v) = %q, want %q", test.pointer, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// Handler is the echo HTTPErrorHandler, every error a handler or middleware
+// returns is sent as a problem
+func Handler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	p := From(err)
+	if p.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(c.Request().Context(), "Request failed", "err", err.Error())
+	}
+	c.Response().Header().Set(echo.HeaderContentType, MIMEProblemJSON)
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(p.Status)
+	} else {
+		err = c.JSON(p.Status, p.document(c.Request().URL.Path))
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request().Context(), "Writing error response failed", "err", err)
+	}
+}
+
+// From converts any error into a problem, errors we don't know about are
+// hidden behind a 500 so internals don't leak to clients
+func From(err error) *Error {
+	var p *Error
+	if errors.As(err, &p) {
+		return p
+	}
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return fromValidation(validationErrs)
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return &Error{
+			Status:  httpErr.Code,
+			Code:    codeOf(httpErr.Code),
+			Message: fmt.Sprint(httpErr.Message),
+		}
+	}
+	return InternalServerError()
+}
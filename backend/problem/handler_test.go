@@ -0,0 +1,148 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+func TestHandler(t *testing.T) {
+	type body struct {
+		Name string   `validate:"required"`
+		Tags []string `validate:"max=1"`
+	}
+	validationErr := validator.New().Struct(body{Tags: []string{"a", "b"}})
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+		fields int
+	}{
+		{name: "problem", err: &Error{Status: http.StatusConflict, Code: "last_owner", Message: "Keep an owner"}, status: http.StatusConflict, code: "last_owner", detail: "Keep an owner"},
+		{name: "wrapped problem", err: fmt.Errorf("granting: %w", &Error{Status: http.StatusNotFound, Code: "map_not_found"}), status: http.StatusNotFound, code: "map_not_found"},
+		{name: "echo error", err: echo.ErrMethodNotAllowed, status: http.StatusMethodNotAllowed, code: "method_not_allowed", detail: "Method Not Allowed"},
+		{name: "validation errors", err: validationErr, status: http.StatusBadRequest, code: "validation_failed", detail: "Request body has invalid fields", fields: 2},
+		{name: "anything else", err: errors.New("pq: password authentication failed"), status: http.StatusInternalServerError, code: "internal_error", detail: "Internal Server Error, try again"},
+	}
+	e := echo.New()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Handler(test.err, e.NewContext(httptest.NewRequest(http.MethodGet, "/map/1", nil), rec))
+			if rec.Code != test.status {
+				t.Fatalf("status = %d, want %d", rec.Code, test.status)
+			}
+			if rec.Header().Get(echo.HeaderContentType) != MIMEProblemJSON {
+				t.Fatalf("content type = %q, want %s", rec.Header().Get(echo.HeaderContentType), MIMEProblemJSON)
+			}
+			var doc document
+			if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if doc.Status != test.status || doc.Code != test.code || doc.Title != http.StatusText(test.status) || doc.Instance != "/map/1" || doc.Type != "about:blank" {
+				t.Fatalf("problem = %s", rec.Body)
+			}
+			if test.detail != "" && doc.Detail != test.detail {
+				t.Fatalf("detail = %q, want %q", doc.Detail, test.detail)
+			}
+			if len(doc.Errors) != test.fields {
+				t.Fatalf("problem has %d field errors, want %d", len(doc.Errors), test.fields)
+			}
+		})
+	}
+}
+
+func TestHandlerHead(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler(echo.ErrNotFound, echo.New().NewContext(httptest.NewRequest(http.MethodHead, "/map/1", nil), rec))
+	if rec.Code != http.StatusNotFound || rec.Body.Len() != 0 {
+		t.Fatalf("HEAD answered %d with %q, want 404 without a body", rec.Code, rec.Body)
+	}
+}
+
+func TestHandlerCommitted(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/events", nil), rec)
+	c.String(http.StatusOK, "streaming")
+	Handler(errors.New("client went away"), c)
+	if rec.Code != http.StatusOK || rec.Body.String() != "streaming" {
+		t.Fatalf("response after a committed one = %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	type zone struct {
+		Points []int `validate:"min=3"`
+	}
+	type req struct {
+		Name  string `validate:"oneof=a b"`
+		Zones []zone `validate:"dive"`
+	}
+	err := Validation(validator.New().Struct(req{Name: "c", Zones: []zone{{Points: []int{1}}}}))
+	p := From(err)
+	if p.Status != http.StatusBadRequest || len(p.Fields) != 2 {
+		t.Fatalf("Validation = %+v", p)
+	}
+	want := []FieldError{
+		{Field: "Name", Rule: "oneof", Message: "must be one of a b"},
+		{Field: "Zones[0].Points", Rule: "min", Message: "must be at least 3"},
+	}
+	for i, field := range want {
+		if p.Fields[i] != field {
+			t.Errorf("field %d = %+v, want %+v", i, p.Fields[i], field)
+		}
+	}
+
+	other := errors.New("boom")
+	if Validation(other) != other {
+		t.Error("Validation changed an error that isn't a validation error")
+	}
+}
+
+func TestStatusOf(t *testing.T) {
+	if got := StatusOf(fmt.Errorf("wrapped: %w", &Error{Status: http.StatusGone})); got != http.StatusGone {
+		t.Errorf("StatusOf a problem = %d, want 410", got)
+	}
+	if got := StatusOf(errors.New("boom")); got != http.StatusInternalServerError {
+		t.Errorf("StatusOf an error = %d, want 500", got)
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusNotFound, "not_found"},
+		{http.StatusRequestEntityTooLarge, "request_entity_too_large"},
+		{599, "error"},
+	}
+	for _, test := range tests {
+		if got := codeOf(test.status); got != test.want {
+			t.Errorf("codeOf(%d) = %q, want %q", test.status, got, test.want)
+		}
+	}
+}
+
+// problems inside other responses look like the ones Handler sends
+func TestMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Error *Error `json:"error"`
+	}{&Error{Status: http.StatusPreconditionFailed, Code: "stale_version", Message: "Reload", CurrentVersion: 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"error":{"type":"about:blank","title":"Precondition Failed","status":412,"detail":"Reload","code":"stale_version","current_version":4}}`
+	if string(data) != want {
+		t.Fatalf("json = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,107 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const MIMEProblemJSON = "application/problem+json"
+
+// Error is the error every handler returns, it is rendered by Handler as an
+// RFC 7807 problem document
+type Error struct {
+	// HTTP status
+	Status int
+	// machine readable, clients should switch on it rather than on Message
+	Code    string
+	Message string
+	// only set on 412 so clients can retry against the latest map
+	CurrentVersion int32
+	// what was wrong with each invalid field of the request
+	Fields []FieldError
+}
+
+type FieldError struct {
+	// path to the field in the request body, e.g. zones[0].P, or the name
+	// of the parameter
+	Field string `json:"field"`
+	// the rule it broke, e.g. required or max
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+type document struct {
+	Type           string       `json:"type"`
+	Title          string       `json:"title"`
+	Status         int          `json:"status"`
+	Detail         string       `json:"detail,omitempty"`
+	Instance       string       `json:"instance,omitempty"`
+	Code           string       `json:"code"`
+	CurrentVersion int32        `json:"current_version,omitempty"`
+	Errors         []FieldError `json:"errors,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) ErrCode() int {
+	return e.Status
+}
+
+func (e *Error) document(instance string) document {
+	return document{
+		Type:           "about:blank",
+		Title:          http.StatusText(e.Status),
+		Status:         e.Status,
+		Detail:         e.Message,
+		Instance:       instance,
+		Code:           e.Code,
+		CurrentVersion: e.CurrentVersion,
+		Errors:         e.Fields,
+	}
+}
+
+// errors embedded in other responses, like sync results or live messages,
+// look the same as the ones Handler sends
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.document(""))
+}
+
+// StatusOf returns the status of errors that carry one, or 500
+func StatusOf(err error) int {
+	var coded interface{ ErrCode() int }
+	if errors.As(err, &coded) {
+		return coded.ErrCode()
+	}
+	return http.StatusInternalServerError
+}
+
+// codeOf turns a status into a code for errors that don't have their own,
+// e.g. 404 becomes not_found
+func codeOf(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+func InternalServerError() *Error {
+	err := Error{}
+	err.Status = http.StatusInternalServerError
+	err.Code = "internal_error"
+	err.Message = "Internal Server Error, try again"
+	return &err
+}
+
+func ValidationError(fields []FieldError) *Error {
+	err := Error{}
+	err.Status = http.StatusBadRequest
+	err.Code = "validation_failed"
+	err.Message = "Request body has invalid fields"
+	err.Fields = fields
+	return &err
+}
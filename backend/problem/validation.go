@@ -0,0 +1,55 @@
+package problem
+
+import (
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Validation turns validator errors into a problem listing each field, other
+// errors are left alone
+func Validation(err error) error {
+	validationErrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+	return fromValidation(validationErrs)
+}
+
+func fromValidation(validationErrs validator.ValidationErrors) *Error {
+	fields := make([]FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		fields = append(fields, FieldError{
+			Field:   fieldPath(fieldErr.Namespace()),
+			Rule:    fieldErr.Tag(),
+			Message: ruleMessage(fieldErr),
+		})
+	}
+	return ValidationError(fields)
+}
+
+// fieldPath drops the struct name, MapCreationReq.zones[0] becomes zones[0]
+func fieldPath(namespace string) string {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func ruleMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		return "must be at most " + fieldErr.Param()
+	case "min":
+		return "must be at least " + fieldErr.Param()
+	case "oneof":
+		return "must be one of " + fieldErr.Param()
+	case "http_url":
+		return "must be an http or https URL"
+	case "numberOfPoints":
+		return "zones need at least 3 points with positive coordinates"
+	}
+	return "failed the " + fieldErr.Tag() + " check"
+}
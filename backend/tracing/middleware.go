@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"net/http"
+
+	"example.com/echo-backend/logging"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("example.com/echo-backend/tracing")
+
+// Middleware starts a server span for every request, named after its route
+// pattern and continuing the caller's trace when it sent a traceparent. The
+// trace ID is added to the request's logs. It must run before
+// logging.Middleware so the span sees the final status.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracer.Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPMethod(req.Method),
+					semconv.HTTPRoute(route),
+					attribute.String("request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
+				),
+			)
+			defer span.End()
+			if sc := span.SpanContext(); sc.IsValid() {
+				ctx = logging.With(ctx, "trace_id", sc.TraceID().String())
+			}
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPStatusCode(status))
+			// 4xx are the client's fault, not an error of this server
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/echo-backend/problem"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler
+	e.Use(Middleware())
+	var handlerSpan trace.SpanContext
+	e.GET("/map/:id", func(c echo.Context) error {
+		handlerSpan = trace.SpanContextFromContext(c.Request().Context())
+		return c.NoContent(http.StatusNoContent)
+	})
+	e.PUT("/map/:id", func(c echo.Context) error { return &problem.Error{Status: http.StatusConflict} })
+	e.DELETE("/map/:id", func(c echo.Context) error { return &problem.Error{Status: http.StatusServiceUnavailable} })
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		method, target, traceparent string
+		name                        string
+		status                      int
+		code                        codes.Code
+	}{
+		{method: http.MethodGet, target: "/map/1", traceparent: traceparent, name: "GET /map/:id", status: http.StatusNoContent, code: codes.Unset},
+		{method: http.MethodPut, target: "/map/1", name: "PUT /map/:id", status: http.StatusConflict, code: codes.Unset},
+		{method: http.MethodDelete, target: "/map/1", name: "DELETE /map/:id", status: http.StatusServiceUnavailable, code: codes.Error},
+		{method: http.MethodGet, target: "/nowhere", name: "GET unmatched", status: http.StatusNotFound, code: codes.Unset},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := len(recorder.Ended())
+			req := httptest.NewRequest(test.method, test.target, nil)
+			if test.traceparent != "" {
+				req.Header.Set("traceparent", test.traceparent)
+			}
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := endedSince(before)
+			if len(spans) != 1 {
+				t.Fatalf("ended %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != test.name || span.SpanKind() != trace.SpanKindServer || span.Status().Code != test.code {
+				t.Fatalf("span %s, kind %s, status %v", span.Name(), span.SpanKind(), span.Status())
+			}
+			if !hasAttribute(span.Attributes(), attribute.Int("http.status_code", test.status)) {
+				t.Fatalf("attributes = %v, want status %d", span.Attributes(), test.status)
+			}
+			if test.traceparent == "" {
+				return
+			}
+			// the caller's trace is continued and the handler runs inside the span
+			if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+				t.Fatalf("span %s has parent %s", span.SpanContext().TraceID(), span.Parent().SpanID())
+			}
+			if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+				t.Fatal("handler didn't get the request's span")
+			}
+		})
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
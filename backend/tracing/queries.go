@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer starts a client span for every query made through the pool,
+// named after its sqlc query, and then hands the query to next, e.g. the
+// metrics tracer, since a pool only takes one tracer. next may be nil.
+func QueryTracer(next pgx.QueryTracer) pgx.QueryTracer {
+	return queryTracer{next: next}
+}
+
+// QueryName is the name sqlc puts at the top of every query, e.g.
+// GetMapById, or "" for SQL that didn't come from the Querier
+func QueryName(sql string) string {
+	rest, ok := strings.CutPrefix(sql, "-- name: ")
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
+
+type queryTracer struct {
+	next pgx.QueryTracer
+}
+
+func (t queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	name := QueryName(data.SQL)
+	if name == "" {
+		name = "query"
+	}
+	ctx, _ = tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperation(name),
+			// only the SQL, the arguments can hold images and secrets
+			semconv.DBStatement(data.SQL),
+		),
+	)
+	if t.next != nil {
+		ctx = t.next.TraceQueryStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (t queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if t.next != nil {
+		t.next.TraceQueryEnd(ctx, conn, data)
+	}
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"-- name: GetMapById :one\nSELECT * FROM maps WHERE id = $1", "GetMapById"},
+		{"-- name: DeleteMap :exec", "DeleteMap"},
+		{"SELECT 1", ""},
+		{" -- name: Indented :one", ""},
+	}
+	for _, test := range tests {
+		if got := QueryName(test.sql); got != test.want {
+			t.Errorf("QueryName(%q) = %q, want %q", test.sql, got, test.want)
+		}
+	}
+}
+
+// nextTracer records that the query was handed on
+type nextTracer struct {
+	started, ended int
+}
+
+func (n *nextTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	n.started++
+	return ctx
+}
+
+func (n *nextTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	n.ended++
+}
+
+func TestQueryTracer(t *testing.T) {
+	next := &nextTracer{}
+	queries := QueryTracer(next)
+	ctx, parent := tracer.Start(context.Background(), "GET /map/:id")
+	defer parent.End()
+
+	tests := []struct {
+		sql  string
+		err  error
+		name string
+		code codes.Code
+	}{
+		{sql: "-- name: GetMapById :one\nSELECT", name: "GetMapById", code: codes.Unset},
+		{sql: "-- name: DeleteMap :exec\nUPDATE", err: errors.New("deadlock detected"), name: "DeleteMap", code: codes.Error},
+		{sql: "BEGIN", name: "query", code: codes.Unset},
+	}
+	for _, test := range tests {
+		before := len(recorder.Ended())
+		queryCtx := queries.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: test.sql, Args: []any{"data:image/png;base64,AAAA"}})
+		queries.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{Err: test.err})
+
+		spans := endedSince(before)
+		if len(spans) != 1 {
+			t.Fatalf("%s ended %d spans, want 1", test.name, len(spans))
+		}
+		span := spans[0]
+		if span.Name() != test.name || span.SpanKind() != trace.SpanKindClient || span.Status().Code != test.code {
+			t.Errorf("span %s, kind %s, status %v", span.Name(), span.SpanKind(), span.Status())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s isn't a child of the request's span", test.name)
+		}
+		if !hasAttribute(span.Attributes(), semconv.DBStatement(test.sql)) {
+			t.Errorf("attributes = %v, want the statement", span.Attributes())
+		}
+		for _, attr := range span.Attributes() {
+			if attr.Value.AsString() == "data:image/png;base64,AAAA" {
+				t.Errorf("the query's arguments were recorded")
+			}
+		}
+		if test.err != nil && len(span.Events()) != 1 {
+			t.Errorf("%s recorded %d events, want the error", test.name, len(span.Events()))
+		}
+	}
+	if next.started != len(tests) || next.ended != len(tests) {
+		t.Fatalf("next tracer saw %d starts and %d ends, want %d", next.started, next.ended, len(tests))
+	}
+
+	// without a next tracer
+	QueryTracer(nil).TraceQueryEnd(QueryTracer(nil).TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{}), nil, pgx.TraceQueryEndData{})
+}
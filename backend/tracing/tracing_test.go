@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recorder sees every span ended in this package's tests. The package's
+// tracer is bound to the first provider installed, so there is only one.
+var recorder = tracetest.NewSpanRecorder()
+
+func TestMain(m *testing.M) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	os.Exit(m.Run())
+}
+
+// endedSince returns the spans ended after the first n
+func endedSince(n int) []sdktrace.ReadOnlySpan {
+	return recorder.Ended()[n:]
+}
+
+func TestSetupExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), "jaeger", 1); err == nil {
+		t.Fatal("Setup with an unknown exporter succeeded")
+	}
+}
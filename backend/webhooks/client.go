@@ -0,0 +1,117 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// errAddressNotAllowed is returned for receivers inside our own network
+var errAddressNotAllowed = errors.New("address not allowed")
+
+// publicAddr reports whether webhooks may be sent to ip: anything but
+// loopback, private, link-local, multicast and unspecified addresses
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// NewClient returns the client deliveries are sent with. Unless allowPrivate
+// is set every connection is checked once the name is resolved, so a receiver
+// can't point its DNS inside the network later, and redirects are never
+// followed.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddr(addrPort.Addr()) {
+				return errAddressNotAllowed
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would make the connection for us and skip the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkURL rejects subscriptions whose host resolves to an address
+// deliveries wouldn't be sent to
+func checkURL(ctx context.Context, rawURL string, allowPrivate bool) error {
+	if allowPrivate {
+		return nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return InvalidURLError()
+	}
+	host := parsed.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !publicAddr(ip) {
+			return InvalidURLError()
+		}
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(ips) == 0 {
+		return InvalidURLError()
+	}
+	for _, ip := range ips {
+		if !publicAddr(ip) {
+			return InvalidURLError()
+		}
+	}
+	return nil
+}
+
+// errorClass is what a failed attempt stores as its last_error. Receivers
+// are chosen by users, so nothing about their network beyond this is shown.
+func errorClass(err error) string {
+	var statusErr statusError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.Error()
+	case errors.Is(err, errAddressNotAllowed):
+		return "address not allowed"
+	case errors.As(err, &dnsErr):
+		return "host not found"
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr):
+		return "invalid certificate"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timed out"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	default:
+		return "request failed"
+	}
+}
+
+// statusError is a response outside 2xx
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("receiver answered %d", int(e))
+}
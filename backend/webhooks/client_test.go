@@ -0,0 +1,134 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"syscall"
+	"testing"
+	"time"
+
+	"example.com/echo-backend/problem"
+)
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		// IPv4 mapped addresses are checked as IPv4
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:93.184.216.34", true},
+	}
+	for _, test := range tests {
+		if got := publicAddr(netip.MustParseAddr(test.addr)); got != test.want {
+			t.Errorf("publicAddr(%s) = %v, want %v", test.addr, got, test.want)
+		}
+	}
+	if publicAddr(netip.Addr{}) {
+		t.Error("publicAddr of the zero address = true")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		ok           bool
+	}{
+		{url: "https://93.184.216.34/hook", ok: true},
+		{url: "https://[2606:2800:220:1:248:1893:25c8:1946]/hook", ok: true},
+		{url: "http://127.0.0.1:8080/hook"},
+		{url: "http://[::1]/hook"},
+		{url: "http://169.254.169.254/latest/meta-data"},
+		{url: "http://10.0.0.1/hook"},
+		{url: "http://localhost/hook"},
+		{url: "http://receiver.invalid/hook"},
+		{url: "://nope"},
+		{url: "http://127.0.0.1:8080/hook", allowPrivate: true, ok: true},
+		{url: "http://localhost/hook", allowPrivate: true, ok: true},
+	}
+	for _, test := range tests {
+		err := checkURL(context.Background(), test.url, test.allowPrivate)
+		if test.ok && err != nil {
+			t.Errorf("checkURL(%q) = %v, want nil", test.url, err)
+		}
+		if !test.ok && problem.StatusOf(err) != http.StatusBadRequest {
+			t.Errorf("checkURL(%q) = %v, want 400", test.url, err)
+		}
+	}
+}
+
+// the address is checked when connecting, not only when subscribing
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	_, err := NewClient(time.Second, false).Get(receiver.URL)
+	if !errors.Is(err, errAddressNotAllowed) {
+		t.Fatalf("Get of a loopback receiver = %v, want errAddressNotAllowed", err)
+	}
+	res, err := NewClient(time.Second, true).Get(receiver.URL)
+	if err != nil {
+		t.Fatalf("Get with private addresses allowed: %v", err)
+	}
+	res.Body.Close()
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	followed := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/elsewhere" {
+			followed = true
+			return
+		}
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer receiver.Close()
+
+	res, err := NewClient(time.Second, true).Get(receiver.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound || followed {
+		t.Fatalf("status = %d and followed = %v, want the redirect itself", res.StatusCode, followed)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{statusError(503), "receiver answered 503"},
+		{fmt.Errorf("dial: %w", errAddressNotAllowed), "address not allowed"},
+		{&net.DNSError{Err: "no such host", Name: "receiver.internal"}, "host not found"},
+		{context.DeadlineExceeded, "timed out"},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, "connection refused"},
+		{errors.New("10.0.0.7:443: something odd"), "request failed"},
+	}
+	for _, test := range tests {
+		if got := errorClass(test.err); got != test.want {
+			t.Errorf("errorClass(%v) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
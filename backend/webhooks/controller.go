@@ -0,0 +1,115 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"example.com/echo-backend/auth"
+	"github.com/labstack/echo/v4"
+)
+
+type Controller struct {
+	e       *echo.Echo
+	service *Service
+}
+
+func NewController(e *echo.Echo, service *Service) *Controller {
+	c := &Controller{e: e, service: service}
+	e.POST("/webhooks", c.createSubscription)
+	e.GET("/webhooks", c.getSubscriptions)
+	e.DELETE("/webhooks/:id", c.deleteSubscription)
+	e.GET("/webhooks/:id/deliveries", c.getDeliveries)
+	e.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", c.redeliver)
+	return c
+}
+
+// webhooks see every map of the workspace, so only its owners manage them
+func requireWorkspaceOwner(ctx context.Context) (auth.Principal, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || !principal.HasWorkspace() {
+		return auth.Principal{}, auth.NoWorkspaceError()
+	}
+	if principal.WorkspaceRole != auth.RoleOwner {
+		return auth.Principal{}, auth.ForbiddenError()
+	}
+	return principal, nil
+}
+
+func (con *Controller) createSubscription(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, err := requireWorkspaceOwner(ctx)
+	if err != nil {
+		return err
+	}
+	req := SubscriptionCreationReq{}
+	if err := c.Bind(&req); err != nil {
+		return BadRequestError()
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	subscription, err := con.service.createSubscription(ctx, principal, req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, subscription)
+}
+
+func (con *Controller) getSubscriptions(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, err := requireWorkspaceOwner(ctx)
+	if err != nil {
+		return err
+	}
+	subscriptions, err := con.service.getSubscriptions(ctx, principal.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, subscriptions)
+}
+
+func (con *Controller) deleteSubscription(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, err := requireWorkspaceOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if err := con.service.deleteSubscription(ctx, c.Param("id"), principal.WorkspaceID); err != nil {
+		return err
+	}
+	return c.String(http.StatusOK, "Deleted webhook subscription successfully")
+}
+
+func (con *Controller) getDeliveries(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, err := requireWorkspaceOwner(ctx)
+	if err != nil {
+		return err
+	}
+	var limit int64
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err = strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return InvalidFilterError()
+		}
+	}
+	deliveries, err := con.service.getDeliveries(ctx, c.Param("id"), principal.WorkspaceID, int32(limit))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+func (con *Controller) redeliver(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, err := requireWorkspaceOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if err := con.service.redeliver(ctx, c.Param("id"), c.Param("deliveryId"), principal.WorkspaceID); err != nil {
+		return err
+	}
+	return c.String(http.StatusAccepted, "Queued webhook delivery again")
+}
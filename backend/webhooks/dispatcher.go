@@ -0,0 +1,187 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/events"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	// a delivery is given up after this many attempts, about 3 hours in
+	maxAttempts  = 10
+	firstBackoff = 30 * time.Second
+	maxBackoff   = time.Hour
+	batchSize    = 20
+)
+
+// Dispatcher queues a delivery per subscription for every new map event and
+// sends the due ones. Any number of instances may run it side by side.
+type Dispatcher struct {
+	db     db.Querier
+	client *http.Client
+}
+
+// NewDispatcher sends deliveries with client, see NewClient
+func NewDispatcher(db db.Querier, client *http.Client) *Dispatcher {
+	return &Dispatcher{
+		db:     db,
+		client: client,
+	}
+}
+
+// Sign returns the signature of a delivery, the hex encoded HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the subscription's secret. Receivers should
+// compute it themselves and compare it with the X-Webhook-Signature header
+// in constant time.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff doubles the wait after every failed attempt
+func backoff(attempts int32) time.Duration {
+	wait := firstBackoff
+	for i := int32(1); i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// Run dispatches every interval until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		d.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	if err := d.db.EnqueueWebhookDeliveries(ctx); err != nil {
+		slog.ErrorContext(ctx, "Queueing webhook deliveries failed", "err", err)
+		return
+	}
+	for {
+		deliveries, err := d.db.ClaimWebhookDeliveries(ctx, batchSize)
+		if err != nil {
+			slog.ErrorContext(ctx, "Claiming webhook deliveries failed", "err", err)
+			return
+		}
+		// claimed deliveries are finished and recorded even when shutting
+		// down, the client timeout bounds how long that takes
+		deliveryCtx := context.WithoutCancel(ctx)
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery db.ClaimWebhookDeliveriesRow) {
+				defer wg.Done()
+				d.deliver(deliveryCtx, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+		if len(deliveries) < batchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery db.ClaimWebhookDeliveriesRow) {
+	ctx, span := tracer.Start(ctx, "webhooks.deliver")
+	defer span.End()
+	// the same body as the /events stream
+	body, err := json.Marshal(events.EventRes{
+		ID:        delivery.EventID,
+		CreatedAt: delivery.CreatedAt,
+		Type:      delivery.Type,
+		MapID:     delivery.MapID,
+		EntityID:  delivery.EntityID,
+		Data:      json.RawMessage(delivery.Data),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Encoding webhook body failed", "err", err, "event_id", delivery.EventID)
+		return
+	}
+
+	status, err := d.send(ctx, delivery, body)
+	attempt := db.RecordWebhookAttemptParams{
+		ID:     delivery.ID,
+		Status: StatusSucceeded,
+		// unused once the delivery is no longer pending
+		NextAttemptAt: time.Now(),
+	}
+	if status != 0 {
+		attempt.ResponseStatus = pgtype.Int4{Int32: int32(status), Valid: true}
+	}
+	if err != nil {
+		slog.InfoContext(ctx, "Webhook delivery failed", "err", err, "delivery_id", delivery.ID)
+		attempt.LastError = pgtype.Text{String: errorClass(err), Valid: true}
+		attempt.Status = StatusPending
+		attempt.NextAttemptAt = time.Now().Add(backoff(delivery.Attempts + 1))
+		if delivery.Attempts+1 >= maxAttempts {
+			attempt.Status = StatusFailed
+		}
+	}
+	if err := d.db.RecordWebhookAttempt(ctx, attempt); err != nil {
+		slog.ErrorContext(ctx, "Recording webhook attempt failed", "err", err, "event_id", delivery.EventID)
+	}
+}
+
+// send posts the body and returns the response status, any status outside
+// 2xx is an error
+func (d *Dispatcher) send(ctx context.Context, delivery db.ClaimWebhookDeliveriesRow, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "map-editor-webhooks")
+	req.Header.Set(HeaderID, delivery.ID.String())
+	req.Header.Set(HeaderEvent, delivery.Type)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, statusError(res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,124 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+)
+
+// fakeQuerier records the attempts, any other query panics
+type fakeQuerier struct {
+	db.Querier
+	attempts []db.RecordWebhookAttemptParams
+}
+
+func (q *fakeQuerier) RecordWebhookAttempt(ctx context.Context, arg db.RecordWebhookAttemptParams) error {
+	q.attempts = append(q.attempts, arg)
+	return nil
+}
+
+func TestSign(t *testing.T) {
+	got := Sign("secret", "1700000000", []byte(`{"id":1}`))
+	want := "sha256=3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11"
+	if got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+	if Sign("secret", "1700000001", []byte(`{"id":1}`)) == got {
+		t.Fatal("signature doesn't cover the timestamp")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int32
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{maxAttempts, time.Hour},
+	}
+	for _, test := range tests {
+		if got := backoff(test.attempts); got != test.want {
+			t.Errorf("backoff(%d) = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	status := http.StatusOK
+	var received *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	delivery := db.ClaimWebhookDeliveriesRow{
+		ID:      uuid.New(),
+		Url:     receiver.URL,
+		Secret:  "whsec_test",
+		EventID: 7,
+		Type:    "zone.created",
+		Data:    []byte(`{"id":"z"}`),
+	}
+	tests := []struct {
+		name     string
+		status   int
+		attempts int32
+		want     string
+		err      string
+	}{
+		{name: "accepted", status: http.StatusNoContent, want: StatusSucceeded},
+		{name: "refused", status: http.StatusInternalServerError, attempts: 2, want: StatusPending, err: "receiver answered 500"},
+		{name: "refused for the last time", status: http.StatusGone, attempts: maxAttempts - 1, want: StatusFailed, err: "receiver answered 410"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := &fakeQuerier{}
+			status = test.status
+			delivery.Attempts = test.attempts
+			NewDispatcher(q, NewClient(time.Second, true)).deliver(context.Background(), delivery)
+
+			if received.Header.Get(HeaderEvent) != "zone.created" || received.Header.Get(HeaderID) != delivery.ID.String() {
+				t.Errorf("headers = %v", received.Header)
+			}
+			signature := Sign(delivery.Secret, received.Header.Get(HeaderTimestamp), body)
+			if received.Header.Get(HeaderSignature) != signature {
+				t.Errorf("signature = %s, want %s", received.Header.Get(HeaderSignature), signature)
+			}
+
+			attempt := q.attempts[0]
+			if attempt.Status != test.want || attempt.ResponseStatus.Int32 != int32(test.status) || attempt.LastError.String != test.err {
+				t.Fatalf("recorded %+v, want %s after %d", attempt, test.want, test.status)
+			}
+			if test.want == StatusPending && attempt.NextAttemptAt.Before(time.Now().Add(backoff(test.attempts+1)-time.Second)) {
+				t.Errorf("next attempt at %v, too soon", attempt.NextAttemptAt)
+			}
+		})
+	}
+}
+
+// a receiver that can't be reached only shows what kind of failure it was
+func TestDeliverUnreachable(t *testing.T) {
+	q := &fakeQuerier{}
+	NewDispatcher(q, NewClient(time.Second, false)).deliver(context.Background(), db.ClaimWebhookDeliveriesRow{
+		ID:  uuid.New(),
+		Url: "http://127.0.0.1:1/hook",
+	})
+	attempt := q.attempts[0]
+	if attempt.Status != StatusPending || attempt.ResponseStatus.Valid || attempt.LastError.String != "address not allowed" {
+		t.Fatalf("recorded %+v", attempt)
+	}
+}
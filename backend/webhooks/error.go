@@ -0,0 +1,73 @@
+package webhooks
+
+import (
+	"net/http"
+
+	"example.com/echo-backend/problem"
+)
+
+type CustomError = problem.Error
+
+func InvalidUUIDError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_uuid"
+	err.Message = "Invalid UUID format"
+	return &err
+}
+
+func NotFoundError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusNotFound
+	err.Code = "subscription_not_found"
+	err.Message = "Webhook subscription not found"
+	return &err
+}
+
+func InvalidURLError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_webhook_url"
+	err.Message = "Webhook url must resolve to a public address"
+	return &err
+}
+
+func DeliveryNotFoundError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusNotFound
+	err.Code = "delivery_not_found"
+	err.Message = "Webhook delivery not found"
+	return &err
+}
+
+func InternalServerError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusInternalServerError
+	err.Code = "internal_error"
+	err.Message = "Internal Server Error, try again"
+	return &err
+}
+
+func BadRequestError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_body"
+	err.Message = "Bad Request Body, try again"
+	return &err
+}
+
+func InvalidFilterError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_filter"
+	err.Message = "limit must be a number"
+	return &err
+}
+
+func SubscriptionCreationError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "subscription_creation_failed"
+	err.Message = "Error creating webhook subscription, try again"
+	return &err
+}
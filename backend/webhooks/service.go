@@ -0,0 +1,254 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("example.com/echo-backend/webhooks")
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type Service struct {
+	db db.Querier
+	// see NewClient
+	allowPrivate bool
+}
+
+func NewService(db db.Querier, allowPrivate bool) *Service {
+	service := Service{
+		db:           db,
+		allowPrivate: allowPrivate,
+	}
+	return &service
+}
+
+type SubscriptionCreationReq struct {
+	Url        string   `json:"url" validate:"required,http_url"`
+	EventTypes []string `json:"event_types" validate:"required,min=1,dive,oneof=map.created map.updated map.deleted zone.created zone.updated zone.deleted route.created route.updated route.deleted"`
+	// generated when left out
+	Secret string `json:"secret" validate:"omitempty,min=16"`
+}
+
+// SubscriptionRes carries the secret only when the subscription is created
+type SubscriptionRes struct {
+	ID         uuid.UUID `json:"id"`
+	Url        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	Secret     string    `json:"secret,omitempty"`
+}
+
+type DeliveryRes struct {
+	ID             uuid.UUID  `json:"id"`
+	EventID        int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	ResponseStatus *int32     `json:"response_status"`
+	LastError      *string    `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func toSubscriptionRes(row db.WebhookSubscription) SubscriptionRes {
+	return SubscriptionRes{
+		ID:         row.ID,
+		Url:        row.Url,
+		EventTypes: row.EventTypes,
+		CreatedBy:  row.CreatedBy,
+		CreatedAt:  row.CreatedAt,
+	}
+}
+
+func toDeliveryRes(row db.GetWebhookDeliveriesRow) DeliveryRes {
+	res := DeliveryRes{
+		ID:        row.ID,
+		EventID:   row.EventID,
+		EventType: row.EventType,
+		Status:    row.Status,
+		Attempts:  row.Attempts,
+		CreatedAt: row.CreatedAt,
+	}
+	// only pending deliveries have a next attempt
+	if row.Status == StatusPending {
+		res.NextAttemptAt = &row.NextAttemptAt
+	}
+	if row.LastAttemptAt.Valid {
+		res.LastAttemptAt = &row.LastAttemptAt.Time
+	}
+	if row.ResponseStatus.Valid {
+		res.ResponseStatus = &row.ResponseStatus.Int32
+	}
+	if row.LastError.Valid {
+		res.LastError = &row.LastError.String
+	}
+	return res
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+func (s *Service) createSubscription(ctx context.Context, principal auth.Principal, req SubscriptionCreationReq) (SubscriptionRes, error) {
+	ctx, span := tracer.Start(ctx, "webhooks.createSubscription")
+	defer span.End()
+	if err := checkURL(ctx, req.Url, s.allowPrivate); err != nil {
+		return SubscriptionRes{}, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		generated, err := newSecret()
+		if err != nil {
+			slog.ErrorContext(ctx, "Generating webhook secret failed", "err", err)
+			return SubscriptionRes{}, InternalServerError()
+		}
+		secret = generated
+	}
+	row, err := s.db.CreateWebhookSubscription(ctx, db.CreateWebhookSubscriptionParams{
+		WorkspaceID: principal.WorkspaceID,
+		Url:         req.Url,
+		EventTypes:  req.EventTypes,
+		Secret:      secret,
+		CreatedBy:   principal.String(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Creating webhook subscription failed", "err", err)
+		return SubscriptionRes{}, SubscriptionCreationError()
+	}
+	res := toSubscriptionRes(row)
+	res.Secret = secret
+	return res, nil
+}
+
+func (s *Service) getSubscriptions(ctx context.Context, workspaceID uuid.UUID) ([]SubscriptionRes, error) {
+	ctx, span := tracer.Start(ctx, "webhooks.getSubscriptions")
+	defer span.End()
+	rows, err := s.db.GetWebhookSubscriptions(ctx, workspaceID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing webhook subscriptions failed", "err", err)
+		return []SubscriptionRes{}, InternalServerError()
+	}
+	subscriptions := make([]SubscriptionRes, 0, len(rows))
+	for _, row := range rows {
+		subscriptions = append(subscriptions, toSubscriptionRes(row))
+	}
+	return subscriptions, nil
+}
+
+func (s *Service) deleteSubscription(ctx context.Context, id string, workspaceID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "webhooks.deleteSubscription")
+	defer span.End()
+	subscriptionID, err := uuid.Parse(id)
+	if err != nil {
+		return InvalidUUIDError()
+	}
+	count, err := s.db.DeleteWebhookSubscription(ctx, db.DeleteWebhookSubscriptionParams{
+		ID:          subscriptionID,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Deleting webhook subscription failed", "err", err)
+		return InternalServerError()
+	}
+	if count == 0 {
+		return NotFoundError()
+	}
+	return nil
+}
+
+// getSubscription makes sure the subscription belongs to the workspace
+func (s *Service) getSubscription(ctx context.Context, id string, workspaceID uuid.UUID) (db.WebhookSubscription, error) {
+	ctx, span := tracer.Start(ctx, "webhooks.getSubscription")
+	defer span.End()
+	subscriptionID, err := uuid.Parse(id)
+	if err != nil {
+		return db.WebhookSubscription{}, InvalidUUIDError()
+	}
+	row, err := s.db.GetWebhookSubscriptionById(ctx, db.GetWebhookSubscriptionByIdParams{
+		ID:          subscriptionID,
+		WorkspaceID: workspaceID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.WebhookSubscription{}, NotFoundError()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Reading webhook subscription failed", "err", err)
+		return db.WebhookSubscription{}, InternalServerError()
+	}
+	return row, nil
+}
+
+func (s *Service) getDeliveries(ctx context.Context, id string, workspaceID uuid.UUID, limit int32) ([]DeliveryRes, error) {
+	ctx, span := tracer.Start(ctx, "webhooks.getDeliveries")
+	defer span.End()
+	subscription, err := s.getSubscription(ctx, id, workspaceID)
+	if err != nil {
+		return []DeliveryRes{}, err
+	}
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	rows, err := s.db.GetWebhookDeliveries(ctx, db.GetWebhookDeliveriesParams{
+		SubscriptionID: subscription.ID,
+		Limit:          limit,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing webhook deliveries failed", "err", err)
+		return []DeliveryRes{}, InternalServerError()
+	}
+	deliveries := make([]DeliveryRes, 0, len(rows))
+	for _, row := range rows {
+		deliveries = append(deliveries, toDeliveryRes(row))
+	}
+	return deliveries, nil
+}
+
+// redeliver queues a delivery again straight away with a fresh set of
+// attempts, whatever its status
+func (s *Service) redeliver(ctx context.Context, id string, deliveryID string, workspaceID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "webhooks.redeliver")
+	defer span.End()
+	subscription, err := s.getSubscription(ctx, id, workspaceID)
+	if err != nil {
+		return err
+	}
+	delivery, err := uuid.Parse(deliveryID)
+	if err != nil {
+		return InvalidUUIDError()
+	}
+	count, err := s.db.RedeliverWebhookDelivery(ctx, db.RedeliverWebhookDeliveryParams{
+		ID:             delivery,
+		SubscriptionID: subscription.ID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Redelivering webhook failed", "err", err)
+		return InternalServerError()
+	}
+	if count == 0 {
+		return DeliveryNotFoundError()
+	}
+	return nil
+}
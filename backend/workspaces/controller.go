@@ -0,0 +1,108 @@
+package workspaces
+
+import (
+	"net/http"
+
+	"example.com/echo-backend/auth"
+	"github.com/labstack/echo/v4"
+)
+
+type Controller struct {
+	e       *echo.Echo
+	service *Service
+}
+
+func NewController(e *echo.Echo, service *Service) *Controller {
+	c := &Controller{e: e, service: service}
+	e.POST("/workspaces", c.createWorkspace)
+	e.GET("/workspaces", c.getWorkspaces)
+	e.GET("/workspaces/:id/members", c.getMembers)
+	e.PUT("/workspaces/:id/members/:subject", c.grantRole)
+	e.DELETE("/workspaces/:id/members/:subject", c.revokeRole)
+	return c
+}
+
+// only users create workspaces, API keys are bound to the one they belong to
+func (con *Controller) createWorkspace(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || principal.Kind != auth.KindUser {
+		return ForbiddenError()
+	}
+	req := WorkspaceCreationReq{}
+	if err := c.Bind(&req); err != nil {
+		return BadRequestError()
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	workspace, err := con.service.createWorkspace(ctx, req, principal)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, workspace)
+}
+
+func (con *Controller) getWorkspaces(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return ForbiddenError()
+	}
+	workspaces, err := con.service.getWorkspaces(ctx, principal)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, workspaces)
+}
+
+func (con *Controller) getMembers(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, _ := auth.PrincipalFromContext(ctx)
+	id, err := con.service.authorize(ctx, principal, c.Param("id"), auth.RoleViewer)
+	if err != nil {
+		return err
+	}
+
+	members, err := con.service.getMembers(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, members)
+}
+
+func (con *Controller) grantRole(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, _ := auth.PrincipalFromContext(ctx)
+	id, err := con.service.authorize(ctx, principal, c.Param("id"), auth.RoleOwner)
+	if err != nil {
+		return err
+	}
+	req := RoleGrantReq{}
+	if err := c.Bind(&req); err != nil {
+		return BadRequestError()
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	if err := con.service.grantRole(ctx, id, c.Param("subject"), req.Role, principal); err != nil {
+		return err
+	}
+	return c.String(http.StatusOK, "Granted role successfully")
+}
+
+func (con *Controller) revokeRole(c echo.Context) error {
+	ctx := c.Request().Context()
+	principal, _ := auth.PrincipalFromContext(ctx)
+	id, err := con.service.authorize(ctx, principal, c.Param("id"), auth.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	if err := con.service.revokeRole(ctx, id, c.Param("subject")); err != nil {
+		return err
+	}
+	return c.String(http.StatusOK, "Revoked role successfully")
+}
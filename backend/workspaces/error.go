@@ -0,0 +1,57 @@
+package workspaces
+
+import (
+	"net/http"
+
+	"example.com/echo-backend/problem"
+)
+
+type CustomError = problem.Error
+
+func InvalidUUIDError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_uuid"
+	err.Message = "Invalid UUID format"
+	return &err
+}
+
+func NotFoundError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusNotFound
+	err.Code = "workspace_not_found"
+	err.Message = "Workspace or member not found"
+	return &err
+}
+
+func ForbiddenError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusForbidden
+	err.Code = "forbidden"
+	err.Message = "Not allowed to perform this action on the workspace"
+	return &err
+}
+
+func BadRequestError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusBadRequest
+	err.Code = "invalid_body"
+	err.Message = "Bad Request Body, try again"
+	return &err
+}
+
+func LastOwnerError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusConflict
+	err.Code = "last_workspace_owner"
+	err.Message = "A workspace must keep at least one owner"
+	return &err
+}
+
+func InternalServerError() *CustomError {
+	err := CustomError{}
+	err.Status = http.StatusInternalServerError
+	err.Code = "internal_error"
+	err.Message = "Internal Server Error, try again"
+	return &err
+}
@@ -0,0 +1,252 @@
+package workspaces
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"example.com/echo-backend/audit"
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("example.com/echo-backend/workspaces")
+
+type Service struct {
+	db   db.Querier
+	pool TxBeginner
+}
+
+type WorkspaceCreationReq struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
+
+type RoleGrantReq struct {
+	Role string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+type WorkspaceRes struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+}
+
+type MemberRes struct {
+	Subject   string    `json:"subject"`
+	Role      string    `json:"role"`
+	GrantedBy string    `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewService(db db.Querier, pool TxBeginner) *Service {
+	service := Service{
+		db:   db,
+		pool: pool,
+	}
+	return &service
+}
+
+// the user creating a workspace becomes its first owner, in the same
+// transaction so no workspace is left without one
+func (s *Service) createWorkspace(ctx context.Context, req WorkspaceCreationReq, principal auth.Principal) (WorkspaceRes, error) {
+	ctx, span := tracer.Start(ctx, "workspaces.createWorkspace")
+	defer span.End()
+	var workspace db.Workspace
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		var err error
+		workspace, err = q.CreateWorkspace(ctx, req.Name)
+		if err != nil {
+			return err
+		}
+		_, err = q.GrantWorkspaceRole(ctx, db.GrantWorkspaceRoleParams{
+			WorkspaceID: workspace.ID,
+			Subject:     principal.String(),
+			Role:        auth.RoleOwner,
+			GrantedBy:   principal.String(),
+		})
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Creating workspace failed", "err", err)
+		return WorkspaceRes{}, InternalServerError()
+	}
+	return WorkspaceRes{
+		ID:        workspace.ID,
+		CreatedAt: workspace.CreatedAt,
+		Name:      workspace.Name,
+		Role:      auth.RoleOwner,
+	}, nil
+}
+
+func (s *Service) getWorkspaces(ctx context.Context, principal auth.Principal) ([]WorkspaceRes, error) {
+	ctx, span := tracer.Start(ctx, "workspaces.getWorkspaces")
+	defer span.End()
+	rows, err := s.db.GetWorkspacesBySubject(ctx, principal.String())
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing workspaces failed", "err", err)
+		return []WorkspaceRes{}, InternalServerError()
+	}
+	workspaces := make([]WorkspaceRes, 0, len(rows))
+	for _, row := range rows {
+		workspaces = append(workspaces, WorkspaceRes{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			Name:      row.Name,
+			Role:      row.Role,
+		})
+	}
+	return workspaces, nil
+}
+
+// authorize checks the principal's role in the workspace named by id, which
+// may differ from the workspace selected for the request
+func (s *Service) authorize(ctx context.Context, principal auth.Principal, id string, role string) (uuid.UUID, error) {
+	ctx, span := tracer.Start(ctx, "workspaces.authorize")
+	defer span.End()
+	uuid, err := uuid.Parse(id)
+	if err != nil {
+		slog.DebugContext(ctx, "Invalid workspace id", "err", err)
+		return uuid, InvalidUUIDError()
+	}
+	granted := ""
+	if principal.WorkspaceID == uuid {
+		granted = principal.WorkspaceRole
+	} else if principal.Kind == auth.KindUser {
+		granted, err = s.db.GetWorkspaceRole(ctx, db.GetWorkspaceRoleParams{
+			WorkspaceID: uuid,
+			Subject:     principal.String(),
+		})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			slog.ErrorContext(ctx, "Looking up workspace role failed", "err", err)
+			return uuid, InternalServerError()
+		}
+	}
+	if granted == "" {
+		return uuid, NotFoundError()
+	}
+	if !auth.RoleAtLeast(granted, role) {
+		return uuid, ForbiddenError()
+	}
+	return uuid, nil
+}
+
+func (s *Service) getMembers(ctx context.Context, id uuid.UUID) ([]MemberRes, error) {
+	ctx, span := tracer.Start(ctx, "workspaces.getMembers")
+	defer span.End()
+	rows, err := s.db.GetWorkspaceMembers(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Listing workspace members failed", "err", err)
+		return []MemberRes{}, InternalServerError()
+	}
+	members := make([]MemberRes, 0, len(rows))
+	for _, row := range rows {
+		members = append(members, MemberRes{
+			Subject:   row.Subject,
+			Role:      row.Role,
+			GrantedBy: row.GrantedBy,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+	return members, nil
+}
+
+func (s *Service) grantRole(ctx context.Context, id uuid.UUID, subject string, role string, grantedBy auth.Principal) error {
+	ctx, span := tracer.Start(ctx, "workspaces.grantRole")
+	defer span.End()
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		previous, err := q.GetWorkspaceRole(ctx, db.GetWorkspaceRoleParams{WorkspaceID: id, Subject: subject})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if previous == auth.RoleOwner && role != auth.RoleOwner {
+			if err := ensureAnotherOwner(ctx, q, id); err != nil {
+				return err
+			}
+		}
+		if _, err := q.GrantWorkspaceRole(ctx, db.GrantWorkspaceRoleParams{
+			WorkspaceID: id,
+			Subject:     subject,
+			Role:        role,
+			GrantedBy:   grantedBy.String(),
+		}); err != nil {
+			return err
+		}
+		entry := audit.Entry{
+			Action:      audit.ActionCreate,
+			EntityType:  audit.EntityMember,
+			EntityID:    id,
+			WorkspaceID: id,
+			After:       MemberRes{Subject: subject, Role: role},
+		}
+		if previous != "" {
+			entry.Action = audit.ActionUpdate
+			entry.Before = MemberRes{Subject: subject, Role: previous}
+		}
+		return audit.Record(ctx, q, entry)
+	})
+	if err != nil {
+		customErr := &CustomError{}
+		if errors.As(err, &customErr) {
+			return customErr
+		}
+		slog.ErrorContext(ctx, "Granting workspace role failed", "err", err)
+		return InternalServerError()
+	}
+	return nil
+}
+
+func (s *Service) revokeRole(ctx context.Context, id uuid.UUID, subject string) error {
+	ctx, span := tracer.Start(ctx, "workspaces.revokeRole")
+	defer span.End()
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		previous, err := q.GetWorkspaceRole(ctx, db.GetWorkspaceRoleParams{WorkspaceID: id, Subject: subject})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return NotFoundError()
+		}
+		if err != nil {
+			return err
+		}
+		if previous == auth.RoleOwner {
+			if err := ensureAnotherOwner(ctx, q, id); err != nil {
+				return err
+			}
+		}
+		if _, err := q.RevokeWorkspaceRole(ctx, db.RevokeWorkspaceRoleParams{WorkspaceID: id, Subject: subject}); err != nil {
+			return err
+		}
+		return audit.Record(ctx, q, audit.Entry{
+			Action:      audit.ActionDelete,
+			EntityType:  audit.EntityMember,
+			EntityID:    id,
+			WorkspaceID: id,
+			Before:      MemberRes{Subject: subject, Role: previous},
+		})
+	})
+	if err != nil {
+		customErr := &CustomError{}
+		if errors.As(err, &customErr) {
+			return customErr
+		}
+		slog.ErrorContext(ctx, "Revoking workspace role failed", "err", err)
+		return InternalServerError()
+	}
+	return nil
+}
+
+// see ensureAnotherOwner in maps, the owner rows stay locked until the
+// transaction ends
+func ensureAnotherOwner(ctx context.Context, q db.Querier, id uuid.UUID) error {
+	owners, err := q.LockWorkspaceOwners(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(owners) <= 1 {
+		return LastOwnerError()
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package workspaces
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"example.com/echo-backend/auth"
+	db "example.com/echo-backend/db/gen"
+	"example.com/echo-backend/dbtest"
+	"example.com/echo-backend/problem"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeQuerier answers GetWorkspaceRole, any other query panics
+type fakeQuerier struct {
+	db.Querier
+	roles map[uuid.UUID]map[string]string
+}
+
+func (q *fakeQuerier) GetWorkspaceRole(ctx context.Context, arg db.GetWorkspaceRoleParams) (string, error) {
+	role, ok := q.roles[arg.WorkspaceID][arg.Subject]
+	if !ok {
+		return "", pgx.ErrNoRows
+	}
+	return role, nil
+}
+
+func TestAuthorize(t *testing.T) {
+	selected := uuid.New()
+	other := uuid.New()
+	q := &fakeQuerier{roles: map[uuid.UUID]map[string]string{
+		other: {"user:42": auth.RoleViewer},
+	}}
+	user := auth.Principal{Kind: auth.KindUser, Subject: "42", WorkspaceID: selected, WorkspaceRole: auth.RoleOwner}
+	apiKey := auth.Principal{Kind: auth.KindApiKey, Subject: uuid.NewString(), WorkspaceID: selected, WorkspaceRole: auth.RoleOwner}
+	stranger := auth.Principal{Kind: auth.KindUser, Subject: "7"}
+
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		id        string
+		role      string
+		status    int
+	}{
+		{name: "selected workspace", principal: user, id: selected.String(), role: auth.RoleOwner},
+		{name: "another workspace of the user", principal: user, id: other.String(), role: auth.RoleViewer},
+		{name: "another workspace with too low a role", principal: user, id: other.String(), role: auth.RoleOwner, status: http.StatusForbidden},
+		{name: "API key in its workspace", principal: apiKey, id: selected.String(), role: auth.RoleOwner},
+		{name: "API key in another workspace", principal: apiKey, id: other.String(), role: auth.RoleViewer, status: http.StatusNotFound},
+		{name: "not a member", principal: stranger, id: other.String(), role: auth.RoleViewer, status: http.StatusNotFound},
+		{name: "invalid id", principal: user, id: "nope", role: auth.RoleViewer, status: http.StatusBadRequest},
+	}
+	s := NewService(q, nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := s.authorize(context.Background(), test.principal, test.id, test.role)
+			if test.status != 0 {
+				if problem.StatusOf(err) != test.status {
+					t.Fatalf("authorize = %v, want %d", err, test.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authorize: %v", err)
+			}
+			if id.String() != test.id {
+				t.Fatalf("authorize = %v, want %s", id, test.id)
+			}
+		})
+	}
+}
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	pool := dbtest.Pool(t)
+	return NewService(db.New(pool), pool)
+}
+
+func TestCreateWorkspace(t *testing.T) {
+	s := newTestService(t)
+	principal := auth.Principal{Kind: auth.KindUser, Subject: uuid.NewString()}
+	workspace, err := s.createWorkspace(context.Background(), WorkspaceCreationReq{Name: "team"}, principal)
+	if err != nil {
+		t.Fatalf("createWorkspace: %v", err)
+	}
+	if workspace.Role != auth.RoleOwner {
+		t.Fatalf("creator's role = %q, want owner", workspace.Role)
+	}
+	workspaces, err := s.getWorkspaces(context.Background(), principal)
+	if err != nil {
+		t.Fatalf("getWorkspaces: %v", err)
+	}
+	if len(workspaces) != 1 || workspaces[0].ID != workspace.ID || workspaces[0].Role != auth.RoleOwner {
+		t.Fatalf("getWorkspaces = %+v, want only the new workspace", workspaces)
+	}
+}
+
+func TestLastWorkspaceOwner(t *testing.T) {
+	s := newTestService(t)
+	ctx, id := dbtest.Workspace(t, s.db, "1")
+	owner, _ := auth.PrincipalFromContext(ctx)
+
+	if err := s.revokeRole(ctx, id, "user:1"); problem.StatusOf(err) != http.StatusConflict {
+		t.Fatalf("revoking the last owner = %v, want 409", err)
+	}
+	if err := s.grantRole(ctx, id, "user:1", auth.RoleViewer, owner); problem.StatusOf(err) != http.StatusConflict {
+		t.Fatalf("downgrading the last owner = %v, want 409", err)
+	}
+	if err := s.revokeRole(ctx, id, "user:9"); problem.StatusOf(err) != http.StatusNotFound {
+		t.Fatalf("revoking someone who isn't a member = %v, want 404", err)
+	}
+	if err := s.grantRole(ctx, id, "user:2", auth.RoleOwner, owner); err != nil {
+		t.Fatalf("grantRole: %v", err)
+	}
+	if err := s.revokeRole(ctx, id, "user:1"); err != nil {
+		t.Fatalf("revoking one of two owners: %v", err)
+	}
+	members, err := s.getMembers(ctx, id)
+	if err != nil {
+		t.Fatalf("getMembers: %v", err)
+	}
+	if len(members) != 1 || members[0].Subject != "user:2" {
+		t.Fatalf("getMembers = %+v, want only user:2", members)
+	}
+
+	entries, err := s.db.GetAuditEntries(ctx, db.GetAuditEntriesParams{
+		WorkspaceID: id,
+		EntityType:  pgtype.Text{String: "member", Valid: true},
+		Limit:       10,
+	})
+	if err != nil {
+		t.Fatalf("GetAuditEntries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != "delete" || entries[1].Action != "create" {
+		t.Fatalf("audit log has %d membership entries, want the grant and then the revoke", len(entries))
+	}
+	if entries[0].MapID.Valid || entries[0].Actor == "" {
+		t.Fatalf("membership entry = %+v, want an actor and no map", entries[0])
+	}
+}
+
+// two owners revoking each other at once must not leave the workspace
+// without one
+func TestLastWorkspaceOwnerConcurrently(t *testing.T) {
+	s := newTestService(t)
+	for i := 0; i < 10; i++ {
+		ctx, id := dbtest.Workspace(t, s.db, "1")
+		owner, _ := auth.PrincipalFromContext(ctx)
+		if err := s.grantRole(ctx, id, "user:2", auth.RoleOwner, owner); err != nil {
+			t.Fatalf("grantRole: %v", err)
+		}
+
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for i, subject := range []string{"user:1", "user:2"} {
+			wg.Add(1)
+			go func(i int, subject string) {
+				defer wg.Done()
+				errs[i] = s.revokeRole(ctx, id, subject)
+			}(i, subject)
+		}
+		wg.Wait()
+
+		conflicts := 0
+		for _, err := range errs {
+			if problem.StatusOf(err) == http.StatusConflict {
+				conflicts++
+			} else if err != nil {
+				t.Fatalf("revokeRole: %v", err)
+			}
+		}
+		members, err := s.getMembers(ctx, id)
+		if err != nil {
+			t.Fatalf("getMembers: %v", err)
+		}
+		if conflicts != 1 || len(members) != 1 {
+			t.Fatalf("%d revokes were refused and %d owners are left, want 1 and 1", conflicts, len(members))
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package workspaces
+
+import (
+	"context"
+
+	db "example.com/echo-backend/db/gen"
+	"github.com/jackc/pgx/v5"
+)
+
+// TxBeginner is satisfied by *pgxpool.Pool
+type TxBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// inTx runs fn against queries bound to a single transaction, committing only
+// when fn succeeds
+func (s *Service) inTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(db.New(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}